@@ -0,0 +1,357 @@
+package main
+
+import "math"
+
+// DefaultSampleRate is the audio output rate used unless another one is
+// configured.
+const DefaultSampleRate = 44100
+
+// Bits of $4015
+const (
+	statusPulse1   byte = 1 << 0
+	statusPulse2   byte = 1 << 1
+	statusTriangle byte = 1 << 2
+	statusNoise    byte = 1 << 3
+	statusDMC      byte = 1 << 4
+	statusFrameIRQ byte = 1 << 6
+	statusDMCIRQ   byte = 1 << 7
+)
+
+// Lookup tables for the nonlinear mixer. The pulse channels share one DAC
+// and the triangle, noise and DMC share another, so each table is indexed
+// by the weighted sum of the outputs driving its DAC.
+var (
+	pulseTable [31]float32
+	tndTable   [203]float32
+)
+
+func init() {
+	for i := 1; i < len(pulseTable); i++ {
+		pulseTable[i] = float32(95.52 / (8128.0/float64(i) + 100))
+	}
+	for i := 1; i < len(tndTable); i++ {
+		tndTable[i] = float32(163.67 / (24329.0/float64(i) + 100))
+	}
+}
+
+// APU emulates the audio half of the 2A03.
+//
+// It is clocked once per CPU cycle and mixes its five channels into a
+// stream of float32 samples at the configured output rate, which is
+// collected with ReadSamples.
+type APU struct {
+	pulse1   pulse
+	pulse2   pulse
+	triangle triangle
+	noise    noise
+	dmc      dmc
+
+	// Frame counter
+	frameCycle      int
+	fiveStepMode    bool
+	irqInhibit      bool
+	frameIRQ        bool
+	frameResetDelay int // CPU cycles until a $4017 write takes effect
+	frameNextMode   byte
+	cycle           uint64
+
+	// Timings of the emulated region
+	clockRate float64 // CPU clock in Hz, which the APU runs from
+	sequence  frameSequence
+
+	// Output
+	sampleRate  float64
+	sampleClock float64
+	filters     [3]audioFilter
+	samples     []float32
+	maxSamples  int // Samples beyond this are dropped if nobody reads them
+}
+
+func NewAPU() *APU {
+	a := &APU{}
+	a.pulse1.sweep.onesComplement = true
+	a.setRegion(RegionNTSC)
+	a.SetSampleRate(DefaultSampleRate)
+	a.Reset()
+	return a
+}
+
+// connectBus gives the DMC access to CPU memory for its sample reads, and
+// lets it hold the CPU off the bus while it reads.
+func (a *APU) connectBus(read func(addr uint16) byte, stall func(cycles int)) {
+	a.dmc.memoryRead = read
+	a.dmc.stallCPU = stall
+}
+
+// setRegion switches to the clock rate and timer periods of a region.
+func (a *APU) setRegion(region Region) {
+	timing := region.timing()
+	a.clockRate = timing.cpuClockRate
+	a.sequence = timing.frameSequence
+	a.noise.periods = timing.noisePeriods
+	a.dmc.rates = timing.dmcRates
+}
+
+// Reset silences every channel and restarts the frame counter.
+func (a *APU) Reset() {
+	a.cpuWrite(0x4015, 0x00)
+	a.pulse1.reset()
+	a.pulse2.reset()
+	a.triangle.reset()
+	a.noise.reset()
+	a.dmc.reset()
+
+	a.frameCycle = 0
+	a.frameResetDelay = 0
+	a.frameIRQ = false
+	a.cycle = 0
+	a.samples = a.samples[:0]
+}
+
+// SetSampleRate sets the rate, in Hz, of the samples the APU produces.
+func (a *APU) SetSampleRate(rate float64) {
+	a.sampleRate = rate
+	a.sampleClock = 0
+	a.maxSamples = int(rate / 2)
+
+	// The console's output stage: two high-pass filters and a low-pass
+	// filter, which among other things remove the DC offset of the DACs
+	a.filters[0] = highPassFilter(rate, 90)
+	a.filters[1] = highPassFilter(rate, 440)
+	a.filters[2] = lowPassFilter(rate, 14000)
+}
+
+// setOutputRate changes the rate samples are produced at without
+// redesigning the output filters, for the small corrections made by
+// dynamic rate control.
+func (a *APU) setOutputRate(rate float64) {
+	a.sampleRate = rate
+}
+
+// irqAsserted reports whether the frame counter is requesting an IRQ.
+func (a *APU) irqAsserted() bool {
+	return a.frameIRQ
+}
+
+// dmcIRQAsserted reports whether the DMC is requesting an IRQ.
+func (a *APU) dmcIRQAsserted() bool {
+	return a.dmc.irq
+}
+
+// --- CPU interface ---
+
+// cpuRead reads the status register, the only readable APU register.
+func (a *APU) cpuRead(addr uint16) byte {
+	data := byte(0)
+	if addr == 0x4015 {
+		if a.pulse1.length.value > 0 {
+			data |= statusPulse1
+		}
+		if a.pulse2.length.value > 0 {
+			data |= statusPulse2
+		}
+		if a.triangle.length.value > 0 {
+			data |= statusTriangle
+		}
+		if a.noise.length.value > 0 {
+			data |= statusNoise
+		}
+		if a.dmc.bytesRemaining > 0 {
+			data |= statusDMC
+		}
+		if a.frameIRQ {
+			data |= statusFrameIRQ
+		}
+		if a.dmc.irq {
+			data |= statusDMCIRQ
+		}
+
+		// Reading the status acknowledges the frame interrupt
+		a.frameIRQ = false
+	}
+	return data
+}
+
+// cpuWrite writes one of the APU registers at $4000-$4013, $4015 and
+// $4017.
+func (a *APU) cpuWrite(addr uint16, data byte) {
+	switch {
+	case addr >= 0x4000 && addr <= 0x4003:
+		a.pulse1.write(addr&0x03, data)
+	case addr >= 0x4004 && addr <= 0x4007:
+		a.pulse2.write(addr&0x03, data)
+	case addr >= 0x4008 && addr <= 0x400B:
+		a.triangle.write(addr&0x03, data)
+	case addr >= 0x400C && addr <= 0x400F:
+		a.noise.write(addr&0x03, data)
+	case addr >= 0x4010 && addr <= 0x4013:
+		a.dmc.write(addr&0x03, data)
+	case addr == 0x4015:
+		a.pulse1.length.setEnabled(data&statusPulse1 != 0)
+		a.pulse2.length.setEnabled(data&statusPulse2 != 0)
+		a.triangle.length.setEnabled(data&statusTriangle != 0)
+		a.noise.length.setEnabled(data&statusNoise != 0)
+		a.dmc.setEnabled(data&statusDMC != 0)
+	case addr == 0x4017:
+		a.irqInhibit = data&0x40 != 0
+		if a.irqInhibit {
+			a.frameIRQ = false
+		}
+
+		// The sequencer is reset 3 or 4 CPU cycles after the write,
+		// depending on whether it lands on an even or odd cycle
+		a.frameNextMode = data
+		a.frameResetDelay = 3
+		if a.cycle%2 == 1 {
+			a.frameResetDelay = 4
+		}
+	}
+}
+
+// --- Clocking ---
+
+// Clock advances the APU by one CPU cycle.
+func (a *APU) Clock() {
+	a.clockFrameCounter()
+
+	// The triangle, noise and DMC timers run at the CPU rate, the pulse
+	// timers at half of it
+	a.triangle.clockTimer()
+	a.noise.clockTimer()
+	a.dmc.clockTimer()
+	if a.cycle%2 == 1 {
+		a.pulse1.clockTimer()
+		a.pulse2.clockTimer()
+	}
+
+	a.sampleClock += a.sampleRate
+	if a.sampleClock >= a.clockRate {
+		a.sampleClock -= a.clockRate
+		sample := a.sample()
+		if len(a.samples) < a.maxSamples {
+			a.samples = append(a.samples, sample)
+		}
+	}
+
+	a.cycle++
+}
+
+// clockFrameCounter steps the frame counter, which clocks the envelopes,
+// linear counter, length counters and sweep units at roughly 240Hz and
+// optionally raises an IRQ at the end of each sequence.
+func (a *APU) clockFrameCounter() {
+	if a.frameResetDelay > 0 {
+		a.frameResetDelay--
+		if a.frameResetDelay == 0 {
+			a.fiveStepMode = a.frameNextMode&0x80 != 0
+			a.frameCycle = 0
+
+			// Selecting the five step sequence clocks every unit at once
+			if a.fiveStepMode {
+				a.quarterFrame()
+				a.halfFrame()
+			}
+		}
+	}
+
+	a.frameCycle++
+
+	switch a.frameCycle {
+	case a.sequence.step1, a.sequence.step3:
+		a.quarterFrame()
+	case a.sequence.step2:
+		a.quarterFrame()
+		a.halfFrame()
+	case a.sequence.irqStart:
+		if !a.fiveStepMode && !a.irqInhibit {
+			a.frameIRQ = true
+		}
+	case a.sequence.step4:
+		if !a.fiveStepMode {
+			a.quarterFrame()
+			a.halfFrame()
+			if !a.irqInhibit {
+				a.frameIRQ = true
+			}
+		}
+	case a.sequence.length4:
+		if !a.fiveStepMode {
+			if !a.irqInhibit {
+				a.frameIRQ = true
+			}
+			a.frameCycle = 0
+		}
+	case a.sequence.step5:
+		a.quarterFrame()
+		a.halfFrame()
+	case a.sequence.length5:
+		a.frameCycle = 0
+	}
+}
+
+// quarterFrame clocks the envelopes and the triangle's linear counter.
+func (a *APU) quarterFrame() {
+	a.pulse1.envelope.clock()
+	a.pulse2.envelope.clock()
+	a.noise.envelope.clock()
+	a.triangle.clockLinearCounter()
+}
+
+// halfFrame clocks the length counters and sweep units.
+func (a *APU) halfFrame() {
+	a.pulse1.length.clock()
+	a.pulse2.length.clock()
+	a.triangle.length.clock()
+	a.noise.length.clock()
+	a.pulse1.clockSweep()
+	a.pulse2.clockSweep()
+}
+
+// --- Output ---
+
+// sample mixes the channels as the console's DACs do and passes the result
+// through the output filters.
+func (a *APU) sample() float32 {
+	p := a.pulse1.output() + a.pulse2.output()
+	tnd := 3*int(a.triangle.output()) + 2*int(a.noise.output()) + int(a.dmc.output())
+	out := pulseTable[p] + tndTable[tnd]
+
+	for i := range a.filters {
+		out = a.filters[i].process(out)
+	}
+	return out
+}
+
+// ReadSamples moves up to len(dst) of the samples produced so far into dst
+// and returns how many were moved.
+func (a *APU) ReadSamples(dst []float32) int {
+	n := copy(dst, a.samples)
+	a.samples = a.samples[:copy(a.samples, a.samples[n:])]
+	return n
+}
+
+// audioFilter is a first order IIR filter.
+type audioFilter struct {
+	b0, b1, a1 float32
+	prevX      float32
+	prevY      float32
+}
+
+func lowPassFilter(sampleRate float64, cutoff float64) audioFilter {
+	c := float32(sampleRate / (math.Pi * cutoff))
+	a0 := 1 + c
+	return audioFilter{b0: 1 / a0, b1: 1 / a0, a1: (1 - c) / a0}
+}
+
+func highPassFilter(sampleRate float64, cutoff float64) audioFilter {
+	c := float32(sampleRate / (math.Pi * cutoff))
+	a0 := 1 + c
+	return audioFilter{b0: c / a0, b1: -c / a0, a1: (1 - c) / a0}
+}
+
+func (f *audioFilter) process(x float32) float32 {
+	y := f.b0*x + f.b1*f.prevX - f.a1*f.prevY
+	f.prevX = x
+	f.prevY = y
+	return y
+}
@@ -0,0 +1,496 @@
+package main
+
+// lengthTable maps the 5-bit length index written to a channel onto the
+// number of half frames the channel plays for.
+var lengthTable = [32]byte{
+	10, 254, 20, 2, 40, 4, 80, 6, 160, 8, 60, 10, 14, 12, 26, 14,
+	12, 16, 24, 18, 48, 20, 96, 22, 192, 24, 72, 26, 16, 28, 32, 30,
+}
+
+// dutyTable holds the waveforms of the four pulse duty cycles.
+var dutyTable = [4][8]byte{
+	{0, 1, 0, 0, 0, 0, 0, 0}, // 12.5%
+	{0, 1, 1, 0, 0, 0, 0, 0}, // 25%
+	{0, 1, 1, 1, 1, 0, 0, 0}, // 50%
+	{1, 0, 0, 1, 1, 1, 1, 1}, // 25% negated
+}
+
+// triangleSequence is the 32-step waveform of the triangle channel.
+var triangleSequence = [32]byte{
+	15, 14, 13, 12, 11, 10, 9, 8, 7, 6, 5, 4, 3, 2, 1, 0,
+	0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+}
+
+// noisePeriods are the NTSC noise timer periods, in CPU cycles.
+var noisePeriods = [16]uint16{
+	4, 8, 16, 32, 64, 96, 128, 160, 202, 254, 380, 508, 762, 1016, 2034, 4068,
+}
+
+// dmcRates are the NTSC DMC timer periods, in CPU cycles.
+var dmcRates = [16]uint16{
+	428, 380, 340, 320, 286, 254, 226, 214, 190, 160, 142, 128, 106, 84, 72, 54,
+}
+
+// noisePeriodsPAL are the PAL noise timer periods, in CPU cycles.
+var noisePeriodsPAL = [16]uint16{
+	4, 8, 14, 30, 60, 88, 118, 148, 188, 236, 354, 472, 708, 944, 1890, 3778,
+}
+
+// dmcRatesPAL are the PAL DMC timer periods, in CPU cycles.
+var dmcRatesPAL = [16]uint16{
+	398, 354, 316, 298, 276, 236, 210, 198, 176, 148, 132, 118, 98, 78, 66, 50,
+}
+
+// --- Shared units ---
+
+// envelope generates the volume of the pulse and noise channels, either a
+// constant or a decaying sawtooth.
+type envelope struct {
+	start    bool
+	loop     bool
+	constant bool
+	volume   byte // Constant volume, or the period of the decay
+	divider  byte
+	decay    byte
+}
+
+// write handles the --LC VVVV register shared by the pulse and noise
+// channels.
+func (e *envelope) write(data byte) {
+	e.loop = data&0x20 != 0
+	e.constant = data&0x10 != 0
+	e.volume = data & 0x0F
+}
+
+func (e *envelope) clock() {
+	if e.start {
+		e.start = false
+		e.decay = 15
+		e.divider = e.volume
+		return
+	}
+
+	if e.divider > 0 {
+		e.divider--
+		return
+	}
+
+	e.divider = e.volume
+	if e.decay > 0 {
+		e.decay--
+	} else if e.loop {
+		e.decay = 15
+	}
+}
+
+func (e *envelope) output() byte {
+	if e.constant {
+		return e.volume
+	}
+	return e.decay
+}
+
+// lengthCounter silences a channel after a programmed number of half
+// frames, unless halted.
+type lengthCounter struct {
+	enabled bool
+	halt    bool
+	value   byte
+}
+
+// load reloads the counter from the length table, if the channel is
+// enabled.
+func (l *lengthCounter) load(index byte) {
+	if l.enabled {
+		l.value = lengthTable[index&0x1F]
+	}
+}
+
+func (l *lengthCounter) setEnabled(enabled bool) {
+	l.enabled = enabled
+	if !enabled {
+		l.value = 0
+	}
+}
+
+func (l *lengthCounter) clock() {
+	if !l.halt && l.value > 0 {
+		l.value--
+	}
+}
+
+// sweep periodically bends the period of a pulse channel up or down.
+type sweep struct {
+	enabled bool
+	period  byte
+	negate  bool
+	shift   byte
+	divider byte
+	reload  bool
+
+	// Pulse 1 negates with ones' complement, so it sweeps down one
+	// further than pulse 2
+	onesComplement bool
+}
+
+// --- Pulse ---
+
+type pulse struct {
+	envelope envelope
+	length   lengthCounter
+	sweep    sweep
+
+	duty     byte
+	sequence byte
+	period   uint16
+	timer    uint16
+}
+
+func (p *pulse) reset() {
+	onesComplement := p.sweep.onesComplement
+	*p = pulse{}
+	p.sweep.onesComplement = onesComplement
+}
+
+func (p *pulse) write(reg uint16, data byte) {
+	switch reg {
+	case 0:
+		p.duty = data >> 6
+		p.length.halt = data&0x20 != 0
+		p.envelope.write(data)
+	case 1:
+		p.sweep.enabled = data&0x80 != 0
+		p.sweep.period = (data >> 4) & 0x07
+		p.sweep.negate = data&0x08 != 0
+		p.sweep.shift = data & 0x07
+		p.sweep.reload = true
+	case 2:
+		p.period = (p.period & 0x0700) | uint16(data)
+	case 3:
+		p.period = (p.period & 0x00FF) | uint16(data&0x07)<<8
+		p.length.load(data >> 3)
+		p.sequence = 0
+		p.envelope.start = true
+	}
+}
+
+// clockTimer is called every APU cycle, which is every other CPU cycle.
+func (p *pulse) clockTimer() {
+	if p.timer == 0 {
+		p.timer = p.period
+		p.sequence = (p.sequence + 1) & 0x07
+	} else {
+		p.timer--
+	}
+}
+
+// sweepTarget is the period the sweep unit is heading for.
+func (p *pulse) sweepTarget() uint16 {
+	change := p.period >> p.sweep.shift
+	if !p.sweep.negate {
+		return p.period + change
+	}
+	if p.sweep.onesComplement {
+		change++
+	}
+	if change > p.period {
+		return 0
+	}
+	return p.period - change
+}
+
+// muted reports whether the sweep unit is silencing the channel, which it
+// does whenever the period is out of range, even if sweeping is disabled.
+func (p *pulse) muted() bool {
+	return p.period < 8 || p.sweepTarget() > 0x07FF
+}
+
+func (p *pulse) clockSweep() {
+	if p.sweep.divider == 0 && p.sweep.enabled && p.sweep.shift > 0 && !p.muted() {
+		p.period = p.sweepTarget()
+	}
+
+	if p.sweep.divider == 0 || p.sweep.reload {
+		p.sweep.divider = p.sweep.period
+		p.sweep.reload = false
+	} else {
+		p.sweep.divider--
+	}
+}
+
+func (p *pulse) output() byte {
+	if dutyTable[p.duty][p.sequence] == 0 || p.length.value == 0 || p.muted() {
+		return 0
+	}
+	return p.envelope.output()
+}
+
+// --- Triangle ---
+
+type triangle struct {
+	length lengthCounter
+
+	control       bool // Also halts the length counter
+	linearReload  byte
+	linearCounter byte
+	reloadFlag    bool
+
+	sequence byte
+	period   uint16
+	timer    uint16
+}
+
+func (t *triangle) reset() {
+	*t = triangle{}
+}
+
+func (t *triangle) write(reg uint16, data byte) {
+	switch reg {
+	case 0:
+		t.control = data&0x80 != 0
+		t.length.halt = t.control
+		t.linearReload = data & 0x7F
+	case 2:
+		t.period = (t.period & 0x0700) | uint16(data)
+	case 3:
+		t.period = (t.period & 0x00FF) | uint16(data&0x07)<<8
+		t.length.load(data >> 3)
+		t.reloadFlag = true
+	}
+}
+
+// clockTimer is called every CPU cycle. The sequencer only moves while
+// both counters are non-zero, so a silenced triangle holds its level
+// rather than dropping to zero.
+func (t *triangle) clockTimer() {
+	if t.timer == 0 {
+		t.timer = t.period
+		if t.length.value > 0 && t.linearCounter > 0 {
+			t.sequence = (t.sequence + 1) & 0x1F
+		}
+	} else {
+		t.timer--
+	}
+}
+
+func (t *triangle) clockLinearCounter() {
+	if t.reloadFlag {
+		t.linearCounter = t.linearReload
+	} else if t.linearCounter > 0 {
+		t.linearCounter--
+	}
+	if !t.control {
+		t.reloadFlag = false
+	}
+}
+
+func (t *triangle) output() byte {
+	return triangleSequence[t.sequence]
+}
+
+// --- Noise ---
+
+type noise struct {
+	envelope envelope
+	length   lengthCounter
+
+	mode    bool // Short, metallic sounding sequence
+	shift   uint16
+	periods *[16]uint16 // Timer periods of the region
+	period  uint16
+	timer   uint16
+}
+
+func (n *noise) reset() {
+	*n = noise{shift: 1, periods: n.periods, period: n.periods[0]}
+}
+
+func (n *noise) write(reg uint16, data byte) {
+	switch reg {
+	case 0:
+		n.length.halt = data&0x20 != 0
+		n.envelope.write(data)
+	case 2:
+		n.mode = data&0x80 != 0
+		n.period = n.periods[data&0x0F]
+	case 3:
+		n.length.load(data >> 3)
+		n.envelope.start = true
+	}
+}
+
+// clockTimer is called every CPU cycle and steps the linear feedback
+// shift register.
+func (n *noise) clockTimer() {
+	if n.timer > 0 {
+		n.timer--
+		return
+	}
+	n.timer = n.period - 1
+
+	tap := uint16(1)
+	if n.mode {
+		tap = 6
+	}
+	feedback := (n.shift ^ (n.shift >> tap)) & 0x01
+	n.shift = (n.shift >> 1) | feedback<<14
+}
+
+func (n *noise) output() byte {
+	if n.shift&0x01 != 0 || n.length.value == 0 {
+		return 0
+	}
+	return n.envelope.output()
+}
+
+// --- DMC ---
+
+// dmc plays 1-bit delta encoded samples straight out of CPU memory.
+type dmc struct {
+	irqEnabled bool
+	loop       bool
+	irq        bool
+	rates      *[16]uint16 // Timer periods of the region
+	period     uint16
+	timer      uint16
+	level      byte
+
+	// Memory reader
+	sampleAddress  uint16
+	sampleLength   uint16
+	currentAddress uint16
+	bytesRemaining uint16
+	buffer         byte
+	bufferEmpty    bool
+
+	// Output unit
+	shift         byte
+	bitsRemaining byte
+	silence       bool
+
+	memoryRead func(addr uint16) byte
+	stallCPU   func(cycles int)
+}
+
+func (d *dmc) reset() {
+	d.irqEnabled = false
+	d.loop = false
+	d.irq = false
+	d.period = d.rates[0]
+	d.timer = 0
+	d.level = 0
+	d.sampleAddress = 0xC000
+	d.sampleLength = 1
+	d.currentAddress = 0xC000
+	d.bytesRemaining = 0
+	d.bufferEmpty = true
+	d.shift = 0
+	d.bitsRemaining = 8
+	d.silence = true
+}
+
+func (d *dmc) write(reg uint16, data byte) {
+	switch reg {
+	case 0:
+		d.irqEnabled = data&0x80 != 0
+		d.loop = data&0x40 != 0
+		d.period = d.rates[data&0x0F]
+		if !d.irqEnabled {
+			d.irq = false
+		}
+	case 1:
+		d.level = data & 0x7F
+	case 2:
+		d.sampleAddress = 0xC000 | uint16(data)<<6
+	case 3:
+		d.sampleLength = uint16(data)<<4 | 0x0001
+	}
+}
+
+// setEnabled starts or stops sample playback from a $4015 write, which
+// also acknowledges the DMC interrupt.
+func (d *dmc) setEnabled(enabled bool) {
+	d.irq = false
+	if !enabled {
+		d.bytesRemaining = 0
+		return
+	}
+	if d.bytesRemaining == 0 {
+		d.restart()
+		d.fillBuffer()
+	}
+}
+
+func (d *dmc) restart() {
+	d.currentAddress = d.sampleAddress
+	d.bytesRemaining = d.sampleLength
+}
+
+// fillBuffer fetches the next sample byte if the buffer has run dry.
+//
+// The fetch takes the bus away from the CPU for four cycles, which is the
+// common case on real hardware.
+func (d *dmc) fillBuffer() {
+	if !d.bufferEmpty || d.bytesRemaining == 0 || d.memoryRead == nil {
+		return
+	}
+
+	if d.stallCPU != nil {
+		d.stallCPU(4)
+	}
+	d.buffer = d.memoryRead(d.currentAddress)
+	d.bufferEmpty = false
+
+	// The address wraps around to $8000 rather than $0000
+	d.currentAddress++
+	if d.currentAddress == 0 {
+		d.currentAddress = 0x8000
+	}
+
+	d.bytesRemaining--
+	if d.bytesRemaining == 0 {
+		if d.loop {
+			d.restart()
+		} else if d.irqEnabled {
+			d.irq = true
+		}
+	}
+}
+
+// clockTimer is called every CPU cycle and shifts the next delta bit into
+// the output level.
+func (d *dmc) clockTimer() {
+	if d.timer > 0 {
+		d.timer--
+		return
+	}
+	d.timer = d.period - 1
+
+	if !d.silence {
+		if d.shift&0x01 != 0 {
+			if d.level <= 125 {
+				d.level += 2
+			}
+		} else if d.level >= 2 {
+			d.level -= 2
+		}
+	}
+	d.shift >>= 1
+
+	d.bitsRemaining--
+	if d.bitsRemaining == 0 {
+		d.bitsRemaining = 8
+		if d.bufferEmpty {
+			d.silence = true
+		} else {
+			d.silence = false
+			d.shift = d.buffer
+			d.bufferEmpty = true
+			d.fillBuffer()
+		}
+	}
+}
+
+func (d *dmc) output() byte {
+	return d.level
+}
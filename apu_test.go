@@ -0,0 +1,150 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// A $4017 write on an even cycle restarts the frame counter three cycles
+// later, so from then on clock n is cycle n-2 of the sequence.
+const frameResetOffset = 2
+
+func TestAPUFrameCounterHalfFrames(t *testing.T) {
+	const o = frameResetOffset
+	tests := []struct {
+		name   string
+		region Region
+		mode   byte // Written to $4017 before the first clock
+		want   []int
+	}{
+		{"NTSC four step", RegionNTSC, 0x00, []int{o + 14913, o + 29829, o + 29830 + 14913, o + 29830 + 29829}},
+		// Selecting five steps clocks a half frame as soon as the write
+		// takes effect
+		{"NTSC five step", RegionNTSC, 0x80, []int{o + 1, o + 14913, o + 37281, o + 37282 + 14913}},
+		{"PAL four step", RegionPAL, 0x00, []int{o + 16627, o + 33253, o + 33254 + 16627}},
+		{"PAL five step", RegionPAL, 0x80, []int{o + 1, o + 16627, o + 41565}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := NewAPU()
+			a.setRegion(test.region)
+			a.Reset()
+			a.cpuWrite(0x4017, test.mode)
+
+			// A long note on pulse 1, whose length counter counts the half
+			// frames
+			a.cpuWrite(0x4015, statusPulse1)
+			a.cpuWrite(0x4003, 0x01<<3)
+
+			var got []int
+			for clock := 1; len(got) < len(test.want); clock++ {
+				before := a.pulse1.length.value
+				a.Clock()
+				if a.pulse1.length.value != before {
+					got = append(got, clock)
+				}
+				if clock > 200000 {
+					t.Fatalf("only %d half frames by clock %d", len(got), clock)
+				}
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("half frames on clocks %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAPUFrameIRQ(t *testing.T) {
+	tests := []struct {
+		name string
+		mode byte // Written to $4017 before the first clock
+		want int  // Clock the IRQ is raised on, or 0 for never
+	}{
+		{"four step", 0x00, frameResetOffset + 29828},
+		{"four step with IRQs inhibited", 0x40, 0},
+		{"five step", 0x80, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := NewAPU()
+			a.cpuWrite(0x4017, test.mode)
+
+			got := 0
+			for clock := 1; clock <= 2*37282 && got == 0; clock++ {
+				a.Clock()
+				if a.irqAsserted() {
+					got = clock
+				}
+			}
+			if got != test.want {
+				t.Fatalf("IRQ on clock %d, want %d", got, test.want)
+			}
+			if got == 0 {
+				return
+			}
+
+			// The flag is reported in $4015, and reading it acknowledges
+			// the IRQ
+			if status := a.cpuRead(0x4015); status&statusFrameIRQ == 0 {
+				t.Errorf("$4015 = %08b, want the frame IRQ bit set", status)
+			}
+			if a.irqAsserted() {
+				t.Error("IRQ still asserted after reading $4015")
+			}
+		})
+	}
+}
+
+func TestAPUFrameIRQInhibitClearsFlag(t *testing.T) {
+	a := NewAPU()
+	for !a.irqAsserted() {
+		a.Clock()
+	}
+	a.cpuWrite(0x4017, 0x40)
+	if a.irqAsserted() {
+		t.Error("IRQ still asserted after setting the inhibit flag")
+	}
+}
+
+func TestAPULengthCounters(t *testing.T) {
+	const o = frameResetOffset
+	tests := []struct {
+		name   string
+		writes [][2]uint16 // Address and value, in order
+		clocks int         // CPU cycles to run afterwards
+		status byte        // Expected $4015, without the IRQ bits
+	}{
+		{"disabled channels ignore loads", [][2]uint16{{0x4003, 0x08}, {0x4007, 0x08}}, 0, 0},
+		{"pulse 1", [][2]uint16{{0x4015, 0x01}, {0x4003, 0x08}}, 0, statusPulse1},
+		{"pulse 2", [][2]uint16{{0x4015, 0x02}, {0x4007, 0x08}}, 0, statusPulse2},
+		{"triangle", [][2]uint16{{0x4015, 0x04}, {0x400B, 0x08}}, 0, statusTriangle},
+		{"noise", [][2]uint16{{0x4015, 0x08}, {0x400F, 0x08}}, 0, statusNoise},
+		{"disabling clears the counter", [][2]uint16{{0x4015, 0x01}, {0x4003, 0x08}, {0x4015, 0x00}}, 0, 0},
+		// Index 3 is a length of 2, which runs out on the second half frame
+		{"counts down on half frames", [][2]uint16{{0x4015, 0x01}, {0x4003, 0x03 << 3}}, o + 14913, statusPulse1},
+		{"runs out", [][2]uint16{{0x4015, 0x01}, {0x4003, 0x03 << 3}}, o + 29829, 0},
+		{"pulse halt", [][2]uint16{{0x4015, 0x01}, {0x4000, 0x20}, {0x4003, 0x03 << 3}}, o + 29829, statusPulse1},
+		{"triangle halt", [][2]uint16{{0x4015, 0x04}, {0x4008, 0x80}, {0x400B, 0x03 << 3}}, o + 29829, statusTriangle},
+		{"noise halt", [][2]uint16{{0x4015, 0x08}, {0x400C, 0x20}, {0x400F, 0x03 << 3}}, o + 29829, statusNoise},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := NewAPU()
+			a.cpuWrite(0x4017, 0x40) // Keep the frame IRQ out of the way
+			for _, write := range test.writes {
+				a.cpuWrite(write[0], byte(write[1]))
+			}
+			for i := 0; i < test.clocks; i++ {
+				a.Clock()
+			}
+
+			status := a.cpuRead(0x4015) &^ (statusFrameIRQ | statusDMCIRQ)
+			if status != test.status {
+				t.Errorf("$4015 = %08b, want %08b", status, test.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+const (
+	// audioBufferSeconds is the size of the ring buffer between the
+	// emulator and the audio device
+	audioBufferSeconds = 0.1
+
+	// audioMaxRateDelta bounds how far dynamic rate control may stretch
+	// or squeeze the output rate. At half a percent the pitch change is
+	// inaudible, but it easily absorbs the difference between the
+	// emulated frame rate and the display's.
+	audioMaxRateDelta = 0.005
+
+	// audioDeviceBufferFrames is the size of the buffer raylib asks to
+	// have filled on each callback
+	audioDeviceBufferFrames = 512
+)
+
+// audioOutput plays the APU's samples through a raylib audio stream.
+//
+// The APU's samples are moved into a ring buffer once per video frame,
+// and the audio device drains the ring from its own thread. As the video
+// loop and the audio device run from different clocks, the APU's output
+// rate is continually nudged so that the ring stays about half full:
+// production speeds up when the ring runs low and slows down when it
+// fills, so audio neither crackles from underruns nor drifts out of sync.
+type audioOutput struct {
+	apu        *APU
+	ring       *sampleRing
+	stream     rl.AudioStream
+	sampleRate float64
+
+	pending []float32 // Samples moved out of the APU each frame
+	last    float32   // Last sample played, repeated on underrun
+}
+
+// newAudioOutput opens the audio device and starts playing the APU's
+// output at sampleRate.
+func newAudioOutput(apu *APU, sampleRate int) *audioOutput {
+	a := &audioOutput{
+		apu:        apu,
+		ring:       newSampleRing(int(float64(sampleRate) * audioBufferSeconds)),
+		sampleRate: float64(sampleRate),
+		pending:    make([]float32, sampleRate/10),
+	}
+	apu.SetSampleRate(a.sampleRate)
+
+	rl.InitAudioDevice()
+	rl.SetAudioStreamBufferSizeDefault(audioDeviceBufferFrames)
+	a.stream = rl.LoadAudioStream(uint32(sampleRate), 32, 1)
+	rl.SetAudioStreamCallback(a.stream, a.fill)
+	rl.PlayAudioStream(a.stream)
+	return a
+}
+
+// fill is called on the audio thread whenever the device needs more
+// samples.
+func (a *audioOutput) fill(data []float32, frames int) {
+	n := a.ring.Read(data[:frames])
+	if n > 0 {
+		a.last = data[n-1]
+	}
+
+	// Hold the last level rather than dropping to silence, which would
+	// click
+	for i := n; i < frames; i++ {
+		data[i] = a.last
+	}
+}
+
+// update moves the samples produced since the last call into the ring
+// buffer and adjusts the APU's output rate for the next frame.
+func (a *audioOutput) update() {
+	for {
+		n := a.apu.ReadSamples(a.pending)
+		if n == 0 {
+			break
+		}
+		a.ring.Write(a.pending[:n])
+	}
+
+	// Fill level in the range -1 (empty) to 1 (full), with 0 at the
+	// half full target
+	fill := float64(a.ring.Len())/float64(a.ring.Capacity())*2 - 1
+	a.apu.setOutputRate(a.sampleRate * (1 - audioMaxRateDelta*fill))
+}
+
+// close stops playback and releases the audio device.
+func (a *audioOutput) close() {
+	rl.StopAudioStream(a.stream)
+	rl.UnloadAudioStream(a.stream)
+	rl.CloseAudioDevice()
+}
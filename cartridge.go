@@ -1,7 +1,12 @@
 package main
 
 import (
-	"encoding/binary"
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
 	"os"
 )
 
@@ -12,8 +17,24 @@ const (
 	Vertical
 	OnScreenHi
 	OnScreenLo
+	FourScreen
+
+	// Hardware is reported by mappers that leave the mirroring to the
+	// cartridge's wiring, as given by the header
+	Hardware
 )
 
+var mirrorNames = [...]string{
+	"horizontal", "vertical", "single-screen high", "single-screen low", "four-screen", "hardware",
+}
+
+func (m Mirror) String() string {
+	if int(m) < len(mirrorNames) {
+		return mirrorNames[m]
+	}
+	return fmt.Sprintf("Mirror(%d)", int(m))
+}
+
 type CartridgeHeader struct {
 	Name         [4]byte
 	PrgROMChunks uint8
@@ -27,11 +48,10 @@ type CartridgeHeader struct {
 }
 
 type Cartridge struct {
-	imageValid bool
-	mirror     Mirror
-	header     CartridgeHeader
+	mirror Mirror
+	header CartridgeHeader
+	info   CartridgeInfo // Decoded from header
 
-	mapperId uint8 // Mapper ID
 	prgBanks uint8 // PRG banks
 	chrBanks uint8 // CHR banks
 
@@ -40,30 +60,117 @@ type Cartridge struct {
 	// ChrMemory is a vector of uint8s
 	chrMemory []byte
 
+	// Trainer is 512 bytes that some images load into $7000-$71FF
+	trainer []byte
+
+	// Checksums of the ROM as read, before it was padded to whole banks
+	romChecksums ROMChecksums
+
 	mapper Mapper
+
+	// Whether the board may have bus conflicts, and whether they are
+	// being emulated
+	busConflictMode BusConflicts
+	busConflicts    bool
 }
 
-func NewCartridge(filename string) *Cartridge {
-	var mapper Mapper
-	var imageValid bool
-	var prgBanks uint8
-	var prgMemory []byte
-	var chrBanks uint8
-	var chrMemory []byte
-	var header CartridgeHeader
+// trainerAddr is where a trainer is loaded in PRG RAM.
+const trainerAddr = 0x7000
 
+// inesMagic starts every iNES and NES 2.0 image.
+var inesMagic = [4]byte{'N', 'E', 'S', 0x1A}
+
+// ErrBadMagic is returned when data does not start with the iNES magic
+// number.
+var ErrBadMagic = errors.New(`not an iNES image: missing "NES\x1A" magic number`)
+
+// TruncatedError is returned when an image ends before a section its
+// header promises.
+type TruncatedError struct {
+	Section  string
+	Expected int // Bytes the section should have
+	Got      int // Bytes that were read
+}
+
+func (e *TruncatedError) Error() string {
+	return fmt.Sprintf("truncated %s: expected %d bytes, got %d", e.Section, e.Expected, e.Got)
+}
+
+// NewCartridge loads the iNES or NES 2.0 image in the named file.
+func NewCartridge(filename string) (*Cartridge, error) {
 	// Open the file
 	file, err := os.Open(filename)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	defer file.Close() // Close when we're done
 
-	// Read the header from the file
-	headerBytes := make([]byte, binary.Size(header))
-	_, err = file.Read(headerBytes)
+	c, err := LoadCartridge(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return c, nil
+}
+
+// NewCartridgeFromBytes loads an iNES or NES 2.0 image held in memory.
+func NewCartridgeFromBytes(data []byte) (*Cartridge, error) {
+	return LoadCartridge(bytes.NewReader(data))
+}
+
+// LoadCartridge reads an iNES or NES 2.0 image from r and builds the
+// mapper it needs.
+func LoadCartridge(r io.Reader) (*Cartridge, error) {
+	c, err := readImage(r)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+
+	// Describe the board, as corrected by the game database
+	config := MapperConfig{
+		Mapper:       c.info.Mapper,
+		Submapper:    c.info.Submapper,
+		PRGBanks:     c.prgBanks,
+		CHRBanks:     c.chrBanks,
+		PRGRAMSize:   c.info.PRGRAMSize,
+		PRGNVRAMSize: c.info.PRGNVRAMSize,
+		CHRRAMSize:   c.info.CHRRAMSize,
+		CHRNVRAMSize: c.info.CHRNVRAMSize,
+		FourScreen:   c.info.FourScreen,
+	}
+	if c.chrBanks == 0 {
+		// No CHR ROM, so the board has CHR RAM instead
+		c.chrMemory = make([]byte, config.chrRAMSize())
+	}
+
+	// Load the appropriate mapper
+	var mapperInfo MapperInfo
+	c.mapper, mapperInfo, err = newMapper(config)
+	if err != nil {
+		return nil, err
+	}
+	c.busConflictMode = mapperInfo.BusConflicts
+	c.setBusConflicts(false)
+
+	// The trainer is loaded into PRG RAM, where the game expects it
+	for i, b := range c.trainer {
+		c.cpuWrite(trainerAddr+uint16(i), b)
+	}
+	return c, nil
+}
+
+// readImage reads the header, trainer and ROM of an image from r without
+// building a mapper, so that images for unsupported mappers can still be
+// inspected.
+func readImage(r io.Reader) (*Cartridge, error) {
+	var header CartridgeHeader
+
+	// Read the header from the file
+	var headerBytes [inesHeaderSize]byte
+	if err := readSection(r, headerBytes[:], "header"); err != nil {
+		return nil, err
+	}
+	if [4]byte(headerBytes[:4]) != inesMagic {
+		return nil, ErrBadMagic
 	}
 
 	// Copy the header data into the header struct
@@ -77,73 +184,137 @@ func NewCartridge(filename string) *Cartridge {
 	header.TVSystem2 = headerBytes[10]
 	copy(header.Unused[:], headerBytes[11:])
 
-	// If a "trainer" exists, skip it
-	if headerBytes[6] != 0 {
-		_, err = file.Seek(512, 1)
-		if err != nil {
-			panic(err)
-		}
+	info, err := parseHeader(headerBytes)
+	if err != nil {
+		return nil, err
 	}
 
-	// Determine mapper id
-	mapperId := ((headerBytes[6] >> 4) << 4) | (headerBytes[7] >> 4)
-	mirror := Horizontal
-	if headerBytes[6]&1 == 1 {
-		mirror = Vertical
+	c := &Cartridge{
+		mirror: info.Mirror,
+		header: header,
+		info:   info,
 	}
 
-	fileType := 1
-
-	if fileType == 0 {
-	} else if fileType == 1 {
-		// Populate PRG banks and allocate memory
-		prgBanks = headerBytes[4]
-		prgMemory = make([]byte, int(prgBanks)*16384)
-		_, err = file.Read(prgMemory)
-		if err != nil {
-			panic(err)
+	// The trainer, if present, sits between the header and PRG ROM
+	if info.Trainer {
+		c.trainer = make([]byte, inesTrainerSize)
+		if err := readSection(r, c.trainer, "trainer"); err != nil {
+			return nil, err
 		}
+	}
+
+	// Populate PRG banks and allocate memory
+	c.prgBanks = bankCount(info.PRGROMSize, prgROMUnit)
+	c.prgMemory = make([]byte, info.PRGROMSize)
+	if err := readSection(r, c.prgMemory, "PRG ROM"); err != nil {
+		return nil, err
+	}
 
-		// Populate CHR banks and allocate memory
-		chrBanks = headerBytes[5]
-		chrMemory = make([]byte, int(chrBanks)*8192)
-		_, err = file.Read(chrMemory)
-		if err != nil {
-			panic(err)
+	// Populate CHR banks and allocate memory
+	c.chrBanks = bankCount(info.CHRROMSize, chrROMUnit)
+	if c.chrBanks != 0 {
+		c.chrMemory = make([]byte, info.CHRROMSize)
+		if err := readSection(r, c.chrMemory, "CHR ROM"); err != nil {
+			return nil, err
 		}
 	}
 
-	// Load the appropriate mapper
-	switch mapperId {
-	case 0:
-		mapper = &Mapper000{}
-		imageValid = true
+	// The ROM is identified by what is in the file, so it is hashed
+	// before being padded
+	c.romChecksums = romChecksums(c.prgMemory, c.chrMemory)
+	c.prgMemory = padROM(c.prgMemory, prgROMUnit)
+	if c.chrMemory != nil {
+		c.chrMemory = padROM(c.chrMemory, chrROMUnit)
 	}
 
-	// Return a new cartridge
-	c := &Cartridge{
-		mirror:     mirror,
-		header:     header,
-		mapperId:   mapperId,
-		prgBanks:   prgBanks,
-		chrBanks:   chrBanks,
-		prgMemory:  prgMemory,
-		chrMemory:  chrMemory,
-		mapper:     mapper,
-		imageValid: imageValid,
+	// Now the ROM is known, the header can be checked against the game
+	// database
+	if gameDatabase != nil {
+		c.applyGameDB(gameDatabase)
+	}
+
+	return c, nil
+}
+
+// readSection fills buf from r, reporting a short read as a
+// TruncatedError.
+func readSection(r io.Reader, buf []byte, section string) error {
+	n, err := io.ReadFull(r, buf)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return &TruncatedError{Section: section, Expected: len(buf), Got: n}
 	}
+	return err
+}
 
-	return c
+// padROM repeats rom until it fills a whole number of banks of unit
+// bytes, as a ROM chip smaller than the space a mapper gives it is mirrored
+// through that space. NES 2.0 sizes need not be whole banks.
+func padROM(rom []byte, unit int) []byte {
+	if len(rom)%unit == 0 {
+		return rom
+	}
+	padded := make([]byte, (len(rom)/unit+1)*unit)
+	for i := 0; i < len(padded); i += len(rom) {
+		copy(padded[i:], rom)
+	}
+	return padded
 }
 
-func (c *Cartridge) ImageValid() bool {
-	return c.imageValid
+// bankCount returns how many banks of unit bytes hold size bytes of ROM.
+// The mappers count banks in a byte, so larger ROMs are cut short.
+func bankCount(size int, unit int) uint8 {
+	return uint8(min((size+unit-1)/unit, 0xFF))
+}
+
+// Info returns what the ROM image's header says about the cartridge.
+func (c *Cartridge) Info() CartridgeInfo {
+	return c.info
+}
+
+// ROMChecksums identify the contents of a cartridge's ROM, regardless of
+// the header in front of it.
+type ROMChecksums struct {
+	CRC32 uint32
+	SHA1  [sha1.Size]byte
+}
+
+// checksums returns the checksums of the cartridge's ROM.
+func (c *Cartridge) checksums() ROMChecksums {
+	return c.romChecksums
+}
+
+// romChecksums hashes the PRG ROM followed by the CHR ROM, leaving out the
+// header, the trainer and any CHR RAM. This is how ROM databases identify
+// games.
+func romChecksums(prg []byte, chr []byte) ROMChecksums {
+	crc := crc32.NewIEEE()
+	sum := sha1.New()
+	w := io.MultiWriter(crc, sum)
+	w.Write(prg)
+	w.Write(chr)
+
+	var checksums ROMChecksums
+	checksums.CRC32 = crc.Sum32()
+	sum.Sum(checksums.SHA1[:0])
+	return checksums
+}
+
+// vector reads one of the interrupt vectors at $FFFA-$FFFF from the last
+// bank of PRG ROM, which nearly every mapper has there at power on.
+func (c *Cartridge) vector(addr uint16) uint16 {
+	offset := len(c.prgMemory) - (0x10000 - int(addr))
+	if offset < 0 {
+		return 0
+	}
+	return uint16(c.prgMemory[offset+1])<<8 | uint16(c.prgMemory[offset])
 }
 
 func (c *Cartridge) cpuRead(addr uint16, data *byte) bool {
 	mappedAddress := uint32(0)
-	if c.mapper.cpuMapRead(addr, &mappedAddress) {
-		*data = c.prgMemory[mappedAddress]
+	if c.mapper.cpuMapRead(addr, &mappedAddress, data) {
+		if mappedAddress != mappedAddressMapper {
+			*data = c.prgMemory[mappedAddress]
+		}
 		return true
 	} else {
 		return false
@@ -152,10 +323,80 @@ func (c *Cartridge) cpuRead(addr uint16, data *byte) bool {
 
 func (c *Cartridge) cpuWrite(addr uint16, data byte) bool {
 	mappedAddress := uint32(0)
-	if c.mapper.cpuMapWrite(addr, &mappedAddress) {
-		c.prgMemory[mappedAddress] = data
+	if c.busConflicts && addr >= 0x8000 {
+		var rom byte
+		if c.cpuRead(addr, &rom) {
+			data &= rom
+		}
+	}
+	if c.mapper.cpuMapWrite(addr, &mappedAddress, data) {
+		if mappedAddress != mappedAddressMapper {
+			c.prgMemory[mappedAddress] = data
+		}
 		return true
 	} else {
 		return false
 	}
 }
+
+func (c *Cartridge) ppuRead(addr uint16, data *byte) bool {
+	mappedAddress := uint32(0)
+	if c.mapper.ppuMapRead(addr, &mappedAddress) {
+		*data = c.chrMemory[mappedAddress]
+		return true
+	} else {
+		return false
+	}
+}
+
+func (c *Cartridge) ppuWrite(addr uint16, data byte) bool {
+	mappedAddress := uint32(0)
+	if c.mapper.ppuMapWrite(addr, &mappedAddress) {
+		c.chrMemory[mappedAddress] = data
+		return true
+	} else {
+		return false
+	}
+}
+
+// mirroring reports how the nametables are currently mirrored, which some
+// mappers can change at runtime.
+func (c *Cartridge) mirroring() Mirror {
+	if m := c.mapper.mirror(); m != Hardware {
+		return m
+	}
+	return c.mirror
+}
+
+// observePPUAddress passes an address seen on the PPU bus to the mapper.
+func (c *Cartridge) observePPUAddress(addr uint16, ppuCycle uint64) {
+	c.mapper.ppuAddress(addr, ppuCycle)
+}
+
+// irqState reports whether the cartridge is asserting the CPU's IRQ line.
+func (c *Cartridge) irqState() bool {
+	return c.mapper.irqState()
+}
+
+// setBusConflicts turns bus conflict emulation on or off for boards that
+// may have bus conflicts. Games written for boards with bus conflicts
+// avoid them by writing a value equal to the ROM byte at the target
+// address, so the option only matters for software that doesn't, such as
+// homebrew or test ROMs. Boards known to have bus conflicts always have
+// them, and boards known not to never do.
+func (c *Cartridge) setBusConflicts(enabled bool) {
+	switch c.busConflictMode {
+	case BusConflictsAlways:
+		c.busConflicts = true
+	case BusConflictsOptional:
+		c.busConflicts = enabled
+	default:
+		c.busConflicts = false
+	}
+}
+
+func (c *Cartridge) reset() {
+	if c.mapper != nil {
+		c.mapper.reset()
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"hash/crc32"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testImage builds an iNES 1.0 image for tests. The program is placed at
+// the start of PRG ROM, and every bank's reset vector points at $8000.
+func testImage(t *testing.T, mapper byte, prgBanks int, chrBanks int, program []byte) []byte {
+	t.Helper()
+
+	header := []byte{'N', 'E', 'S', 0x1A, byte(prgBanks), byte(chrBanks), mapper << 4, mapper & 0xF0, 0, 0, 0, 0, 0, 0, 0, 0}
+	prg := make([]byte, prgBanks*prgROMUnit)
+	copy(prg, program)
+	for bank := prgROMUnit; bank <= len(prg); bank += prgROMUnit {
+		prg[bank-4] = 0x00
+		prg[bank-3] = 0x80
+	}
+	chr := make([]byte, chrBanks*chrROMUnit)
+
+	return bytes.Join([][]byte{header, prg, chr}, nil)
+}
+
+// loadTestImage loads an image built by testImage.
+func loadTestImage(t *testing.T, image []byte) *Cartridge {
+	t.Helper()
+
+	cart, err := NewCartridgeFromBytes(image)
+	if err != nil {
+		t.Fatalf("loading test image: %v", err)
+	}
+	return cart
+}
+
+func TestCartridgeSmallROMIsMirrored(t *testing.T) {
+	tests := []struct {
+		name   string
+		header [inesHeaderSize]byte
+		prg    int // Bytes of PRG ROM
+		chr    int // Bytes of CHR ROM
+	}{
+		{"NES 2.0 8K NROM", header(13<<2, 12<<2, 0x00, 0x08, 0x00, 0xFF), 8192, 4096},
+		{"16K AxROM", header(1, 0, 0x70, 0x00), 16384, 0},
+		{"16K GxROM", header(1, 1, 0x20, 0x40), 16384, 8192},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			prg := make([]byte, test.prg)
+			for i := range prg {
+				prg[i] = byte(i * 7)
+			}
+			chr := make([]byte, test.chr)
+			for i := range chr {
+				chr[i] = byte(i * 3)
+			}
+			cart := loadTestImage(t, bytes.Join([][]byte{test.header[:], prg, chr}, nil))
+
+			for addr := 0x8000; addr <= 0xFFFF; addr += 0x0FFF {
+				var got byte
+				if !cart.cpuRead(uint16(addr), &got) {
+					t.Fatalf("$%04X not mapped", addr)
+				}
+				if want := prg[(addr-0x8000)%test.prg]; got != want {
+					t.Errorf("$%04X = $%02X, want $%02X", addr, got, want)
+				}
+			}
+			if test.chr == 0 {
+				return
+			}
+			for addr := 0x0000; addr <= 0x1FFF; addr += 0x03FF {
+				var got byte
+				if !cart.ppuRead(uint16(addr), &got) {
+					t.Fatalf("PPU $%04X not mapped", addr)
+				}
+				if want := chr[addr%test.chr]; got != want {
+					t.Errorf("PPU $%04X = $%02X, want $%02X", addr, got, want)
+				}
+			}
+
+			// Only the ROM itself identifies the game, not the mirrors
+			want := crc32.ChecksumIEEE(append(prg, chr...))
+			if got := cart.checksums().CRC32; got != want {
+				t.Errorf("CRC32 %08X, want %08X", got, want)
+			}
+		})
+	}
+}
+
+func TestCartridgeTrainer(t *testing.T) {
+	for _, mapper := range []byte{0, 1, 2, 3, 4, 7, 66} {
+		image := testImage(t, mapper, 2, 1, nil)
+		image[6] |= flags6Trainer
+		trainer := make([]byte, inesTrainerSize)
+		for i := range trainer {
+			trainer[i] = byte(i) ^ 0x5A
+		}
+		image = bytes.Join([][]byte{image[:inesHeaderSize], trainer, image[inesHeaderSize:]}, nil)
+		cart := loadTestImage(t, image)
+
+		for i, want := range trainer {
+			var got byte
+			if !cart.cpuRead(trainerAddr+uint16(i), &got) || got != want {
+				t.Fatalf("mapper %d: $%04X = $%02X, want $%02X", mapper, trainerAddr+i, got, want)
+			}
+		}
+	}
+}
+
+func TestCartridgeBusConflicts(t *testing.T) {
+	type write struct {
+		addr  uint16
+		value byte
+	}
+	tests := []struct {
+		name         string
+		header       [inesHeaderSize]byte
+		busConflicts bool
+		writes       []write
+
+		want   byte // Read from $8000 afterwards
+		mirror Mirror
+	}{
+		{
+			name:   "UxROM",
+			header: header(4, 0, 0x21, 0x00),
+			writes: []write{{0x8000, 1}},
+			want:   2, mirror: Vertical,
+		},
+		{
+			name:         "UxROM with bus conflicts",
+			header:       header(4, 0, 0x21, 0x00),
+			busConflicts: true,
+			writes:       []write{{0x8000, 1}},
+			want:         0, mirror: Vertical,
+		},
+		{
+			name:         "UxROM submapper 1 has none",
+			header:       header(4, 0, 0x21, 0x08, 0x10),
+			busConflicts: true,
+			writes:       []write{{0x8000, 1}},
+			want:         2, mirror: Vertical,
+		},
+		{
+			name:   "UxROM submapper 2 always has them",
+			header: header(4, 0, 0x21, 0x08, 0x20),
+			writes: []write{{0x8000, 1}},
+			want:   0, mirror: Vertical,
+		},
+		{
+			name:         "MMC1 has none",
+			header:       header(4, 0, 0x10, 0x00),
+			busConflicts: true,
+			// Control $02: vertical mirroring, 32K PRG mode
+			writes: []write{{0x8000, 0}, {0x8000, 1}, {0x8000, 0}, {0x8000, 0}, {0x8000, 0}},
+			want:   0, mirror: Vertical,
+		},
+		{
+			name:         "MMC3 has none",
+			header:       header(4, 0, 0x40, 0x00),
+			busConflicts: true,
+			// R6 = 3
+			writes: []write{{0x8000, 6}, {0x8001, 3}, {0xA000, 0}},
+			want:   3, mirror: Vertical,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Each 8K of PRG ROM is filled with its number, so $8000 is
+			// zero at power up on all these boards
+			prg := make([]byte, int(test.header[4])*prgROMUnit)
+			for i := range prg {
+				prg[i] = byte(i / 0x2000)
+			}
+			cart := loadTestImage(t, bytes.Join([][]byte{test.header[:], prg}, nil))
+			cart.setBusConflicts(test.busConflicts)
+
+			for _, w := range test.writes {
+				cart.cpuWrite(w.addr, w.value)
+			}
+
+			var got byte
+			cart.cpuRead(0x8000, &got)
+			if got != test.want {
+				t.Errorf("$8000 = %d, want %d", got, test.want)
+			}
+			if got := cart.mirroring(); got != test.mirror {
+				t.Errorf("mirroring %v, want %v", got, test.mirror)
+			}
+		})
+	}
+}
+
+func TestLoadCartridgeErrors(t *testing.T) {
+	nrom := testImage(t, 0, 2, 1, nil)
+	trainer := header(1, 1, 0x04)
+	noPRG := header(0, 1)
+
+	tests := []struct {
+		name      string
+		image     []byte
+		badMagic  bool
+		truncated *TruncatedError
+		size      bool   // An InvalidSizeError
+		mapper    uint16 // Of an UnsupportedMapperError, if not 0
+	}{
+		{name: "empty", image: nil, truncated: &TruncatedError{"header", 16, 0}},
+		{name: "short header", image: nrom[:10], truncated: &TruncatedError{"header", 16, 10}},
+		{name: "bad magic", image: append([]byte("NES\x00"), nrom[4:]...), badMagic: true},
+		{name: "short trainer", image: append(trainer[:], make([]byte, 100)...), truncated: &TruncatedError{"trainer", 512, 100}},
+		{name: "short PRG ROM", image: nrom[:16+20000], truncated: &TruncatedError{"PRG ROM", 32768, 20000}},
+		{name: "short CHR ROM", image: nrom[:len(nrom)-100], truncated: &TruncatedError{"CHR ROM", 8192, 8092}},
+		{name: "no PRG ROM", image: append(noPRG[:], make([]byte, 8192)...), size: true},
+		{name: "unsupported mapper", image: testImage(t, 5, 2, 1, nil), mapper: 5},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewCartridgeFromBytes(test.image)
+			if err == nil {
+				t.Fatal("loaded without error")
+			}
+
+			if errors.Is(err, ErrBadMagic) != test.badMagic {
+				t.Errorf("errors.Is(%v, ErrBadMagic) = %v", err, !test.badMagic)
+			}
+
+			var truncated *TruncatedError
+			if errors.As(err, &truncated) != (test.truncated != nil) {
+				t.Errorf("errors.As(%v, *TruncatedError) = %v", err, test.truncated == nil)
+			} else if test.truncated != nil && *truncated != *test.truncated {
+				t.Errorf("got %+v, want %+v", *truncated, *test.truncated)
+			}
+
+			var size *InvalidSizeError
+			if errors.As(err, &size) != test.size {
+				t.Errorf("errors.As(%v, *InvalidSizeError) = %v", err, !test.size)
+			}
+
+			var mapper *UnsupportedMapperError
+			if errors.As(err, &mapper) != (test.mapper != 0) {
+				t.Errorf("errors.As(%v, *UnsupportedMapperError) = %v", err, test.mapper == 0)
+			} else if test.mapper != 0 && mapper.Mapper != test.mapper {
+				t.Errorf("unsupported mapper %d, want %d", mapper.Mapper, test.mapper)
+			}
+		})
+	}
+}
+
+func TestNewCartridgeWrapsErrors(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "short.nes")
+	if err := os.WriteFile(path, testImage(t, 0, 1, 1, nil)[:100], 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := NewCartridge(path)
+	var truncated *TruncatedError
+	if !errors.As(err, &truncated) || truncated.Section != "PRG ROM" {
+		t.Errorf("got %v, want a TruncatedError for the PRG ROM", err)
+	}
+	if err == nil || !strings.HasPrefix(err.Error(), path+": ") {
+		t.Errorf("error %v does not name the file", err)
+	}
+
+	path = filepath.Join(dir, "bad.nes")
+	if err := os.WriteFile(path, []byte("This is not a ROM image."), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewCartridge(path); !errors.Is(err, ErrBadMagic) {
+		t.Errorf("got %v, want ErrBadMagic", err)
+	}
+
+	if _, err := NewCartridge(filepath.Join(dir, "missing.nes")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got %v, want fs.ErrNotExist", err)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Button is a bit in a controller's button state, in the order the
+// controller's shift register reports them.
+type Button byte
+
+const (
+	ButtonA Button = 1 << iota
+	ButtonB
+	ButtonSelect
+	ButtonStart
+	ButtonUp
+	ButtonDown
+	ButtonLeft
+	ButtonRight
+)
+
+// buttonNames are the names used for buttons in configuration files, in
+// shift register order.
+var buttonNames = [8]string{"A", "B", "Select", "Start", "Up", "Down", "Left", "Right"}
+
+// parseButton looks up a button by its configuration file name, ignoring
+// case.
+func parseButton(name string) (Button, error) {
+	for i, n := range buttonNames {
+		if strings.EqualFold(n, name) {
+			return Button(1 << i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown button %q", name)
+}
+
+// Controller is a standard NES controller plugged into one of the ports
+// at $4016 and $4017.
+//
+// While the strobe bit written to $4016 is set, the controller keeps
+// latching the state of its buttons. Once it is cleared, each read
+// shifts out one button, A first, and after all eight the controller
+// reports pressed buttons from then on.
+type Controller struct {
+	buttons Button // Buttons currently held
+	shift   byte   // Latched state being shifted out
+	strobe  bool
+}
+
+// SetButtons sets which buttons are currently held.
+func (c *Controller) SetButtons(buttons Button) {
+	c.buttons = buttons
+}
+
+// Buttons returns the buttons currently held.
+func (c *Controller) Buttons() Button {
+	return c.buttons
+}
+
+// write handles a write to $4016, which drives the strobe line of both
+// ports.
+func (c *Controller) write(data byte) {
+	c.strobe = data&0x01 != 0
+	if c.strobe {
+		c.shift = byte(c.buttons)
+	}
+}
+
+// read shifts out the next button. Only bit 0 is driven by the
+// controller; the upper bits are open bus, which usually reads back as
+// the high byte of the register's address.
+func (c *Controller) read() byte {
+	if c.strobe {
+		// The shift register is being reloaded continuously, so A is
+		// read over and over
+		c.shift = byte(c.buttons)
+	}
+
+	data := 0x40 | c.shift&0x01
+	c.shift = c.shift>>1 | 0x80
+	return data
+}
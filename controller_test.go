@@ -0,0 +1,99 @@
+package main
+
+import "testing"
+
+func TestControllerShift(t *testing.T) {
+	tests := []struct {
+		name    string
+		buttons Button
+		strobe  bool // Leave the strobe set while reading
+		want    []byte
+	}{
+		{
+			name: "nothing held",
+			want: []byte{0x40, 0x40, 0x40, 0x40, 0x40, 0x40, 0x40, 0x40, 0x41, 0x41},
+		},
+		{
+			name:    "A, Start and Right",
+			buttons: ButtonA | ButtonStart | ButtonRight,
+			want:    []byte{0x41, 0x40, 0x40, 0x41, 0x40, 0x40, 0x40, 0x41, 0x41},
+		},
+		{
+			name:    "B, Select, Up, Down and Left",
+			buttons: ButtonB | ButtonSelect | ButtonUp | ButtonDown | ButtonLeft,
+			want:    []byte{0x40, 0x41, 0x41, 0x40, 0x41, 0x41, 0x41, 0x40, 0x41},
+		},
+		{
+			name:    "strobe held reads A repeatedly",
+			buttons: ButtonA | ButtonB,
+			strobe:  true,
+			want:    []byte{0x41, 0x41, 0x41},
+		},
+		{
+			name:    "strobe held without A",
+			buttons: ButtonB,
+			strobe:  true,
+			want:    []byte{0x40, 0x40, 0x40},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var c Controller
+			c.SetButtons(test.buttons)
+			c.write(0x01)
+			if !test.strobe {
+				c.write(0x00)
+			}
+
+			for i, want := range test.want {
+				if got := c.read(); got != want {
+					t.Errorf("read %d: got $%02X, want $%02X", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestControllerLatchesOnStrobe(t *testing.T) {
+	var c Controller
+	c.SetButtons(ButtonA)
+	c.write(0x01)
+	c.write(0x00)
+
+	// Buttons pressed after the strobe don't show until the next one
+	c.SetButtons(ButtonB)
+	if got := c.read(); got != 0x41 {
+		t.Errorf("A read $%02X, want $41", got)
+	}
+	if got := c.read(); got != 0x40 {
+		t.Errorf("B read $%02X, want $40", got)
+	}
+
+	c.write(0x01)
+	c.write(0x00)
+	c.read()
+	if got := c.read(); got != 0x41 {
+		t.Errorf("B after strobe read $%02X, want $41", got)
+	}
+}
+
+func TestParseButton(t *testing.T) {
+	tests := []struct {
+		name string
+		want Button
+		ok   bool
+	}{
+		{"A", ButtonA, true},
+		{"start", ButtonStart, true},
+		{"RIGHT", ButtonRight, true},
+		{"C", 0, false},
+	}
+
+	for _, test := range tests {
+		got, err := parseButton(test.name)
+		if (err == nil) != test.ok || got != test.want {
+			t.Errorf("parseButton(%q) = %v, %v; want %v, ok %v", test.name, got, err, test.want, test.ok)
+		}
+	}
+}
@@ -1,7 +1,5 @@
 package cpu
 
-import "fmt"
-
 // AddressingMode is an enum for addressing modes
 type AddressingMode uint8
 
@@ -56,6 +54,19 @@ func (mode AddressingMode) String() string {
 	}
 }
 
+// Length returns the length in bytes of an instruction using the
+// addressing mode, including the opcode.
+func (mode AddressingMode) Length() int {
+	switch mode {
+	case Implicit, Accumulator:
+		return 1
+	case Absolute, AbsoluteX, AbsoluteY, Indirect:
+		return 3
+	default:
+		return 2
+	}
+}
+
 // executeAddressingMode executes the given addressing mode of the CPU6502.
 //
 // mode: The addressing mode to execute.
@@ -95,31 +106,15 @@ func (c *CPU6502) executeAddressingMode(mode AddressingMode) int {
 	}
 }
 
+// GetOperandString formats the operand of an instruction in assembler
+// syntax. The operand bytes are read from the bus starting at address,
+// which is the address just past the opcode.
 func (c *CPU6502) GetOperandString(mode AddressingMode, address uint16) string {
-	switch mode {
-	case Immediate:
-		return fmt.Sprintf("#$%02X", c.bus.Read(address))
-	case ZeroPage:
-		return fmt.Sprintf("$%02X", c.bus.Read(address))
-	case ZeroPageX:
-		return fmt.Sprintf("$%02X,X", c.bus.Read(address))
-	case ZeroPageY:
-		return fmt.Sprintf("$%02X,Y", c.bus.Read(address))
-	case Absolute:
-		return fmt.Sprintf("$%04X", ((uint16(c.bus.Read(address)) << 8) | uint16(c.bus.Read(address+1))))
-	case AbsoluteX:
-		return fmt.Sprintf("$%04X,X", ((uint16(c.bus.Read(address)) << 8) | uint16(c.bus.Read(address+1))))
-	case AbsoluteY:
-		return fmt.Sprintf("$%04X,Y", ((uint16(c.bus.Read(address)) << 8) | uint16(c.bus.Read(address+1))))
-	case Indirect:
-		return fmt.Sprintf("($%04X)", ((uint16(c.bus.Read(address)) << 8) | uint16(c.bus.Read(address+1))))
-	case IndexedIndirect:
-		return fmt.Sprintf("($%02X,X)", c.bus.Read(address))
-	case IndirectIndexed:
-		return fmt.Sprintf("($%02X),Y", c.bus.Read(address))
-	default:
-		return ""
+	operand := make([]byte, mode.Length()-1)
+	for i := range operand {
+		operand[i] = c.peek(address + uint16(i))
 	}
+	return formatOperand(mode, operand, address-1)
 }
 
 // --- Addressing modes ---
@@ -194,30 +189,35 @@ func (c *CPU6502) zeroPageY() int {
 
 // relative performs a relative addressing mode operation in the CPU6502.
 //
-// It reads the value from the memory location pointed to by the program counter,
-// and stores it in the temporary variable c.temp. Then, it sets the relativeAddress
-// field of the CPU6502 struct to the value of c.temp.
+// It reads the signed 8-bit branch offset from the memory location pointed to
+// by the program counter, stores it in the temporary variable c.temp and then
+// sign-extends it into the relativeAddress field of the CPU6502 struct, so the
+// branch instructions can add it directly to the program counter.
 //
-// After that, it increments the program counter by 2 to point to the next instruction.
+// After that, it increments the program counter to point to the next instruction.
 //
 // The function does not use any extra cycles, so it returns 0.
 func (c *CPU6502) relative() int {
 	extraCyclesUsed := 0
 	c.temp = uint16(c.bus.Read(c.programCounter))
 	c.relativeAddress = c.temp
+	if c.relativeAddress&0x80 != 0 {
+		c.relativeAddress |= 0xFF00
+	}
 
-	c.programCounter += 2
+	c.programCounter++
 
 	return extraCyclesUsed
 }
 
-// absolute calculates the absolute address.
+// absolute calculates the absolute address from the little-endian operand
+// following the opcode.
 //
 // No parameters.
 // Returns 0, as it does not use any extra cycles.
 func (c *CPU6502) absolute() int {
 	extraCyclesUsed := 0
-	c.absoluteAddress = (uint16(c.bus.Read(c.programCounter)) << 8) | uint16(c.bus.Read(c.programCounter))
+	c.absoluteAddress = c.readWord(c.programCounter)
 
 	c.programCounter += 2
 
@@ -235,13 +235,13 @@ func (c *CPU6502) absolute() int {
 // Returns an integer representing the number of extra cycles used.
 func (c *CPU6502) absoluteX() int {
 	extraCyclesUsed := 0
-	c.absoluteAddress = (uint16(c.bus.Read(c.programCounter)) << 8) | uint16(c.bus.Read(c.programCounter))
-	c.absoluteAddress += uint16(c.x)
+	c.temp = c.readWord(c.programCounter)
+	c.absoluteAddress = c.temp + uint16(c.x)
 
 	c.programCounter += 2
 
 	// If page boundary is crossed, add an extra cycle
-	if (c.absoluteAddress & 0xFF00) != ((c.absoluteAddress - uint16(c.x)) & 0xFF00) {
+	if (c.absoluteAddress & 0xFF00) != (c.temp & 0xFF00) {
 		extraCyclesUsed += 1
 	}
 
@@ -256,13 +256,13 @@ func (c *CPU6502) absoluteX() int {
 // It returns an integer representing the number of extra cycles used.
 func (c *CPU6502) absoluteY() int {
 	extraCyclesUsed := 0
-	c.absoluteAddress = (uint16(c.bus.Read(c.programCounter)) << 8) | uint16(c.bus.Read(c.programCounter))
-	c.absoluteAddress += uint16(c.y)
+	c.temp = c.readWord(c.programCounter)
+	c.absoluteAddress = c.temp + uint16(c.y)
 
 	c.programCounter += 2
 
 	// If page boundary is crossed, add an extra cycle
-	if (c.absoluteAddress & 0xFF00) != ((c.absoluteAddress - uint16(c.y)) & 0xFF00) {
+	if (c.absoluteAddress & 0xFF00) != (c.temp & 0xFF00) {
 		extraCyclesUsed += 1
 	}
 
@@ -271,18 +271,19 @@ func (c *CPU6502) absoluteY() int {
 
 // indirect performs an indirect addressing mode.
 //
-// It reads the value at the memory location specified by the programCounter and combines it with the next byte to form a 16-bit address.
-// If the low byte of the resulting address is 0xFF, it fetches the high byte from the next memory location and combines it with the low byte to form the final address.
-// Otherwise, it fetches the high byte from the memory location following the next byte and combines it with the low byte to form the final address.
+// It reads the little-endian pointer at the memory location specified by the programCounter,
+// then reads the 16-bit target address stored at that pointer.
+// If the low byte of the pointer is 0xFF, the high byte of the target is fetched from the start
+// of the same page rather than from the next page.
 //
 // This simulates a bug in the original 6502.
 //
-// The programCounter is incremented by 1.
+// The programCounter is incremented by 2.
 //
 // Returns the number of extra cycles used.
 func (c *CPU6502) indirect() int {
 	extraCyclesUsed := 0
-	c.temp = (uint16(c.bus.Read(c.programCounter)) << 8) | uint16(c.bus.Read(c.programCounter))
+	c.temp = c.readWord(c.programCounter)
 
 	if c.temp&0x00FF == 0x00FF {
 		c.absoluteAddress = uint16(c.bus.Read(c.temp&0xFF00))<<8 | uint16(c.bus.Read(c.temp))
@@ -290,7 +291,7 @@ func (c *CPU6502) indirect() int {
 		c.absoluteAddress = uint16(c.bus.Read(c.temp+1))<<8 | uint16(c.bus.Read(c.temp))
 	}
 
-	c.programCounter++
+	c.programCounter += 2
 
 	return extraCyclesUsed
 }
@@ -298,13 +299,17 @@ func (c *CPU6502) indirect() int {
 // indexedIndirect calculates the absolute address by adding the value in register X to the value read from the bus at the program counter.
 //
 // This function performs an indexed indirect addressing mode operation for the CPU6502.
-// It reads the value at memory address (temp + x) and stores it in the absoluteAddress variable.
+// It reads the 16-bit pointer at zero page address (temp + x), wrapping within the zero page,
+// and stores it in the absoluteAddress variable.
 // The programCounter is then incremented.
 // The function returns the number of extra cycles used.
 func (c *CPU6502) indexedIndirect() int {
 	extraCyclesUsed := 0
 	c.temp = uint16(c.bus.Read(c.programCounter))
-	c.absoluteAddress = uint16(c.bus.Read(uint16(c.temp) + uint16(c.x)&0xFF))
+
+	lo := uint16(c.bus.Read((c.temp + uint16(c.x)) & 0xFF))
+	hi := uint16(c.bus.Read((c.temp + uint16(c.x) + 1) & 0xFF))
+	c.absoluteAddress = hi<<8 | lo
 
 	c.programCounter++
 
@@ -313,18 +318,21 @@ func (c *CPU6502) indexedIndirect() int {
 
 // indirectIndexed calculates the indirect indexed addressing mode for the CPU6502.
 //
-// It retrieves the value at the address specified by the program counter and adds the value of the
-// Y register to it. If the addition crosses a page boundary, an extra cycle is used. The function
-// returns the number of extra cycles used.
+// It retrieves the 16-bit pointer stored in the zero page at the address specified by the program
+// counter and adds the value of the Y register to it. If the addition crosses a page boundary, an
+// extra cycle is used. The function returns the number of extra cycles used.
 func (c *CPU6502) indirectIndexed() int {
 	extraCyclesUsed := 0
 	c.temp = uint16(c.bus.Read(c.programCounter))
-	c.absoluteAddress = uint16(c.bus.Read(c.temp)) + uint16(c.y)
+
+	lo := uint16(c.bus.Read(c.temp & 0xFF))
+	hi := uint16(c.bus.Read((c.temp + 1) & 0xFF))
+	c.absoluteAddress = (hi<<8 | lo) + uint16(c.y)
 
 	c.programCounter++
 
 	// If page boundary is crossed, add an extra cycle
-	if (c.absoluteAddress & 0xFF00) != ((c.absoluteAddress - uint16(c.y)) & 0xFF00) {
+	if (c.absoluteAddress & 0xFF00) != (hi << 8) {
 		extraCyclesUsed += 1
 	}
 
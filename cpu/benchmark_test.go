@@ -0,0 +1,75 @@
+package cpu
+
+import "testing"
+
+// benchBus is a flat 64KB RAM used to run the CPU in isolation.
+type benchBus [0x10000]byte
+
+func (b *benchBus) Read(addr uint16) byte {
+	return b[addr]
+}
+
+func (b *benchBus) Write(addr uint16, data byte) {
+	b[addr] = data
+}
+
+// benchProgram is a small loop mixing loads, stores, arithmetic and
+// branches, roughly in the proportions of typical game code:
+//
+//	$8000  LDX #$00
+//	$8002  LDA $0200,X
+//	$8005  CLC
+//	$8006  ADC #$01
+//	$8008  STA $0200,X
+//	$800B  INX
+//	$800C  BNE $8002
+//	$800E  JMP $8000
+var benchProgram = []byte{
+	0xA2, 0x00,
+	0xBD, 0x00, 0x02,
+	0x18,
+	0x69, 0x01,
+	0x9D, 0x00, 0x02,
+	0xE8,
+	0xD0, 0xF4,
+	0x4C, 0x00, 0x80,
+}
+
+func newBenchCPU() *CPU6502 {
+	bus := &benchBus{}
+	copy(bus[0x8000:], benchProgram)
+	bus[0xFFFC] = 0x00
+	bus[0xFFFD] = 0x80
+
+	c := New()
+	c.ConnectBus(bus)
+	c.Reset()
+	c.Step()
+	return c
+}
+
+func BenchmarkStep(b *testing.B) {
+	c := newBenchCPU()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Step()
+	}
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "instructions/s")
+}
+
+func BenchmarkClock(b *testing.B) {
+	c := newBenchCPU()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Clock()
+	}
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "cycles/s")
+}
+
+func BenchmarkDecodeInstruction(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		DecodeInstruction(byte(i))
+	}
+}
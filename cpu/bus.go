@@ -5,3 +5,10 @@ type Bus interface {
 	Read(addr uint16) byte
 	Write(addr uint16, data byte)
 }
+
+// Peeker is implemented by buses that can read memory without the side
+// effects a real read may have, such as clearing a status flag. Debugging
+// aids like the tracer use it so they never disturb the emulated hardware.
+type Peeker interface {
+	Peek(addr uint16) byte
+}
@@ -19,6 +19,21 @@ type CPU6502 struct {
 	addressingMode  AddressingMode
 	opcode          byte
 	cycles          int
+	totalCycles     uint64
+	stallCycles     int // Cycles taken from the CPU by DMA
+
+	// Interrupt lines
+	nmiLine    bool
+	nmiEdge    bool
+	nmiPending bool
+	irqLines   IRQSource
+	irqPending bool
+	irqInhibit bool // FlagI as seen by the last interrupt poll
+
+	unofficialMode UnofficialOpcodeMode
+	haltError      *HaltError // Set when the CPU has jammed or trapped
+
+	tracer *Tracer
 }
 
 const (
@@ -53,9 +68,9 @@ func (c *CPU6502) Reset() {
 	c.a = 0
 	c.x = 0
 	c.y = 0
-	c.programCounter = (uint16(c.bus.Read(0xFFFC)) << 8) | uint16(c.bus.Read(0xFFFD))
+	c.programCounter = c.readWord(resetVector)
 	c.stackPointer = 0xFD
-	c.status = 0 | FlagU
+	c.status = 0 | FlagU | FlagI
 
 	// Clear internal variables
 	c.relativeAddress = 0
@@ -65,8 +80,109 @@ func (c *CPU6502) Reset() {
 	c.addressingMode = Implicit
 	c.opcode = 0
 
-	// Reset takes 8 cycles
-	c.cycles = 8
+	// Forget interrupts requested before the reset. The lines themselves
+	// are left alone, as they belong to the devices driving them.
+	c.nmiEdge = false
+	c.nmiPending = false
+	c.irqPending = false
+	c.irqInhibit = true
+
+	// Reset is the only way out of a jam
+	c.haltError = nil
+	c.stallCycles = 0
+
+	// Reset takes 7 cycles, which are counted like any other
+	c.cycles = 7
+	c.totalCycles = 0
+}
+
+// Clock performs a single clock cycle of emulation.
+//
+// The whole instruction is executed on the first cycle it occupies, after
+// which Clock just counts down the cycles the instruction would take on
+// real hardware. This keeps the CPU in step with the other chips on the
+// bus without emulating each bus access at the cycle it happens.
+func (c *CPU6502) Clock() {
+	if c.haltError != nil {
+		// A halted CPU lets time pass but does nothing else
+		c.cycles = 0
+		c.totalCycles++
+		return
+	}
+
+	if c.cycles == 0 && c.stallCycles > 0 {
+		// Another device has the bus, so the next instruction waits
+		c.stallCycles--
+		c.totalCycles++
+		return
+	}
+
+	if c.cycles == 0 && !c.serviceInterrupts() {
+		if c.tracer != nil {
+			c.tracer.Trace(c)
+		}
+
+		c.opcode = c.bus.Read(c.programCounter)
+		c.SetFlag(FlagU, true)
+		c.programCounter++
+
+		if c.unofficialMode == UnofficialTrap && IsUnofficial(c.opcode) {
+			c.halt(false)
+			c.totalCycles++
+			return
+		}
+
+		info := DecodeInstruction(c.opcode)
+		c.cycles = int(info.Cycles)
+
+		// An extra cycle is only taken when the addressing mode crossed a
+		// page boundary and the instruction is one that cares about it.
+		extraAddressingCycles := c.executeAddressingMode(info.Mode)
+		inhibit := c.GetFlag(FlagI)
+		extraInstructionCycles := info.Execute(c)
+		c.cycles += extraAddressingCycles & extraInstructionCycles
+
+		// CLI, SEI and PLP change FlagI after the interrupt poll, so the
+		// new value only takes effect after the next instruction.
+		switch info.Instruction {
+		case CLI, SEI, PLP:
+		default:
+			inhibit = c.GetFlag(FlagI)
+		}
+		c.irqInhibit = inhibit
+
+		c.SetFlag(FlagU, true)
+	}
+
+	if c.cycles == 1 {
+		c.pollInterrupts()
+	}
+
+	c.cycles--
+	c.totalCycles++
+}
+
+// Step clocks the CPU until the current instruction has completed.
+//
+// If the CPU is between instructions, the next instruction is fetched and
+// executed, or a pending interrupt sequence is started in its place.
+// Otherwise the remaining cycles of the instruction in flight (or of the
+// reset sequence, or of a stall) are consumed.
+//
+// Returns the number of cycles consumed.
+func (c *CPU6502) Step() int {
+	start := c.totalCycles
+	c.Clock()
+	for !c.Complete() {
+		c.Clock()
+	}
+	return int(c.totalCycles - start)
+}
+
+// Complete reports whether the CPU has finished the current instruction and
+// will fetch a new opcode on the next clock.
+func (c *CPU6502) Complete() bool {
+	return c.cycles == 0 && c.stallCycles == 0
 }
 
 // SetFlag sets or clears a flag in the CPU6502 status register.
@@ -158,6 +274,97 @@ func (c *CPU6502) GetCycles() int {
 	return c.cycles
 }
 
+// SetUnofficialOpcodeMode selects how unofficial opcodes are handled.
+//
+// The default, UnofficialExecute, runs them like the real hardware.
+func (c *CPU6502) SetUnofficialOpcodeMode(mode UnofficialOpcodeMode) {
+	c.unofficialMode = mode
+}
+
+// SetTracer installs a tracer that is called before every instruction.
+// Passing nil disables tracing.
+func (c *CPU6502) SetTracer(tracer *Tracer) {
+	c.tracer = tracer
+}
+
+// Halted reports whether the CPU has stopped executing instructions, either
+// because it ran a KIL opcode or because it trapped on an unofficial opcode.
+func (c *CPU6502) Halted() bool {
+	return c.haltError != nil
+}
+
+// HaltReason returns a *HaltError describing why the CPU halted, or nil if
+// it is running.
+func (c *CPU6502) HaltReason() error {
+	if c.haltError == nil {
+		return nil
+	}
+	return c.haltError
+}
+
+// Stall suspends the CPU for the given number of cycles once the current
+// instruction completes, as happens while a DMA unit owns the bus.
+func (c *CPU6502) Stall(cycles int) {
+	c.stallCycles += cycles
+}
+
+// GetTotalCycles returns the number of cycles the CPU has been clocked
+// since the last reset.
+func (c *CPU6502) GetTotalCycles() uint64 {
+	return c.totalCycles
+}
+
+// fetch returns the operand of the current instruction.
+//
+// In accumulator mode the operand is the accumulator itself, and in implicit
+// mode there is no operand to read. Otherwise the data at the effective
+// address is read from the bus.
+func (c *CPU6502) fetch() byte {
+	switch c.addressingMode {
+	case Implicit:
+	case Accumulator:
+		c.fetched = c.a
+	default:
+		c.fetched = c.bus.Read(c.absoluteAddress)
+	}
+	return c.fetched
+}
+
+// peek reads a byte for debugging purposes, avoiding read side effects
+// if the bus supports it.
+func (c *CPU6502) peek(addr uint16) byte {
+	if peeker, ok := c.bus.(Peeker); ok {
+		return peeker.Peek(addr)
+	}
+	return c.bus.Read(addr)
+}
+
+// readWord reads a little-endian 16-bit value from the bus.
+func (c *CPU6502) readWord(addr uint16) uint16 {
+	lo := uint16(c.bus.Read(addr))
+	hi := uint16(c.bus.Read(addr + 1))
+	return hi<<8 | lo
+}
+
+// push writes a byte to the stack, which lives in page $01, and
+// decrements the stack pointer.
+func (c *CPU6502) push(data byte) {
+	c.bus.Write(0x0100|uint16(c.stackPointer), data)
+	c.stackPointer--
+}
+
+// pull increments the stack pointer and reads a byte from the stack.
+func (c *CPU6502) pull() byte {
+	c.stackPointer++
+	return c.bus.Read(0x0100 | uint16(c.stackPointer))
+}
+
+// setZN sets FlagZ and FlagN according to value.
+func (c *CPU6502) setZN(value byte) {
+	c.SetFlag(FlagZ, value == 0)
+	c.SetFlag(FlagN, value&0x80 != 0)
+}
+
 // String returns a string representation of the CPU6502.
 func (c *CPU6502) String() string {
 	return fmt.Sprintf("A: 0x%02X X: 0x%02X Y: 0x%02X P: 0x%02X SP: 0x%02X, PC: 0x%04X",
@@ -0,0 +1,136 @@
+package cpu
+
+import "testing"
+
+// Where newTestCPU puts the program and the interrupt handlers
+const (
+	testProgram    = 0x8000
+	testIRQHandler = 0x9000
+	testNMIHandler = 0xA000
+)
+
+// newTestCPU returns a CPU on a flat 64K bus of RAM, just reset, with
+// program at $8000 and handlers of NOPs at $9000 (IRQ) and $A000 (NMI).
+func newTestCPU(program ...byte) (*CPU6502, *benchBus) {
+	bus := &benchBus{}
+	copy(bus[testProgram:], program)
+	for i := 0; i < 0x10; i++ {
+		bus[testIRQHandler+i] = 0xEA
+		bus[testNMIHandler+i] = 0xEA
+	}
+	bus[0xFFFA], bus[0xFFFB] = 0x00, 0xA0
+	bus[0xFFFC], bus[0xFFFD] = 0x00, 0x80
+	bus[0xFFFE], bus[0xFFFF] = 0x00, 0x90
+
+	c := New()
+	c.ConnectBus(bus)
+	c.Reset()
+	return c, bus
+}
+
+func TestReset(t *testing.T) {
+	c, _ := newTestCPU()
+	if cycles := c.Step(); cycles != 7 {
+		t.Errorf("reset took %d cycles, want 7", cycles)
+	}
+	if c.GetPC() != testProgram {
+		t.Errorf("PC = $%04X, want $%04X", c.GetPC(), testProgram)
+	}
+	if sp := c.GetRegister(RegSP); sp != 0xFD {
+		t.Errorf("SP = $%02X, want $FD", sp)
+	}
+	if !c.GetFlag(FlagI) {
+		t.Error("FlagI clear after reset")
+	}
+}
+
+func TestStepCycles(t *testing.T) {
+	tests := []struct {
+		name    string
+		program []byte
+		setup   func(c *CPU6502)
+		cycles  int
+		pc      uint16 // PC afterwards
+	}{
+		{name: "NOP", program: []byte{0xEA}, cycles: 2, pc: 0x8001},
+		{name: "LDA immediate", program: []byte{0xA9, 0x01}, cycles: 2, pc: 0x8002},
+		{name: "LDA absolute", program: []byte{0xAD, 0x00, 0x02}, cycles: 4, pc: 0x8003},
+		{
+			name: "LDA absolute,X", program: []byte{0xBD, 0x00, 0x02},
+			setup:  func(c *CPU6502) { c.SetRegister(RegX, 0x01) },
+			cycles: 4, pc: 0x8003,
+		},
+		{
+			name: "LDA absolute,X across a page", program: []byte{0xBD, 0xFF, 0x02},
+			setup:  func(c *CPU6502) { c.SetRegister(RegX, 0x01) },
+			cycles: 5, pc: 0x8003,
+		},
+		{
+			name: "STA absolute,X across a page takes no extra cycle", program: []byte{0x9D, 0xFF, 0x02},
+			setup:  func(c *CPU6502) { c.SetRegister(RegX, 0x01) },
+			cycles: 5, pc: 0x8003,
+		},
+		{
+			name: "LDA (indirect),Y across a page", program: []byte{0xB1, 0x10},
+			setup: func(c *CPU6502) {
+				c.bus.Write(0x0010, 0xFF)
+				c.bus.Write(0x0011, 0x02)
+				c.SetRegister(RegY, 0x01)
+			},
+			cycles: 6, pc: 0x8002,
+		},
+		{
+			name: "branch not taken", program: []byte{0xD0, 0x10},
+			setup:  func(c *CPU6502) { c.SetFlag(FlagZ, true) },
+			cycles: 2, pc: 0x8002,
+		},
+		{
+			name: "branch taken", program: []byte{0xD0, 0x10},
+			setup:  func(c *CPU6502) { c.SetFlag(FlagZ, false) },
+			cycles: 3, pc: 0x8012,
+		},
+		{
+			name: "branch taken across a page", program: []byte{0xD0, 0xFC},
+			setup:  func(c *CPU6502) { c.SetFlag(FlagZ, false) },
+			cycles: 4, pc: 0x7FFE,
+		},
+		{name: "JSR", program: []byte{0x20, 0x34, 0x12}, cycles: 6, pc: 0x1234},
+		{name: "BRK", program: []byte{0x00}, cycles: 7, pc: testIRQHandler},
+		{name: "INC absolute,X", program: []byte{0xFE, 0x00, 0x02}, cycles: 7, pc: 0x8003},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, _ := newTestCPU(test.program...)
+			c.Step()
+			if test.setup != nil {
+				test.setup(c)
+			}
+
+			before := c.GetTotalCycles()
+			if cycles := c.Step(); cycles != test.cycles {
+				t.Errorf("took %d cycles, want %d", cycles, test.cycles)
+			}
+			if total := c.GetTotalCycles() - before; total != uint64(test.cycles) {
+				t.Errorf("total cycles grew by %d, want %d", total, test.cycles)
+			}
+			if c.GetPC() != test.pc {
+				t.Errorf("PC = $%04X, want $%04X", c.GetPC(), test.pc)
+			}
+		})
+	}
+}
+
+func TestStall(t *testing.T) {
+	c, _ := newTestCPU(0xEA)
+	c.Step()
+
+	// The stall runs before the next instruction
+	c.Stall(3)
+	if cycles := c.Step(); cycles != 3 || c.GetPC() != testProgram {
+		t.Errorf("stall took %d cycles and left PC at $%04X, want 3 and $%04X", cycles, c.GetPC(), testProgram)
+	}
+	if cycles := c.Step(); cycles != 2 || c.GetPC() != testProgram+1 {
+		t.Errorf("NOP took %d cycles and left PC at $%04X, want 2 and $%04X", cycles, c.GetPC(), testProgram+1)
+	}
+}
@@ -0,0 +1,158 @@
+package cpu
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DisassembledInstruction is a single instruction decoded from memory.
+type DisassembledInstruction struct {
+	Address     uint16
+	Bytes       []byte
+	Instruction Instruction
+	Mnemonic    string
+	Operand     string
+	Mode        AddressingMode
+	Unofficial  bool
+
+	// Target is the address the operand refers to: the destination of a
+	// branch or jump, the unindexed base of a memory operand, or the
+	// pointer of an indirect one. HasTarget is false for instructions
+	// without an address operand.
+	Target    uint16
+	HasTarget bool
+}
+
+// String formats the instruction as a listing line.
+func (d DisassembledInstruction) String() string {
+	raw := make([]string, len(d.Bytes))
+	for i, b := range d.Bytes {
+		raw[i] = fmt.Sprintf("%02X", b)
+	}
+
+	text := d.Mnemonic
+	if d.Operand != "" {
+		text += " " + d.Operand
+	}
+	return fmt.Sprintf("%04X  %-8s  %s", d.Address, strings.Join(raw, " "), text)
+}
+
+// Disassemble decodes code as a linear sequence of instructions, the first
+// of which is located at base.
+//
+// Disassembly does not follow control flow, so data mixed in with the code
+// is decoded as instructions too. An instruction cut short by the end of
+// code is returned as a .byte directive.
+func Disassemble(code []byte, base uint16) []DisassembledInstruction {
+	var instructions []DisassembledInstruction
+	for offset := 0; offset < len(code); {
+		instruction := DisassembleInstruction(code[offset:], base+uint16(offset))
+		instructions = append(instructions, instruction)
+		offset += len(instruction.Bytes)
+	}
+	return instructions
+}
+
+// DisassembleInstruction decodes the instruction at the start of code,
+// which is located at addr.
+func DisassembleInstruction(code []byte, addr uint16) DisassembledInstruction {
+	if len(code) == 0 {
+		return DisassembledInstruction{Address: addr}
+	}
+
+	info := DecodeInstruction(code[0])
+	length := info.Mode.Length()
+	if length > len(code) {
+		return dataDirective(code, addr)
+	}
+
+	instruction := DisassembledInstruction{
+		Address:     addr,
+		Bytes:       code[:length],
+		Instruction: info.Instruction,
+		Mnemonic:    InstructionNames[info.Instruction],
+		Operand:     formatOperand(info.Mode, code[1:length], addr),
+		Mode:        info.Mode,
+		Unofficial:  IsUnofficial(code[0]),
+	}
+	instruction.Target, instruction.HasTarget = operandTarget(info.Mode, code[1:length], addr)
+	return instruction
+}
+
+// dataDirective wraps bytes that do not form a whole instruction.
+func dataDirective(code []byte, addr uint16) DisassembledInstruction {
+	values := make([]string, len(code))
+	for i, b := range code {
+		values[i] = fmt.Sprintf("$%02X", b)
+	}
+	return DisassembledInstruction{
+		Address:  addr,
+		Bytes:    code,
+		Mnemonic: ".byte",
+		Operand:  strings.Join(values, ","),
+	}
+}
+
+// formatOperand formats the operand bytes of the instruction at addr in
+// assembler syntax.
+func formatOperand(mode AddressingMode, operand []byte, addr uint16) string {
+	var op8 byte
+	var op16 uint16
+	if len(operand) > 0 {
+		op8 = operand[0]
+		op16 = uint16(op8)
+	}
+	if len(operand) > 1 {
+		op16 |= uint16(operand[1]) << 8
+	}
+
+	switch mode {
+	case Accumulator:
+		return "A"
+	case Immediate:
+		return fmt.Sprintf("#$%02X", op8)
+	case ZeroPage:
+		return fmt.Sprintf("$%02X", op8)
+	case ZeroPageX:
+		return fmt.Sprintf("$%02X,X", op8)
+	case ZeroPageY:
+		return fmt.Sprintf("$%02X,Y", op8)
+	case Relative:
+		return fmt.Sprintf("$%04X", branchTarget(op8, addr))
+	case Absolute:
+		return fmt.Sprintf("$%04X", op16)
+	case AbsoluteX:
+		return fmt.Sprintf("$%04X,X", op16)
+	case AbsoluteY:
+		return fmt.Sprintf("$%04X,Y", op16)
+	case Indirect:
+		return fmt.Sprintf("($%04X)", op16)
+	case IndexedIndirect:
+		return fmt.Sprintf("($%02X,X)", op8)
+	case IndirectIndexed:
+		return fmt.Sprintf("($%02X),Y", op8)
+	default:
+		return ""
+	}
+}
+
+// operandTarget returns the address the operand bytes of the instruction
+// at addr refer to, if any.
+func operandTarget(mode AddressingMode, operand []byte, addr uint16) (uint16, bool) {
+	switch mode {
+	case Relative:
+		return branchTarget(operand[0], addr), true
+	case ZeroPage, ZeroPageX, ZeroPageY, IndexedIndirect, IndirectIndexed:
+		return uint16(operand[0]), true
+	case Absolute, AbsoluteX, AbsoluteY, Indirect:
+		return uint16(operand[1])<<8 | uint16(operand[0]), true
+	default:
+		return 0, false
+	}
+}
+
+// branchTarget resolves a relative branch offset for the two byte branch
+// instruction at addr.
+func branchTarget(offset byte, addr uint16) uint16 {
+	return addr + 2 + uint16(int8(offset))
+}
@@ -0,0 +1,71 @@
+package cpu
+
+import "testing"
+
+func TestDisassembleInstruction(t *testing.T) {
+	tests := []struct {
+		name      string
+		code      []byte
+		want      string
+		mode      AddressingMode
+		target    uint16
+		hasTarget bool
+	}{
+		{"implied", []byte{0xEA}, "8000  EA        NOP", Implicit, 0, false},
+		{"accumulator", []byte{0x0A}, "8000  0A        ASL A", Accumulator, 0, false},
+		{"immediate", []byte{0xA9, 0x44}, "8000  A9 44     LDA #$44", Immediate, 0, false},
+		{"zero page", []byte{0xA5, 0x10}, "8000  A5 10     LDA $10", ZeroPage, 0x0010, true},
+		{"zero page,X", []byte{0xB5, 0x10}, "8000  B5 10     LDA $10,X", ZeroPageX, 0x0010, true},
+		{"zero page,Y", []byte{0xB6, 0x10}, "8000  B6 10     LDX $10,Y", ZeroPageY, 0x0010, true},
+		{"absolute", []byte{0xAD, 0x34, 0x12}, "8000  AD 34 12  LDA $1234", Absolute, 0x1234, true},
+		{"absolute,X", []byte{0xBD, 0x34, 0x12}, "8000  BD 34 12  LDA $1234,X", AbsoluteX, 0x1234, true},
+		{"absolute,Y", []byte{0xB9, 0x34, 0x12}, "8000  B9 34 12  LDA $1234,Y", AbsoluteY, 0x1234, true},
+		{"indirect", []byte{0x6C, 0xFF, 0x02}, "8000  6C FF 02  JMP ($02FF)", Indirect, 0x02FF, true},
+		{"indexed indirect", []byte{0xA1, 0x20}, "8000  A1 20     LDA ($20,X)", IndexedIndirect, 0x0020, true},
+		{"indirect indexed", []byte{0xB1, 0x20}, "8000  B1 20     LDA ($20),Y", IndirectIndexed, 0x0020, true},
+		{"branch forward", []byte{0xD0, 0x10}, "8000  D0 10     BNE $8012", Relative, 0x8012, true},
+		{"branch backward", []byte{0xD0, 0xFE}, "8000  D0 FE     BNE $8000", Relative, 0x8000, true},
+		{"branch to the previous page", []byte{0xF0, 0x80}, "8000  F0 80     BEQ $7F82", Relative, 0x7F82, true},
+		{"unofficial", []byte{0xA7, 0x10}, "8000  A7 10     LAX $10", ZeroPage, 0x0010, true},
+		{"trailing bytes are ignored", []byte{0xEA, 0xA9, 0x01}, "8000  EA        NOP", Implicit, 0, false},
+		{"truncated", []byte{0xAD, 0x34}, "8000  AD 34     .byte $AD,$34", Implicit, 0, false},
+		{"truncated branch", []byte{0xD0}, "8000  D0        .byte $D0", Implicit, 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := DisassembleInstruction(test.code, 0x8000)
+			if got.String() != test.want {
+				t.Errorf("String() = %q, want %q", got.String(), test.want)
+			}
+			if got.Mode != test.mode {
+				t.Errorf("Mode = %v, want %v", got.Mode, test.mode)
+			}
+			if got.Target != test.target || got.HasTarget != test.hasTarget {
+				t.Errorf("Target = $%04X, %v, want $%04X, %v", got.Target, got.HasTarget, test.target, test.hasTarget)
+			}
+		})
+	}
+}
+
+func TestDisassemble(t *testing.T) {
+	// LDX #$00; INX; BNE back to INX; STA $1234,X; then half an instruction
+	code := []byte{0xA2, 0x00, 0xE8, 0xD0, 0xFD, 0x9D, 0x34, 0x12, 0x4C, 0x00}
+	want := []string{
+		"C000  A2 00     LDX #$00",
+		"C002  E8        INX",
+		"C003  D0 FD     BNE $C002",
+		"C005  9D 34 12  STA $1234,X",
+		"C008  4C 00     .byte $4C,$00",
+	}
+
+	got := Disassemble(code, 0xC000)
+	if len(got) != len(want) {
+		t.Fatalf("got %d instructions, want %d: %v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i].String() != want[i] {
+			t.Errorf("instruction %d = %q, want %q", i, got[i].String(), want[i])
+		}
+	}
+}
@@ -63,6 +63,29 @@ const (
 	TYA
 )
 
+// Unofficial instructions
+const (
+	AHX Instruction = iota + TYA + 1
+	ALR
+	ANC
+	ARR
+	AXS
+	DCP
+	ISC
+	KIL
+	LAS
+	LAX
+	RLA
+	RRA
+	SAX
+	SHX
+	SHY
+	SLO
+	SRE
+	TAS
+	XAA
+)
+
 // InstructionNames is a map of instruction names
 var InstructionNames = map[Instruction]string{
 	ADC: "ADC",
@@ -121,6 +144,26 @@ var InstructionNames = map[Instruction]string{
 	TXA: "TXA",
 	TXS: "TXS",
 	TYA: "TYA",
+
+	AHX: "AHX",
+	ALR: "ALR",
+	ANC: "ANC",
+	ARR: "ARR",
+	AXS: "AXS",
+	DCP: "DCP",
+	ISC: "ISC",
+	KIL: "KIL",
+	LAS: "LAS",
+	LAX: "LAX",
+	RLA: "RLA",
+	RRA: "RRA",
+	SAX: "SAX",
+	SHX: "SHX",
+	SHY: "SHY",
+	SLO: "SLO",
+	SRE: "SRE",
+	TAS: "TAS",
+	XAA: "XAA",
 }
 
 // InstructionInfo contains information about an instruction
@@ -132,7 +175,13 @@ type InstructionInfo struct {
 	Execute     func(*CPU6502) int
 }
 
-var InstructionTable = map[uint8]InstructionInfo{
+// InstructionTable is the dispatch table indexed by opcode.
+//
+// It is a dense array rather than a map because decoding sits on the
+// hottest path of the emulator. The official opcodes are listed here; the
+// unofficial ones are merged in from UnofficialInstructionTable at start
+// up, so every one of the 256 slots is populated.
+var InstructionTable = [256]InstructionInfo{
 	0x69: {ADC, 0x69, Immediate, 2, (*CPU6502).adc},
 	0x65: {ADC, 0x65, ZeroPage, 3, (*CPU6502).adc},
 	0x75: {ADC, 0x75, ZeroPageX, 4, (*CPU6502).adc},
@@ -286,292 +335,494 @@ var InstructionTable = map[uint8]InstructionInfo{
 	0x98: {TYA, 0x98, Implicit, 2, (*CPU6502).tya},
 }
 
+func init() {
+	for opcode := range InstructionTable {
+		if InstructionTable[opcode].Execute != nil {
+			continue
+		}
+		if UnofficialInstructionTable[opcode].Execute != nil {
+			InstructionTable[opcode] = UnofficialInstructionTable[opcode]
+			continue
+		}
+		// Anything left over halts the CPU instead of dispatching to nil
+		InstructionTable[opcode] = InstructionInfo{Opcode: uint8(opcode), Mode: Implicit, Cycles: 2, Execute: (*CPU6502).xxx}
+	}
+}
+
+// DecodeInstruction returns the table entry for opcode.
 func DecodeInstruction(opcode byte) InstructionInfo {
 	return InstructionTable[opcode]
 }
 
 // Placeholder for illegal instruction
 func (c *CPU6502) xxx() int {
-	// Panic
-	panic("illegal or unimplemented instruction: " + string(c.opcode))
+	// Halt rather than bring down the whole process
+	c.halt(false)
+	return 0
 }
 
+// --- Instructions ---
+// Instruction functions carry out the operation of an opcode once its
+// addressing mode has resolved the effective address. Functions return 1
+// if the instruction can take an extra cycle when its addressing mode
+// crossed a page boundary, and 0 otherwise.
+
+// adc adds the fetched value and the carry flag to the accumulator.
+//
+// The 2A03 has no decimal mode, so FlagD is ignored. Overflow is set when
+// both operands share a sign that differs from the sign of the result.
 func (c *CPU6502) adc() int {
-	// Unimplemented
-	return c.xxx()
+	c.addWithCarry(c.fetch())
+	return 1
 }
 
+// and performs a bitwise AND between the accumulator and the fetched value.
 func (c *CPU6502) and() int {
-	// Unimplemented
-	return c.xxx()
+	c.a &= c.fetch()
+	c.setZN(c.a)
+	return 1
 }
 
+// asl shifts the fetched value left by one bit, moving bit 7 into the carry.
 func (c *CPU6502) asl() int {
-	// Unimplemented
-	return c.xxx()
+	value := c.fetch()
+	c.SetFlag(FlagC, value&0x80 != 0)
+	c.writeBack(value << 1)
+	return 0
 }
 
+// bcc branches if the carry flag is clear.
 func (c *CPU6502) bcc() int {
-	// Unimplemented
-	return c.xxx()
+	c.branch(!c.GetFlag(FlagC))
+	return 0
 }
 
+// bcs branches if the carry flag is set.
 func (c *CPU6502) bcs() int {
-	// Unimplemented
-	return c.xxx()
+	c.branch(c.GetFlag(FlagC))
+	return 0
 }
 
+// beq branches if the zero flag is set.
 func (c *CPU6502) beq() int {
-	// Unimplemented
-	return c.xxx()
+	c.branch(c.GetFlag(FlagZ))
+	return 0
 }
 
+// bit tests the accumulator against the fetched value.
+//
+// Bits 7 and 6 of the fetched value are copied into FlagN and FlagV, and
+// FlagZ is set if the AND of the two values is zero.
 func (c *CPU6502) bit() int {
-	// Unimplemented
-	return c.xxx()
+	value := c.fetch()
+	c.SetFlag(FlagZ, c.a&value == 0)
+	c.SetFlag(FlagN, value&0x80 != 0)
+	c.SetFlag(FlagV, value&0x40 != 0)
+	return 0
 }
 
+// bmi branches if the negative flag is set.
 func (c *CPU6502) bmi() int {
-	// Unimplemented
-	return c.xxx()
+	c.branch(c.GetFlag(FlagN))
+	return 0
 }
 
+// bne branches if the zero flag is clear.
 func (c *CPU6502) bne() int {
-	// Unimplemented
-	return c.xxx()
+	c.branch(!c.GetFlag(FlagZ))
+	return 0
 }
 
+// bpl branches if the negative flag is clear.
 func (c *CPU6502) bpl() int {
-	// Unimplemented
-	return c.xxx()
+	c.branch(!c.GetFlag(FlagN))
+	return 0
 }
 
+// brk forces a software interrupt through the IRQ/BRK vector at $FFFE.
+//
+// The byte following the opcode is skipped, so the pushed return address
+// points two bytes past the BRK. The status register is pushed with
+// FlagB and FlagU set.
 func (c *CPU6502) brk() int {
-	// Unimplemented
-	return c.xxx()
+	c.programCounter++
+	c.interrupt(irqVector, true)
+	return 0
 }
 
+// bvc branches if the overflow flag is clear.
 func (c *CPU6502) bvc() int {
-	// Unimplemented
-	return c.xxx()
+	c.branch(!c.GetFlag(FlagV))
+	return 0
 }
 
+// bvs branches if the overflow flag is set.
 func (c *CPU6502) bvs() int {
-	// Unimplemented
-	return c.xxx()
+	c.branch(c.GetFlag(FlagV))
+	return 0
 }
 
+// clc clears the carry flag.
 func (c *CPU6502) clc() int {
-	// Unimplemented
-	return c.xxx()
+	c.SetFlag(FlagC, false)
+	return 0
 }
 
+// cld clears the decimal flag.
 func (c *CPU6502) cld() int {
-	// Unimplemented
-	return c.xxx()
+	c.SetFlag(FlagD, false)
+	return 0
 }
 
+// cli clears the interrupt disable flag.
 func (c *CPU6502) cli() int {
-	// Unimplemented
-	return c.xxx()
+	c.SetFlag(FlagI, false)
+	return 0
 }
 
+// clv clears the overflow flag.
 func (c *CPU6502) clv() int {
-	// Unimplemented
-	return c.xxx()
+	c.SetFlag(FlagV, false)
+	return 0
 }
 
+// cmp compares the accumulator with the fetched value.
 func (c *CPU6502) cmp() int {
-	// Unimplemented
-	return c.xxx()
+	c.compare(c.a, c.fetch())
+	return 1
 }
 
+// cpx compares the X register with the fetched value.
 func (c *CPU6502) cpx() int {
-	// Unimplemented
-	return c.xxx()
+	c.compare(c.x, c.fetch())
+	return 0
 }
 
+// cpy compares the Y register with the fetched value.
 func (c *CPU6502) cpy() int {
-	// Unimplemented
-	return c.xxx()
+	c.compare(c.y, c.fetch())
+	return 0
 }
 
+// dec decrements the value at the effective address.
 func (c *CPU6502) dec() int {
-	// Unimplemented
-	return c.xxx()
+	value := c.fetch() - 1
+	c.bus.Write(c.absoluteAddress, value)
+	c.setZN(value)
+	return 0
 }
 
+// dex decrements the X register.
 func (c *CPU6502) dex() int {
-	// Unimplemented
-	return c.xxx()
+	c.x--
+	c.setZN(c.x)
+	return 0
 }
 
+// dey decrements the Y register.
 func (c *CPU6502) dey() int {
-	// Unimplemented
-	return c.xxx()
+	c.y--
+	c.setZN(c.y)
+	return 0
 }
 
+// eor performs a bitwise exclusive OR between the accumulator and the fetched value.
 func (c *CPU6502) eor() int {
-	// Unimplemented
-	return c.xxx()
+	c.a ^= c.fetch()
+	c.setZN(c.a)
+	return 1
 }
 
+// inc increments the value at the effective address.
 func (c *CPU6502) inc() int {
-	// Unimplemented
-	return c.xxx()
+	value := c.fetch() + 1
+	c.bus.Write(c.absoluteAddress, value)
+	c.setZN(value)
+	return 0
 }
 
+// inx increments the X register.
 func (c *CPU6502) inx() int {
-	// Unimplemented
-	return c.xxx()
+	c.x++
+	c.setZN(c.x)
+	return 0
 }
 
+// iny increments the Y register.
 func (c *CPU6502) iny() int {
-	// Unimplemented
-	return c.xxx()
+	c.y++
+	c.setZN(c.y)
+	return 0
 }
 
+// jmp sets the program counter to the effective address.
 func (c *CPU6502) jmp() int {
-	// Unimplemented
-	return c.xxx()
+	c.programCounter = c.absoluteAddress
+	return 0
 }
 
+// jsr pushes the address of the last byte of the instruction and jumps
+// to the effective address.
 func (c *CPU6502) jsr() int {
-	// Unimplemented
-	return c.xxx()
+	c.programCounter--
+
+	c.push(byte(c.programCounter >> 8))
+	c.push(byte(c.programCounter))
+
+	c.programCounter = c.absoluteAddress
+	return 0
 }
 
+// lda loads the fetched value into the accumulator.
 func (c *CPU6502) lda() int {
-	// Unimplemented
-	return c.xxx()
+	c.a = c.fetch()
+	c.setZN(c.a)
+	return 1
 }
 
+// ldx loads the fetched value into the X register.
 func (c *CPU6502) ldx() int {
-	// Unimplemented
-	return c.xxx()
+	c.x = c.fetch()
+	c.setZN(c.x)
+	return 1
 }
 
+// ldy loads the fetched value into the Y register.
 func (c *CPU6502) ldy() int {
-	// Unimplemented
-	return c.xxx()
+	c.y = c.fetch()
+	c.setZN(c.y)
+	return 1
 }
 
+// lsr shifts the fetched value right by one bit, moving bit 0 into the carry.
 func (c *CPU6502) lsr() int {
-	// Unimplemented
-	return c.xxx()
+	value := c.fetch()
+	c.SetFlag(FlagC, value&0x01 != 0)
+	c.writeBack(value >> 1)
+	return 0
 }
 
+// nop does nothing.
 func (c *CPU6502) nop() int {
-	// Unimplemented
-	return c.xxx()
+	return 0
 }
 
+// ora performs a bitwise OR between the accumulator and the fetched value.
 func (c *CPU6502) ora() int {
-	// Unimplemented
-	return c.xxx()
+	c.a |= c.fetch()
+	c.setZN(c.a)
+	return 1
 }
 
+// pha pushes the accumulator onto the stack.
 func (c *CPU6502) pha() int {
-	// Unimplemented
-	return c.xxx()
+	c.push(c.a)
+	return 0
 }
 
+// php pushes the status register onto the stack with FlagB and FlagU set.
 func (c *CPU6502) php() int {
-	// Unimplemented
-	return c.xxx()
+	c.push(c.status | FlagB | FlagU)
+	return 0
 }
 
+// pla pulls the accumulator from the stack.
 func (c *CPU6502) pla() int {
-	// Unimplemented
-	return c.xxx()
+	c.a = c.pull()
+	c.setZN(c.a)
+	return 0
 }
 
+// plp pulls the status register from the stack.
+//
+// FlagB does not exist as a physical bit in the register, so it is
+// discarded, and FlagU always reads back as set.
 func (c *CPU6502) plp() int {
-	// Unimplemented
-	return c.xxx()
+	c.status = (c.pull() &^ FlagB) | FlagU
+	return 0
 }
 
+// rol rotates the fetched value left through the carry flag.
 func (c *CPU6502) rol() int {
-	// Unimplemented
-	return c.xxx()
+	value := c.fetch()
+	result := value << 1
+	if c.GetFlag(FlagC) {
+		result |= 0x01
+	}
+	c.SetFlag(FlagC, value&0x80 != 0)
+	c.writeBack(result)
+	return 0
 }
 
+// ror rotates the fetched value right through the carry flag.
 func (c *CPU6502) ror() int {
-	// Unimplemented
-	return c.xxx()
-}
-
+	value := c.fetch()
+	result := value >> 1
+	if c.GetFlag(FlagC) {
+		result |= 0x80
+	}
+	c.SetFlag(FlagC, value&0x01 != 0)
+	c.writeBack(result)
+	return 0
+}
+
+// rti returns from an interrupt by pulling the status register and then
+// the program counter from the stack.
 func (c *CPU6502) rti() int {
-	// Unimplemented
-	return c.xxx()
+	c.status = (c.pull() &^ FlagB) | FlagU
+
+	lo := uint16(c.pull())
+	hi := uint16(c.pull())
+	c.programCounter = hi<<8 | lo
+	return 0
 }
 
+// rts returns from a subroutine by pulling the program counter from the
+// stack and incrementing it past the JSR.
 func (c *CPU6502) rts() int {
-	// Unimplemented
-	return c.xxx()
+	lo := uint16(c.pull())
+	hi := uint16(c.pull())
+	c.programCounter = (hi<<8 | lo) + 1
+	return 0
 }
 
+// sbc subtracts the fetched value and the borrow (inverted carry) from
+// the accumulator.
+//
+// Subtraction is addition of the one's complement of the operand, so the
+// flags follow directly from adc.
 func (c *CPU6502) sbc() int {
-	// Unimplemented
-	return c.xxx()
+	c.addWithCarry(c.fetch() ^ 0xFF)
+	return 1
 }
 
+// sec sets the carry flag.
 func (c *CPU6502) sec() int {
-	// Unimplemented
-	return c.xxx()
+	c.SetFlag(FlagC, true)
+	return 0
 }
 
+// sed sets the decimal flag. The 2A03 ignores it, but it is still stored.
 func (c *CPU6502) sed() int {
-	// Unimplemented
-	return c.xxx()
+	c.SetFlag(FlagD, true)
+	return 0
 }
 
+// sei sets the interrupt disable flag.
 func (c *CPU6502) sei() int {
-	// Unimplemented
-	return c.xxx()
+	c.SetFlag(FlagI, true)
+	return 0
 }
 
+// sta stores the accumulator at the effective address.
 func (c *CPU6502) sta() int {
-	// Unimplemented
-	return c.xxx()
+	c.bus.Write(c.absoluteAddress, c.a)
+	return 0
 }
 
+// stx stores the X register at the effective address.
 func (c *CPU6502) stx() int {
-	// Unimplemented
-	return c.xxx()
+	c.bus.Write(c.absoluteAddress, c.x)
+	return 0
 }
 
+// sty stores the Y register at the effective address.
 func (c *CPU6502) sty() int {
-	// Unimplemented
-	return c.xxx()
+	c.bus.Write(c.absoluteAddress, c.y)
+	return 0
 }
 
+// tax transfers the accumulator to the X register.
 func (c *CPU6502) tax() int {
-	// Unimplemented
-	return c.xxx()
+	c.x = c.a
+	c.setZN(c.x)
+	return 0
 }
 
+// tay transfers the accumulator to the Y register.
 func (c *CPU6502) tay() int {
-	// Unimplemented
-	return c.xxx()
+	c.y = c.a
+	c.setZN(c.y)
+	return 0
 }
 
+// tsx transfers the stack pointer to the X register.
 func (c *CPU6502) tsx() int {
-	// Unimplemented
-	return c.xxx()
+	c.x = c.stackPointer
+	c.setZN(c.x)
+	return 0
 }
 
+// txa transfers the X register to the accumulator.
 func (c *CPU6502) txa() int {
-	// Unimplemented
-	return c.xxx()
+	c.a = c.x
+	c.setZN(c.a)
+	return 0
 }
 
+// txs transfers the X register to the stack pointer. No flags are affected.
 func (c *CPU6502) txs() int {
-	// Unimplemented
-	return c.xxx()
+	c.stackPointer = c.x
+	return 0
 }
 
+// tya transfers the Y register to the accumulator.
 func (c *CPU6502) tya() int {
-	// Unimplemented
-	return c.xxx()
+	c.a = c.y
+	c.setZN(c.a)
+	return 0
+}
+
+// --- Helpers ---
+
+// addWithCarry adds value and the carry flag to the accumulator, updating
+// FlagC, FlagZ, FlagV and FlagN.
+func (c *CPU6502) addWithCarry(value byte) {
+	c.temp = uint16(c.a) + uint16(value)
+	if c.GetFlag(FlagC) {
+		c.temp++
+	}
+	result := byte(c.temp)
+
+	c.SetFlag(FlagC, c.temp > 0xFF)
+	c.SetFlag(FlagV, (^(c.a^value))&(c.a^result)&0x80 != 0)
+	c.a = result
+	c.setZN(c.a)
+}
+
+// compare sets the flags as if value had been subtracted from reg.
+func (c *CPU6502) compare(reg byte, value byte) {
+	c.SetFlag(FlagC, reg >= value)
+	c.setZN(reg - value)
+}
+
+// branch takes a relative branch if condition is true.
+//
+// A taken branch costs one extra cycle, and a second one if the target
+// lies on a different page than the instruction that follows the branch.
+func (c *CPU6502) branch(condition bool) {
+	if !condition {
+		return
+	}
+
+	c.cycles++
+	c.absoluteAddress = c.programCounter + c.relativeAddress
+
+	if c.absoluteAddress&0xFF00 != c.programCounter&0xFF00 {
+		c.cycles++
+	}
+
+	c.programCounter = c.absoluteAddress
+}
+
+// writeBack stores the result of a read-modify-write instruction, either in
+// the accumulator or at the effective address depending on the addressing
+// mode, and updates FlagZ and FlagN.
+func (c *CPU6502) writeBack(value byte) {
+	if c.addressingMode == Accumulator {
+		c.a = value
+	} else {
+		c.bus.Write(c.absoluteAddress, value)
+	}
+	c.setZN(value)
 }
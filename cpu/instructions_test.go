@@ -0,0 +1,172 @@
+package cpu
+
+import "testing"
+
+func TestInstructionTable(t *testing.T) {
+	for opcode := 0; opcode < len(InstructionTable); opcode++ {
+		info := InstructionTable[opcode]
+		if info.Execute == nil {
+			t.Errorf("opcode $%02X has no handler", opcode)
+			continue
+		}
+		if int(info.Opcode) != opcode {
+			t.Errorf("opcode $%02X is filed under $%02X", info.Opcode, opcode)
+		}
+		if info.Cycles == 0 {
+			t.Errorf("opcode $%02X takes no cycles", opcode)
+		}
+		if DecodeInstruction(byte(opcode)).Opcode != info.Opcode {
+			t.Errorf("DecodeInstruction($%02X) disagrees with InstructionTable", opcode)
+		}
+
+		// Unofficial opcodes fill the slots official ones leave free
+		unofficial := UnofficialInstructionTable[opcode]
+		if IsUnofficial(byte(opcode)) != (unofficial.Execute != nil) {
+			t.Errorf("IsUnofficial($%02X) = %v", opcode, IsUnofficial(byte(opcode)))
+		}
+		if unofficial.Execute != nil && (info.Instruction != unofficial.Instruction || info.Mode != unofficial.Mode) {
+			t.Errorf("opcode $%02X decodes as %v %v, want unofficial %v %v",
+				opcode, info.Instruction, info.Mode, unofficial.Instruction, unofficial.Mode)
+		}
+	}
+}
+
+func TestDecodeInstruction(t *testing.T) {
+	tests := []struct {
+		opcode      byte
+		instruction Instruction
+		mode        AddressingMode
+		cycles      uint8
+	}{
+		{0x00, BRK, Implicit, 7},
+		{0x4C, JMP, Absolute, 3},
+		{0x6C, JMP, Indirect, 5},
+		{0xA9, LDA, Immediate, 2},
+		{0xB1, LDA, IndirectIndexed, 5},
+		{0xEA, NOP, Implicit, 2},
+		{0x02, KIL, Implicit, 2},
+		{0xA7, LAX, ZeroPage, 3},
+		{0xEB, SBC, Immediate, 2},
+	}
+
+	for _, test := range tests {
+		info := DecodeInstruction(test.opcode)
+		if info.Instruction != test.instruction || info.Mode != test.mode || info.Cycles != test.cycles {
+			t.Errorf("DecodeInstruction($%02X) = %v %v %d cycles, want %v %v %d cycles",
+				test.opcode, info.Instruction, info.Mode, info.Cycles,
+				test.instruction, test.mode, test.cycles)
+		}
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	const flags = FlagC | FlagZ | FlagV | FlagN
+
+	tests := []struct {
+		name    string
+		program []byte
+		a       byte // Accumulator before
+		status  byte // Flags before
+		wantA   byte
+		want    byte // C, Z, V and N afterwards
+	}{
+		{"ADC", []byte{0x69, 0x10}, 0x50, 0, 0x60, 0},
+		{"ADC with carry in", []byte{0x69, 0x10}, 0x50, FlagC, 0x61, 0},
+		{"ADC positive overflow", []byte{0x69, 0x50}, 0x50, 0, 0xA0, FlagV | FlagN},
+		{"ADC carry out", []byte{0x69, 0x01}, 0xFF, 0, 0x00, FlagC | FlagZ},
+		{"ADC negative overflow", []byte{0x69, 0xFF}, 0x80, 0, 0x7F, FlagC | FlagV},
+		{"ADC overflow from carry in", []byte{0x69, 0x00}, 0x7F, FlagC, 0x80, FlagV | FlagN},
+		{"ADC ignores decimal mode", []byte{0x69, 0x01}, 0x09, FlagD, 0x0A, 0},
+		{"SBC borrow", []byte{0xE9, 0xF0}, 0x50, FlagC, 0x60, 0},
+		{"SBC positive overflow", []byte{0xE9, 0xB0}, 0x50, FlagC, 0xA0, FlagV | FlagN},
+		{"SBC negative overflow", []byte{0xE9, 0x70}, 0xD0, FlagC, 0x60, FlagC | FlagV},
+		{"SBC to zero", []byte{0xE9, 0x05}, 0x05, FlagC, 0x00, FlagC | FlagZ},
+		{"SBC with borrow in", []byte{0xE9, 0x05}, 0x05, 0, 0xFF, FlagN},
+		{"SBC ignores decimal mode", []byte{0xE9, 0x01}, 0x10, FlagC | FlagD, 0x0F, FlagC},
+		{"unofficial SBC", []byte{0xEB, 0x01}, 0x10, FlagC, 0x0F, FlagC},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, _ := newTestCPU(test.program...)
+			c.Step()
+			c.SetRegister(RegA, test.a)
+			c.SetRegister(RegP, FlagI|FlagU|test.status)
+			c.Step()
+
+			if a := c.GetRegister(RegA); a != test.wantA {
+				t.Errorf("A = $%02X, want $%02X", a, test.wantA)
+			}
+			if status := c.GetRegister(RegP) & flags; status != test.want {
+				t.Errorf("status = %08b, want %08b", status, test.want)
+			}
+			if c.GetFlag(FlagD) != (test.status&FlagD != 0) {
+				t.Error("FlagD changed")
+			}
+		})
+	}
+}
+
+func TestBIT(t *testing.T) {
+	const flags = FlagC | FlagZ | FlagV | FlagN
+
+	tests := []struct {
+		name   string
+		a      byte
+		value  byte // At $0010
+		status byte // Flags before
+		want   byte // C, Z, V and N afterwards
+	}{
+		{"N and V from memory", 0x01, 0xC0, 0, FlagZ | FlagV | FlagN},
+		{"zero", 0xFF, 0x00, 0, FlagZ},
+		{"nonzero", 0x40, 0x40, 0, FlagV},
+		{"clears N, V and Z", 0x01, 0x01, FlagZ | FlagV | FlagN, 0},
+		{"leaves carry", 0x01, 0x01, FlagC, FlagC},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, bus := newTestCPU(0x24, 0x10) // BIT $10
+			bus[0x10] = test.value
+			c.Step()
+			c.SetRegister(RegA, test.a)
+			c.SetRegister(RegP, FlagI|FlagU|test.status)
+			c.Step()
+
+			if a := c.GetRegister(RegA); a != test.a {
+				t.Errorf("A = $%02X, want $%02X unchanged", a, test.a)
+			}
+			if status := c.GetRegister(RegP) & flags; status != test.want {
+				t.Errorf("status = %08b, want %08b", status, test.want)
+			}
+		})
+	}
+}
+
+func TestJMPIndirect(t *testing.T) {
+	tests := []struct {
+		name    string
+		pointer uint16
+		want    uint16
+	}{
+		{"within a page", 0x0280, 0x1234},
+		// The high byte is read from the start of the same page, not $0300
+		{"page wrap bug", 0x02FF, 0x1256},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, bus := newTestCPU(0x6C, byte(test.pointer), byte(test.pointer>>8))
+			bus[0x0280], bus[0x0281] = 0x34, 0x12
+			bus[0x02FF], bus[0x0200], bus[0x0300] = 0x56, 0x12, 0x34
+			c.Step()
+
+			if cycles := c.Step(); cycles != 5 {
+				t.Errorf("took %d cycles, want 5", cycles)
+			}
+			if c.GetPC() != test.want {
+				t.Errorf("PC = $%04X, want $%04X", c.GetPC(), test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package cpu
+
+// IRQSource identifies a device driving the shared IRQ line.
+//
+// The IRQ line is wired-OR on the NES, so several devices can hold it
+// asserted at the same time. Each device owns a bit and the line stays
+// asserted until every device has released it.
+type IRQSource byte
+
+// IRQ sources
+const (
+	IRQFrameCounter IRQSource = 1 << iota
+	IRQDMC
+	IRQMapper
+	IRQExternal
+)
+
+// Interrupt vectors
+const (
+	nmiVector   uint16 = 0xFFFA
+	resetVector uint16 = 0xFFFC
+	irqVector   uint16 = 0xFFFE
+)
+
+// SetNMI sets the level of the NMI line.
+//
+// NMI is edge-triggered: only a transition from released to asserted
+// requests an interrupt, and holding the line asserted does not request
+// another one.
+func (c *CPU6502) SetNMI(asserted bool) {
+	if asserted && !c.nmiLine {
+		c.nmiEdge = true
+	}
+	c.nmiLine = asserted
+}
+
+// SetIRQ asserts or releases the IRQ line on behalf of source.
+//
+// IRQ is level-triggered: an interrupt is taken at every instruction
+// boundary for as long as any source holds the line and FlagI is clear.
+func (c *CPU6502) SetIRQ(source IRQSource, asserted bool) {
+	if asserted {
+		c.irqLines |= source
+	} else {
+		c.irqLines &^= source
+	}
+}
+
+// IRQAsserted reports whether source is currently asserting the IRQ line.
+func (c *CPU6502) IRQAsserted(source IRQSource) bool {
+	return c.irqLines&source != 0
+}
+
+// NMI immediately performs a non-maskable interrupt through the vector at
+// $FFFA.
+//
+// It is meant to be called between instructions. Devices on the bus should
+// normally use SetNMI, which lets the CPU take the interrupt at the correct
+// point in the instruction stream.
+func (c *CPU6502) NMI() {
+	c.interrupt(nmiVector, false)
+	c.cycles = 7
+}
+
+// IRQ immediately performs a maskable interrupt through the vector at
+// $FFFE, unless FlagI is set.
+//
+// It is meant to be called between instructions. Devices on the bus should
+// normally use SetIRQ, which lets the CPU take the interrupt at the correct
+// point in the instruction stream.
+func (c *CPU6502) IRQ() {
+	if c.GetFlag(FlagI) {
+		return
+	}
+	c.interrupt(irqVector, false)
+	c.cycles = 7
+}
+
+// interrupt pushes the program counter and status register, sets FlagI and
+// jumps through vector.
+//
+// FlagB is only set in the pushed status when the interrupt was caused by
+// BRK, which is how handlers tell the two apart. FlagU is always pushed set.
+func (c *CPU6502) interrupt(vector uint16, brk bool) {
+	c.push(byte(c.programCounter >> 8))
+	c.push(byte(c.programCounter))
+
+	status := (c.status | FlagU) &^ FlagB
+	if brk {
+		status |= FlagB
+	}
+	c.push(status)
+	c.SetFlag(FlagI, true)
+	c.irqInhibit = true
+
+	c.programCounter = c.readWord(vector)
+}
+
+// pollInterrupts samples the interrupt lines.
+//
+// The 6502 polls during the last cycle of each instruction, so an interrupt
+// requested after that point is only taken after the following instruction.
+func (c *CPU6502) pollInterrupts() {
+	if c.nmiEdge {
+		c.nmiEdge = false
+		c.nmiPending = true
+	}
+	c.irqPending = c.irqLines != 0 && !c.irqInhibit
+}
+
+// serviceInterrupts starts a pending interrupt sequence, if any.
+//
+// NMI takes priority over IRQ. A pending IRQ is taken even if the last
+// instruction was SEI, since the line was polled before FlagI changed.
+// Returns true if an interrupt was started.
+func (c *CPU6502) serviceInterrupts() bool {
+	switch {
+	case c.nmiPending:
+		c.nmiPending = false
+		c.irqPending = false
+		c.interrupt(nmiVector, false)
+	case c.irqPending:
+		c.irqPending = false
+		c.interrupt(irqVector, false)
+	default:
+		return false
+	}
+
+	// Interrupt sequences take 7 cycles
+	c.cycles = 7
+	return true
+}
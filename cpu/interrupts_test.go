@@ -0,0 +1,180 @@
+package cpu
+
+import "testing"
+
+func TestInterruptTiming(t *testing.T) {
+	nmi := func(c *CPU6502) { c.SetNMI(true) }
+	irq := func(c *CPU6502) { c.SetIRQ(IRQExternal, true) }
+
+	const (
+		nop = 0xEA
+		cli = 0x58
+		sei = 0x78
+	)
+
+	tests := []struct {
+		name    string
+		program []byte
+		clock   int // Clock, counted from reset, before which the line changes
+		change  func(c *CPU6502)
+		want    []uint16 // PC at each instruction boundary
+	}{
+		{
+			// Reset takes clocks 0-6 and the first NOP 7-8
+			name:    "NMI between instructions",
+			program: []byte{nop, nop, nop},
+			clock:   7, change: nmi,
+			want: []uint16{0x8000, 0x8001, testNMIHandler, testNMIHandler + 1},
+		},
+		{
+			name:    "NMI before the last cycle is taken after the instruction",
+			program: []byte{0xAD, 0x00, 0x02, nop}, // LDA $0200, 4 cycles
+			clock:   10, change: nmi,
+			want: []uint16{0x8000, 0x8003, testNMIHandler},
+		},
+		{
+			name:    "NMI after the last cycle waits for the next instruction",
+			program: []byte{0xAD, 0x00, 0x02, nop},
+			clock:   11, change: nmi,
+			want: []uint16{0x8000, 0x8003, 0x8004, testNMIHandler},
+		},
+		{
+			name:    "held NMI is only taken once",
+			program: []byte{nop, nop},
+			clock:   7, change: nmi,
+			want: []uint16{0x8000, 0x8001, testNMIHandler, testNMIHandler + 1, testNMIHandler + 2},
+		},
+		{
+			name:    "IRQ masked after reset",
+			program: []byte{nop, nop, nop},
+			clock:   0, change: irq,
+			want: []uint16{0x8000, 0x8001, 0x8002, 0x8003},
+		},
+		{
+			name:    "CLI lets an IRQ in after the next instruction",
+			program: []byte{cli, nop, nop},
+			clock:   0, change: irq,
+			want: []uint16{0x8000, 0x8001, 0x8002, testIRQHandler, testIRQHandler + 1},
+		},
+		{
+			name:    "IRQ polled during SEI is still taken",
+			program: []byte{cli, nop, sei, nop},
+			clock:   11, change: irq,
+			want: []uint16{0x8000, 0x8001, 0x8002, 0x8003, testIRQHandler},
+		},
+		{
+			name:    "IRQ after SEI is masked",
+			program: []byte{cli, nop, sei, nop, nop},
+			clock:   13, change: irq,
+			want: []uint16{0x8000, 0x8001, 0x8002, 0x8003, 0x8004, 0x8005},
+		},
+		{
+			name:    "NMI wins over IRQ",
+			program: []byte{cli, nop, nop},
+			clock:   9, change: func(c *CPU6502) { nmi(c); irq(c) },
+			want: []uint16{0x8000, 0x8001, 0x8002, testNMIHandler},
+		},
+		{
+			name:    "IRQ handler runs with IRQs masked",
+			program: []byte{cli, nop, nop},
+			clock:   9, change: irq,
+			want: []uint16{0x8000, 0x8001, 0x8002, testIRQHandler, testIRQHandler + 1, testIRQHandler + 2},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, _ := newTestCPU(test.program...)
+
+			var got []uint16
+			for clock := 0; len(got) < len(test.want) && clock < 1000; clock++ {
+				if clock == test.clock {
+					test.change(c)
+				}
+				c.Clock()
+				if c.Complete() {
+					got = append(got, c.GetPC())
+				}
+			}
+
+			for i := range test.want {
+				if i >= len(got) || got[i] != test.want[i] {
+					t.Fatalf("boundaries at %04X, want %04X", got, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestInterruptPushesStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		program []byte
+		trigger func(c *CPU6502)
+		vector  uint16
+		pc      uint16 // Return address pushed
+		flagB   bool
+	}{
+		{"BRK", []byte{0x00, 0xFF}, nil, testIRQHandler, 0x8002, true},
+		{"IRQ", []byte{0x58, 0xEA}, func(c *CPU6502) { c.SetIRQ(IRQMapper, true) }, testIRQHandler, 0x8002, false},
+		{"NMI", []byte{0xEA, 0xEA}, func(c *CPU6502) { c.SetNMI(true) }, testNMIHandler, 0x8001, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, bus := newTestCPU(test.program...)
+			c.Step()
+			if test.trigger != nil {
+				test.trigger(c)
+			}
+			for i := 0; i < 3 && c.GetPC() != test.vector; i++ {
+				c.Step()
+			}
+			if c.GetPC() != test.vector {
+				t.Fatalf("PC = $%04X, want $%04X", c.GetPC(), test.vector)
+			}
+
+			// Three bytes below $01FD: PC high, PC low, status
+			pushed := uint16(bus[0x01FD])<<8 | uint16(bus[0x01FC])
+			status := bus[0x01FB]
+			if pushed != test.pc {
+				t.Errorf("pushed PC $%04X, want $%04X", pushed, test.pc)
+			}
+			if got := status&FlagB != 0; got != test.flagB {
+				t.Errorf("pushed FlagB %v, want %v", got, test.flagB)
+			}
+			if status&FlagU == 0 {
+				t.Error("pushed FlagU clear")
+			}
+			if !c.GetFlag(FlagI) {
+				t.Error("FlagI clear in handler")
+			}
+			if sp := c.GetRegister(RegSP); sp != 0xFA {
+				t.Errorf("SP = $%02X, want $FA", sp)
+			}
+		})
+	}
+}
+
+func TestIRQLines(t *testing.T) {
+	c, _ := newTestCPU()
+	c.SetIRQ(IRQFrameCounter, true)
+	c.SetIRQ(IRQMapper, true)
+	c.SetIRQ(IRQFrameCounter, false)
+
+	// The line is wired-OR, so it stays asserted while any source holds it
+	tests := []struct {
+		source IRQSource
+		want   bool
+	}{
+		{IRQFrameCounter, false},
+		{IRQDMC, false},
+		{IRQMapper, true},
+		{IRQExternal, false},
+	}
+	for _, test := range tests {
+		if got := c.IRQAsserted(test.source); got != test.want {
+			t.Errorf("IRQAsserted(%d) = %v, want %v", test.source, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package cpu
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Tracer writes a line for every instruction the CPU executes, in the
+// column layout of the canonical nestest.log, so that runs can be diffed
+// line by line against the reference log and against other emulators:
+//
+//	C000  4C F5 C5  JMP $C5F5                       A:00 X:00 Y:00 P:24 SP:FD PPU:  0, 21 CYC:7
+type Tracer struct {
+	w io.Writer
+
+	// PPUPosition reports the scanline and dot the PPU is on. If it is
+	// nil, both are traced as 0.
+	PPUPosition func() (scanline int, dot int)
+}
+
+// traceNames overrides InstructionNames where nestest.log uses a
+// different mnemonic.
+var traceNames = map[Instruction]string{
+	ISC: "ISB",
+}
+
+// NewTracer returns a Tracer writing to w.
+func NewTracer(w io.Writer) *Tracer {
+	return &Tracer{w: w}
+}
+
+// Trace writes the line for the instruction the CPU is about to execute.
+func (t *Tracer) Trace(c *CPU6502) {
+	scanline, dot := 0, 0
+	if t.PPUPosition != nil {
+		scanline, dot = t.PPUPosition()
+	}
+	fmt.Fprintln(t.w, c.TraceLine(scanline, dot))
+}
+
+// TraceLine formats the CPU state before the instruction at the program
+// counter executes, as a nestest.log line.
+//
+// Memory is read with Peek when the bus supports it, so tracing has no
+// side effects on the emulated hardware. The values shown for operands are
+// whatever Peek returns, which for I/O registers may not match a real read.
+func (c *CPU6502) TraceLine(scanline int, dot int) string {
+	pc := c.programCounter
+	opcode := c.peek(pc)
+	info := DecodeInstruction(opcode)
+
+	raw := make([]string, info.Mode.Length())
+	for i := range raw {
+		raw[i] = fmt.Sprintf("%02X", c.peek(pc+uint16(i)))
+	}
+
+	marker := ' '
+	if IsUnofficial(opcode) {
+		marker = '*'
+	}
+
+	name, ok := traceNames[info.Instruction]
+	if !ok {
+		name = InstructionNames[info.Instruction]
+	}
+	disassembly := name
+	if operand := c.traceOperand(info); operand != "" {
+		disassembly += " " + operand
+	}
+
+	return fmt.Sprintf("%04X  %-8s %c%-31s A:%02X X:%02X Y:%02X P:%02X SP:%02X PPU:%3d,%3d CYC:%d",
+		pc, strings.Join(raw, " "), marker, disassembly,
+		c.a, c.x, c.y, c.status, c.stackPointer, scanline, dot, c.totalCycles)
+}
+
+// traceOperand formats the operand of the instruction at the program
+// counter the way nestest.log does, including the effective address and
+// the value currently stored there.
+func (c *CPU6502) traceOperand(info InstructionInfo) string {
+	pc := c.programCounter
+	op8 := c.peek(pc + 1)
+	op16 := c.peekWord(pc + 1)
+
+	switch info.Mode {
+	case Accumulator:
+		return "A"
+	case Immediate:
+		return fmt.Sprintf("#$%02X", op8)
+	case ZeroPage:
+		return fmt.Sprintf("$%02X = %02X", op8, c.peek(uint16(op8)))
+	case ZeroPageX:
+		addr := op8 + c.x
+		return fmt.Sprintf("$%02X,X @ %02X = %02X", op8, addr, c.peek(uint16(addr)))
+	case ZeroPageY:
+		addr := op8 + c.y
+		return fmt.Sprintf("$%02X,Y @ %02X = %02X", op8, addr, c.peek(uint16(addr)))
+	case Relative:
+		return fmt.Sprintf("$%04X", pc+2+uint16(int8(op8)))
+	case Absolute:
+		if info.Instruction == JMP || info.Instruction == JSR {
+			return fmt.Sprintf("$%04X", op16)
+		}
+		return fmt.Sprintf("$%04X = %02X", op16, c.peek(op16))
+	case AbsoluteX:
+		addr := op16 + uint16(c.x)
+		return fmt.Sprintf("$%04X,X @ %04X = %02X", op16, addr, c.peek(addr))
+	case AbsoluteY:
+		addr := op16 + uint16(c.y)
+		return fmt.Sprintf("$%04X,Y @ %04X = %02X", op16, addr, c.peek(addr))
+	case Indirect:
+		// Reproduce the page wrap bug of JMP ($xxFF)
+		hi := op16 + 1
+		if op16&0x00FF == 0x00FF {
+			hi = op16 & 0xFF00
+		}
+		target := uint16(c.peek(hi))<<8 | uint16(c.peek(op16))
+		return fmt.Sprintf("($%04X) = %04X", op16, target)
+	case IndexedIndirect:
+		ptr := op8 + c.x
+		addr := uint16(c.peek(uint16(ptr+1)))<<8 | uint16(c.peek(uint16(ptr)))
+		return fmt.Sprintf("($%02X,X) @ %02X = %04X = %02X", op8, ptr, addr, c.peek(addr))
+	case IndirectIndexed:
+		base := uint16(c.peek(uint16(op8+1)))<<8 | uint16(c.peek(uint16(op8)))
+		addr := base + uint16(c.y)
+		return fmt.Sprintf("($%02X),Y = %04X @ %04X = %02X", op8, base, addr, c.peek(addr))
+	default:
+		return ""
+	}
+}
+
+// peekWord reads a little-endian 16-bit value without side effects.
+func (c *CPU6502) peekWord(addr uint16) uint16 {
+	return uint16(c.peek(addr+1))<<8 | uint16(c.peek(addr))
+}
@@ -0,0 +1,100 @@
+package cpu
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// nestestLog is the start of nestest.log, which begins at $C000 with the
+// PPU 21 dots into the frame after reset.
+const nestestLog = `C000  4C F5 C5  JMP $C5F5                       A:00 X:00 Y:00 P:24 SP:FD PPU:  0, 21 CYC:7
+C5F5  A2 00     LDX #$00                        A:00 X:00 Y:00 P:24 SP:FD PPU:  0, 30 CYC:10
+C5F7  86 00     STX $00 = 00                    A:00 X:00 Y:00 P:26 SP:FD PPU:  0, 36 CYC:12
+C5F9  86 10     STX $10 = 00                    A:00 X:00 Y:00 P:26 SP:FD PPU:  0, 45 CYC:15
+C5FB  86 11     STX $11 = 00                    A:00 X:00 Y:00 P:26 SP:FD PPU:  0, 54 CYC:18
+C5FD  20 2D C7  JSR $C72D                       A:00 X:00 Y:00 P:26 SP:FD PPU:  0, 63 CYC:21
+C72D  EA        NOP                             A:00 X:00 Y:00 P:26 SP:FB PPU:  0, 81 CYC:27
+C72E  38        SEC                             A:00 X:00 Y:00 P:26 SP:FB PPU:  0, 87 CYC:29
+C72F  B0 04     BCS $C735                       A:00 X:00 Y:00 P:27 SP:FB PPU:  0, 93 CYC:31
+C735  EA        NOP                             A:00 X:00 Y:00 P:27 SP:FB PPU:  0,102 CYC:34
+`
+
+func TestTracerNestest(t *testing.T) {
+	// The code nestest runs on its way to the first test
+	bus := &benchBus{}
+	copy(bus[0xC000:], []byte{0x4C, 0xF5, 0xC5})
+	copy(bus[0xC5F5:], []byte{0xA2, 0x00, 0x86, 0x00, 0x86, 0x10, 0x86, 0x11, 0x20, 0x2D, 0xC7})
+	copy(bus[0xC72D:], []byte{0xEA, 0x38, 0xB0, 0x04})
+	copy(bus[0xC735:], []byte{0xEA})
+	bus[0xFFFC], bus[0xFFFD] = 0x00, 0xC0
+
+	c := New()
+	c.ConnectBus(bus)
+	c.Reset()
+
+	var log bytes.Buffer
+	tracer := NewTracer(&log)
+	tracer.PPUPosition = func() (int, int) {
+		// Three dots per CPU cycle, from the start of the frame
+		dots := int(c.GetTotalCycles()) * 3
+		return dots / 341, dots % 341
+	}
+	c.SetTracer(tracer)
+
+	c.Step()
+	for i := 0; i < strings.Count(nestestLog, "\n"); i++ {
+		c.Step()
+	}
+
+	if got := log.String(); got != nestestLog {
+		t.Errorf("trace differs from nestest.log:\n%s\nwant:\n%s", got, nestestLog)
+	}
+}
+
+func TestTraceLineDisassembly(t *testing.T) {
+	tests := []struct {
+		name    string
+		program []byte
+		want    string // Marker, mnemonic and operand columns
+	}{
+		{"implied", []byte{0xEA}, " NOP"},
+		{"accumulator", []byte{0x0A}, " ASL A"},
+		{"immediate", []byte{0xA9, 0x44}, " LDA #$44"},
+		{"zero page", []byte{0xA5, 0x10}, " LDA $10 = 5A"},
+		{"zero page,X wraps", []byte{0xB5, 0xFF}, " LDA $FF,X @ 00 = 11"},
+		{"zero page,Y wraps", []byte{0xB6, 0xFF}, " LDX $FF,Y @ 01 = 22"},
+		{"absolute", []byte{0xAD, 0x00, 0x03}, " LDA $0300 = 33"},
+		{"absolute,X", []byte{0xBD, 0xFF, 0x02}, " LDA $02FF,X @ 0300 = 33"},
+		{"absolute,Y", []byte{0xB9, 0xFE, 0x02}, " LDA $02FE,Y @ 0300 = 33"},
+		{"JMP absolute has no value", []byte{0x4C, 0x34, 0x12}, " JMP $1234"},
+		{"JSR has no value", []byte{0x20, 0x34, 0x12}, " JSR $1234"},
+		{"indirect page wrap", []byte{0x6C, 0xFF, 0x02}, " JMP ($02FF) = 1256"},
+		{"indexed indirect", []byte{0xA1, 0x1F}, " LDA ($1F,X) @ 20 = 0300 = 33"},
+		{"indirect indexed", []byte{0xB1, 0x20}, " LDA ($20),Y = 0300 @ 0302 = 44"},
+		{"branch forward", []byte{0xD0, 0x10}, " BNE $8012"},
+		{"branch backward", []byte{0xD0, 0xFC}, " BNE $7FFE"},
+		{"unofficial", []byte{0xA7, 0x10}, "*LAX $10 = 5A"},
+		{"unofficial NOP", []byte{0x04, 0x10}, "*NOP $10 = 5A"},
+		{"unofficial SBC", []byte{0xEB, 0x01}, "*SBC #$01"},
+		{"ISC is named ISB", []byte{0xE7, 0x10}, "*ISB $10 = 5A"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, bus := newTestCPU(test.program...)
+			bus[0x00], bus[0x01], bus[0x10] = 0x11, 0x22, 0x5A
+			bus[0x20], bus[0x21] = 0x00, 0x03
+			bus[0x0300], bus[0x0302] = 0x33, 0x44
+			bus[0x02FF], bus[0x0200] = 0x56, 0x12
+			c.Step()
+			c.SetRegister(RegX, 0x01)
+			c.SetRegister(RegY, 0x02)
+
+			line := c.TraceLine(0, 0)
+			if got := strings.TrimRight(line[15:47], " "); got != test.want {
+				t.Errorf("TraceLine() = %q, want %q in columns 16-47", line, test.want)
+			}
+		})
+	}
+}
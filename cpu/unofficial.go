@@ -0,0 +1,378 @@
+package cpu
+
+import "fmt"
+
+// UnofficialOpcodeMode selects how the CPU treats opcodes that are not part
+// of the documented 6502 instruction set.
+type UnofficialOpcodeMode uint8
+
+const (
+	// UnofficialExecute executes unofficial opcodes the way the 2A03 does.
+	// This is what commercial games and test ROMs expect.
+	UnofficialExecute UnofficialOpcodeMode = iota
+	// UnofficialTrap halts the CPU before executing any unofficial opcode,
+	// which is useful for catching runaway code while debugging.
+	UnofficialTrap
+)
+
+// HaltError describes why the CPU stopped executing instructions.
+type HaltError struct {
+	Opcode  byte
+	Address uint16
+	Jammed  bool // halted by a KIL opcode rather than trapped
+}
+
+func (e *HaltError) Error() string {
+	if e.Jammed {
+		return fmt.Sprintf("cpu jammed by opcode 0x%02X at 0x%04X", e.Opcode, e.Address)
+	}
+	return fmt.Sprintf("illegal opcode 0x%02X trapped at 0x%04X", e.Opcode, e.Address)
+}
+
+// UnofficialInstructionTable contains the opcodes that are not part of the
+// documented instruction set but are decoded by the 2A03 all the same.
+// Slots belonging to official opcodes are left empty.
+var UnofficialInstructionTable = [256]InstructionInfo{
+	0x93: {AHX, 0x93, IndirectIndexed, 6, (*CPU6502).ahx},
+	0x9F: {AHX, 0x9F, AbsoluteY, 5, (*CPU6502).ahx},
+	0x4B: {ALR, 0x4B, Immediate, 2, (*CPU6502).alr},
+	0x0B: {ANC, 0x0B, Immediate, 2, (*CPU6502).anc},
+	0x2B: {ANC, 0x2B, Immediate, 2, (*CPU6502).anc},
+	0x6B: {ARR, 0x6B, Immediate, 2, (*CPU6502).arr},
+	0xCB: {AXS, 0xCB, Immediate, 2, (*CPU6502).axs},
+	0xC7: {DCP, 0xC7, ZeroPage, 5, (*CPU6502).dcp},
+	0xD7: {DCP, 0xD7, ZeroPageX, 6, (*CPU6502).dcp},
+	0xCF: {DCP, 0xCF, Absolute, 6, (*CPU6502).dcp},
+	0xDF: {DCP, 0xDF, AbsoluteX, 7, (*CPU6502).dcp},
+	0xDB: {DCP, 0xDB, AbsoluteY, 7, (*CPU6502).dcp},
+	0xC3: {DCP, 0xC3, IndexedIndirect, 8, (*CPU6502).dcp},
+	0xD3: {DCP, 0xD3, IndirectIndexed, 8, (*CPU6502).dcp},
+	0xE7: {ISC, 0xE7, ZeroPage, 5, (*CPU6502).isc},
+	0xF7: {ISC, 0xF7, ZeroPageX, 6, (*CPU6502).isc},
+	0xEF: {ISC, 0xEF, Absolute, 6, (*CPU6502).isc},
+	0xFF: {ISC, 0xFF, AbsoluteX, 7, (*CPU6502).isc},
+	0xFB: {ISC, 0xFB, AbsoluteY, 7, (*CPU6502).isc},
+	0xE3: {ISC, 0xE3, IndexedIndirect, 8, (*CPU6502).isc},
+	0xF3: {ISC, 0xF3, IndirectIndexed, 8, (*CPU6502).isc},
+	0x02: {KIL, 0x02, Implicit, 2, (*CPU6502).kil},
+	0x12: {KIL, 0x12, Implicit, 2, (*CPU6502).kil},
+	0x22: {KIL, 0x22, Implicit, 2, (*CPU6502).kil},
+	0x32: {KIL, 0x32, Implicit, 2, (*CPU6502).kil},
+	0x42: {KIL, 0x42, Implicit, 2, (*CPU6502).kil},
+	0x52: {KIL, 0x52, Implicit, 2, (*CPU6502).kil},
+	0x62: {KIL, 0x62, Implicit, 2, (*CPU6502).kil},
+	0x72: {KIL, 0x72, Implicit, 2, (*CPU6502).kil},
+	0x92: {KIL, 0x92, Implicit, 2, (*CPU6502).kil},
+	0xB2: {KIL, 0xB2, Implicit, 2, (*CPU6502).kil},
+	0xD2: {KIL, 0xD2, Implicit, 2, (*CPU6502).kil},
+	0xF2: {KIL, 0xF2, Implicit, 2, (*CPU6502).kil},
+	0xBB: {LAS, 0xBB, AbsoluteY, 4, (*CPU6502).las},
+	0xAB: {LAX, 0xAB, Immediate, 2, (*CPU6502).lxa},
+	0xA7: {LAX, 0xA7, ZeroPage, 3, (*CPU6502).lax},
+	0xB7: {LAX, 0xB7, ZeroPageY, 4, (*CPU6502).lax},
+	0xAF: {LAX, 0xAF, Absolute, 4, (*CPU6502).lax},
+	0xBF: {LAX, 0xBF, AbsoluteY, 4, (*CPU6502).lax},
+	0xA3: {LAX, 0xA3, IndexedIndirect, 6, (*CPU6502).lax},
+	0xB3: {LAX, 0xB3, IndirectIndexed, 5, (*CPU6502).lax},
+	0x1A: {NOP, 0x1A, Implicit, 2, (*CPU6502).nop},
+	0x3A: {NOP, 0x3A, Implicit, 2, (*CPU6502).nop},
+	0x5A: {NOP, 0x5A, Implicit, 2, (*CPU6502).nop},
+	0x7A: {NOP, 0x7A, Implicit, 2, (*CPU6502).nop},
+	0xDA: {NOP, 0xDA, Implicit, 2, (*CPU6502).nop},
+	0xFA: {NOP, 0xFA, Implicit, 2, (*CPU6502).nop},
+	0x80: {NOP, 0x80, Immediate, 2, (*CPU6502).ign},
+	0x82: {NOP, 0x82, Immediate, 2, (*CPU6502).ign},
+	0x89: {NOP, 0x89, Immediate, 2, (*CPU6502).ign},
+	0xC2: {NOP, 0xC2, Immediate, 2, (*CPU6502).ign},
+	0xE2: {NOP, 0xE2, Immediate, 2, (*CPU6502).ign},
+	0x04: {NOP, 0x04, ZeroPage, 3, (*CPU6502).ign},
+	0x44: {NOP, 0x44, ZeroPage, 3, (*CPU6502).ign},
+	0x64: {NOP, 0x64, ZeroPage, 3, (*CPU6502).ign},
+	0x14: {NOP, 0x14, ZeroPageX, 4, (*CPU6502).ign},
+	0x34: {NOP, 0x34, ZeroPageX, 4, (*CPU6502).ign},
+	0x54: {NOP, 0x54, ZeroPageX, 4, (*CPU6502).ign},
+	0x74: {NOP, 0x74, ZeroPageX, 4, (*CPU6502).ign},
+	0xD4: {NOP, 0xD4, ZeroPageX, 4, (*CPU6502).ign},
+	0xF4: {NOP, 0xF4, ZeroPageX, 4, (*CPU6502).ign},
+	0x0C: {NOP, 0x0C, Absolute, 4, (*CPU6502).ign},
+	0x1C: {NOP, 0x1C, AbsoluteX, 4, (*CPU6502).ign},
+	0x3C: {NOP, 0x3C, AbsoluteX, 4, (*CPU6502).ign},
+	0x5C: {NOP, 0x5C, AbsoluteX, 4, (*CPU6502).ign},
+	0x7C: {NOP, 0x7C, AbsoluteX, 4, (*CPU6502).ign},
+	0xDC: {NOP, 0xDC, AbsoluteX, 4, (*CPU6502).ign},
+	0xFC: {NOP, 0xFC, AbsoluteX, 4, (*CPU6502).ign},
+	0x27: {RLA, 0x27, ZeroPage, 5, (*CPU6502).rla},
+	0x37: {RLA, 0x37, ZeroPageX, 6, (*CPU6502).rla},
+	0x2F: {RLA, 0x2F, Absolute, 6, (*CPU6502).rla},
+	0x3F: {RLA, 0x3F, AbsoluteX, 7, (*CPU6502).rla},
+	0x3B: {RLA, 0x3B, AbsoluteY, 7, (*CPU6502).rla},
+	0x23: {RLA, 0x23, IndexedIndirect, 8, (*CPU6502).rla},
+	0x33: {RLA, 0x33, IndirectIndexed, 8, (*CPU6502).rla},
+	0x67: {RRA, 0x67, ZeroPage, 5, (*CPU6502).rra},
+	0x77: {RRA, 0x77, ZeroPageX, 6, (*CPU6502).rra},
+	0x6F: {RRA, 0x6F, Absolute, 6, (*CPU6502).rra},
+	0x7F: {RRA, 0x7F, AbsoluteX, 7, (*CPU6502).rra},
+	0x7B: {RRA, 0x7B, AbsoluteY, 7, (*CPU6502).rra},
+	0x63: {RRA, 0x63, IndexedIndirect, 8, (*CPU6502).rra},
+	0x73: {RRA, 0x73, IndirectIndexed, 8, (*CPU6502).rra},
+	0x87: {SAX, 0x87, ZeroPage, 3, (*CPU6502).sax},
+	0x97: {SAX, 0x97, ZeroPageY, 4, (*CPU6502).sax},
+	0x8F: {SAX, 0x8F, Absolute, 4, (*CPU6502).sax},
+	0x83: {SAX, 0x83, IndexedIndirect, 6, (*CPU6502).sax},
+	0xEB: {SBC, 0xEB, Immediate, 2, (*CPU6502).sbc},
+	0x9E: {SHX, 0x9E, AbsoluteY, 5, (*CPU6502).shx},
+	0x9C: {SHY, 0x9C, AbsoluteX, 5, (*CPU6502).shy},
+	0x07: {SLO, 0x07, ZeroPage, 5, (*CPU6502).slo},
+	0x17: {SLO, 0x17, ZeroPageX, 6, (*CPU6502).slo},
+	0x0F: {SLO, 0x0F, Absolute, 6, (*CPU6502).slo},
+	0x1F: {SLO, 0x1F, AbsoluteX, 7, (*CPU6502).slo},
+	0x1B: {SLO, 0x1B, AbsoluteY, 7, (*CPU6502).slo},
+	0x03: {SLO, 0x03, IndexedIndirect, 8, (*CPU6502).slo},
+	0x13: {SLO, 0x13, IndirectIndexed, 8, (*CPU6502).slo},
+	0x47: {SRE, 0x47, ZeroPage, 5, (*CPU6502).sre},
+	0x57: {SRE, 0x57, ZeroPageX, 6, (*CPU6502).sre},
+	0x4F: {SRE, 0x4F, Absolute, 6, (*CPU6502).sre},
+	0x5F: {SRE, 0x5F, AbsoluteX, 7, (*CPU6502).sre},
+	0x5B: {SRE, 0x5B, AbsoluteY, 7, (*CPU6502).sre},
+	0x43: {SRE, 0x43, IndexedIndirect, 8, (*CPU6502).sre},
+	0x53: {SRE, 0x53, IndirectIndexed, 8, (*CPU6502).sre},
+	0x9B: {TAS, 0x9B, AbsoluteY, 5, (*CPU6502).tas},
+	0x8B: {XAA, 0x8B, Immediate, 2, (*CPU6502).xaa},
+}
+
+// IsUnofficial reports whether opcode is an unofficial opcode.
+func IsUnofficial(opcode byte) bool {
+	return UnofficialInstructionTable[opcode].Execute != nil
+}
+
+// unstableMagic is the constant ORed into the accumulator by the unstable
+// XAA and LAX #imm opcodes. The real value depends on the chip and its
+// temperature; $EE is what most emulators settle on.
+const unstableMagic byte = 0xEE
+
+// --- Unofficial instructions ---
+
+// ahx stores A AND X AND (the high byte of the base address + 1).
+func (c *CPU6502) ahx() int {
+	c.storeHighAnd(c.a&c.x, c.y)
+	return 0
+}
+
+// alr ANDs the fetched value into the accumulator, then shifts it right.
+func (c *CPU6502) alr() int {
+	c.a &= c.fetch()
+	c.SetFlag(FlagC, c.a&0x01 != 0)
+	c.a >>= 1
+	c.setZN(c.a)
+	return 0
+}
+
+// anc ANDs the fetched value into the accumulator and copies bit 7 of the
+// result into the carry flag.
+func (c *CPU6502) anc() int {
+	c.a &= c.fetch()
+	c.setZN(c.a)
+	c.SetFlag(FlagC, c.a&0x80 != 0)
+	return 0
+}
+
+// arr ANDs the fetched value into the accumulator, then rotates it right.
+//
+// The carry flag is taken from bit 6 of the result and the overflow flag
+// from bit 6 XOR bit 5.
+func (c *CPU6502) arr() int {
+	c.a &= c.fetch()
+	c.a >>= 1
+	if c.GetFlag(FlagC) {
+		c.a |= 0x80
+	}
+	c.setZN(c.a)
+	c.SetFlag(FlagC, c.a&0x40 != 0)
+	c.SetFlag(FlagV, (c.a>>6^c.a>>5)&0x01 != 0)
+	return 0
+}
+
+// axs sets X to (A AND X) minus the fetched value, without borrow.
+func (c *CPU6502) axs() int {
+	value := c.fetch()
+	ax := c.a & c.x
+	c.SetFlag(FlagC, ax >= value)
+	c.x = ax - value
+	c.setZN(c.x)
+	return 0
+}
+
+// dcp decrements the value at the effective address, then compares it
+// with the accumulator.
+func (c *CPU6502) dcp() int {
+	value := c.fetch() - 1
+	c.bus.Write(c.absoluteAddress, value)
+	c.compare(c.a, value)
+	return 0
+}
+
+// ign is the NOP with a memory operand. Unlike the official NOP it reads
+// its operand, which matters for registers with read side effects, and
+// takes the extra cycle of a read when indexing crosses a page boundary.
+func (c *CPU6502) ign() int {
+	c.fetch()
+	return 1
+}
+
+// isc increments the value at the effective address, then subtracts it
+// from the accumulator.
+func (c *CPU6502) isc() int {
+	value := c.fetch() + 1
+	c.bus.Write(c.absoluteAddress, value)
+	c.addWithCarry(value ^ 0xFF)
+	return 0
+}
+
+// kil jams the CPU. Only a reset brings it back.
+func (c *CPU6502) kil() int {
+	c.halt(true)
+	return 0
+}
+
+// las ANDs the fetched value with the stack pointer and loads the result
+// into A, X and the stack pointer.
+func (c *CPU6502) las() int {
+	value := c.fetch() & c.stackPointer
+	c.a = value
+	c.x = value
+	c.stackPointer = value
+	c.setZN(value)
+	return 1
+}
+
+// lax loads the fetched value into both the accumulator and X.
+func (c *CPU6502) lax() int {
+	c.a = c.fetch()
+	c.x = c.a
+	c.setZN(c.a)
+	return 1
+}
+
+// lxa is the immediate form of LAX, which mixes in the unstable magic
+// constant the same way XAA does.
+func (c *CPU6502) lxa() int {
+	c.a = (c.a | unstableMagic) & c.fetch()
+	c.x = c.a
+	c.setZN(c.a)
+	return 0
+}
+
+// rla rotates the value at the effective address left, then ANDs it into
+// the accumulator.
+func (c *CPU6502) rla() int {
+	value := c.fetch()
+	result := value << 1
+	if c.GetFlag(FlagC) {
+		result |= 0x01
+	}
+	c.SetFlag(FlagC, value&0x80 != 0)
+	c.bus.Write(c.absoluteAddress, result)
+
+	c.a &= result
+	c.setZN(c.a)
+	return 0
+}
+
+// rra rotates the value at the effective address right, then adds it to
+// the accumulator using the carry the rotation produced.
+func (c *CPU6502) rra() int {
+	value := c.fetch()
+	result := value >> 1
+	if c.GetFlag(FlagC) {
+		result |= 0x80
+	}
+	c.SetFlag(FlagC, value&0x01 != 0)
+	c.bus.Write(c.absoluteAddress, result)
+
+	c.addWithCarry(result)
+	return 0
+}
+
+// sax stores A AND X at the effective address. No flags are affected.
+func (c *CPU6502) sax() int {
+	c.bus.Write(c.absoluteAddress, c.a&c.x)
+	return 0
+}
+
+// shx stores X AND (the high byte of the base address + 1).
+func (c *CPU6502) shx() int {
+	c.storeHighAnd(c.x, c.y)
+	return 0
+}
+
+// shy stores Y AND (the high byte of the base address + 1).
+func (c *CPU6502) shy() int {
+	c.storeHighAnd(c.y, c.x)
+	return 0
+}
+
+// slo shifts the value at the effective address left, then ORs it into
+// the accumulator.
+func (c *CPU6502) slo() int {
+	value := c.fetch()
+	c.SetFlag(FlagC, value&0x80 != 0)
+	value <<= 1
+	c.bus.Write(c.absoluteAddress, value)
+
+	c.a |= value
+	c.setZN(c.a)
+	return 0
+}
+
+// sre shifts the value at the effective address right, then XORs it into
+// the accumulator.
+func (c *CPU6502) sre() int {
+	value := c.fetch()
+	c.SetFlag(FlagC, value&0x01 != 0)
+	value >>= 1
+	c.bus.Write(c.absoluteAddress, value)
+
+	c.a ^= value
+	c.setZN(c.a)
+	return 0
+}
+
+// tas sets the stack pointer to A AND X, then stores it AND (the high byte
+// of the base address + 1).
+func (c *CPU6502) tas() int {
+	c.stackPointer = c.a & c.x
+	c.storeHighAnd(c.stackPointer, c.y)
+	return 0
+}
+
+// xaa sets the accumulator to (A OR magic) AND X AND the fetched value.
+func (c *CPU6502) xaa() int {
+	c.a = (c.a | unstableMagic) & c.x & c.fetch()
+	c.setZN(c.a)
+	return 0
+}
+
+// storeHighAnd implements the store behaviour shared by AHX, SHX, SHY and
+// TAS: value is ANDed with the high byte of the unindexed base address plus
+// one. When indexing crosses a page boundary, the high byte of the target
+// address is replaced by the stored value.
+func (c *CPU6502) storeHighAnd(value byte, index byte) {
+	base := c.absoluteAddress - uint16(index)
+	value &= byte(base>>8) + 1
+
+	addr := c.absoluteAddress
+	if addr&0xFF00 != base&0xFF00 {
+		addr = uint16(value)<<8 | addr&0x00FF
+	}
+	c.bus.Write(addr, value)
+}
+
+// halt stops the CPU at the current opcode until the next reset.
+func (c *CPU6502) halt(jammed bool) {
+	c.programCounter--
+	c.haltError = &HaltError{
+		Opcode:  c.opcode,
+		Address: c.programCounter,
+		Jammed:  jammed,
+	}
+}
@@ -0,0 +1,262 @@
+package cpu
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestUnofficialOpcodes(t *testing.T) {
+	const flags = FlagC | FlagZ | FlagV | FlagN
+
+	tests := []struct {
+		name    string
+		program []byte
+		setup   func(c *CPU6502, bus *benchBus)
+		cycles  int
+		a, x    byte
+		mem     byte // Value at $0010 afterwards
+		status  byte // C, Z, V and N afterwards
+	}{
+		{
+			name: "LAX zero page", program: []byte{0xA7, 0x10},
+			setup:  func(c *CPU6502, bus *benchBus) { bus[0x10] = 0x80 },
+			cycles: 3, a: 0x80, x: 0x80, mem: 0x80, status: FlagN,
+		},
+		{
+			name: "SAX zero page", program: []byte{0x87, 0x10},
+			setup: func(c *CPU6502, bus *benchBus) {
+				c.SetRegister(RegA, 0xF0)
+				c.SetRegister(RegX, 0x3C)
+			},
+			cycles: 3, a: 0xF0, x: 0x3C, mem: 0x30,
+		},
+		{
+			name: "DCP zero page", program: []byte{0xC7, 0x10},
+			setup: func(c *CPU6502, bus *benchBus) {
+				bus[0x10] = 0x41
+				c.SetRegister(RegA, 0x40)
+			},
+			cycles: 5, a: 0x40, mem: 0x40, status: FlagC | FlagZ,
+		},
+		{
+			name: "DCP absolute,X takes no extra cycle across a page", program: []byte{0xDF, 0xFF, 0xFF},
+			setup: func(c *CPU6502, bus *benchBus) {
+				bus[0x10] = 0x00
+				c.SetRegister(RegX, 0x11)
+				c.SetRegister(RegA, 0x01)
+			},
+			cycles: 7, a: 0x01, x: 0x11, mem: 0xFF,
+		},
+		{
+			name: "ISC zero page", program: []byte{0xE7, 0x10},
+			setup: func(c *CPU6502, bus *benchBus) {
+				bus[0x10] = 0x0F
+				c.SetRegister(RegA, 0x20)
+				c.SetFlag(FlagC, true)
+			},
+			cycles: 5, a: 0x10, mem: 0x10, status: FlagC,
+		},
+		{
+			name: "SLO zero page", program: []byte{0x07, 0x10},
+			setup: func(c *CPU6502, bus *benchBus) {
+				bus[0x10] = 0x81
+				c.SetRegister(RegA, 0x01)
+			},
+			cycles: 5, a: 0x03, mem: 0x02, status: FlagC,
+		},
+		{
+			name: "RLA zero page", program: []byte{0x27, 0x10},
+			setup: func(c *CPU6502, bus *benchBus) {
+				bus[0x10] = 0x81
+				c.SetRegister(RegA, 0xFF)
+			},
+			cycles: 5, a: 0x02, mem: 0x02, status: FlagC,
+		},
+		{
+			name: "SRE zero page", program: []byte{0x47, 0x10},
+			setup: func(c *CPU6502, bus *benchBus) {
+				bus[0x10] = 0x03
+				c.SetRegister(RegA, 0xFF)
+			},
+			cycles: 5, a: 0xFE, mem: 0x01, status: FlagC | FlagN,
+		},
+		{
+			name: "RRA zero page", program: []byte{0x67, 0x10},
+			setup: func(c *CPU6502, bus *benchBus) {
+				bus[0x10] = 0x02
+				c.SetRegister(RegA, 0x10)
+				c.SetFlag(FlagC, true)
+			},
+			cycles: 5, a: 0x91, mem: 0x81, status: FlagN,
+		},
+		{
+			name: "ANC immediate", program: []byte{0x0B, 0x80},
+			setup:  func(c *CPU6502, bus *benchBus) { c.SetRegister(RegA, 0xFF) },
+			cycles: 2, a: 0x80, status: FlagC | FlagN,
+		},
+		{
+			name: "ALR immediate", program: []byte{0x4B, 0x03},
+			setup:  func(c *CPU6502, bus *benchBus) { c.SetRegister(RegA, 0xFF) },
+			cycles: 2, a: 0x01, status: FlagC,
+		},
+		{
+			name: "ARR immediate", program: []byte{0x6B, 0xFF},
+			setup: func(c *CPU6502, bus *benchBus) {
+				c.SetRegister(RegA, 0xC0)
+				c.SetFlag(FlagC, true)
+			},
+			cycles: 2, a: 0xE0, status: FlagC | FlagN,
+		},
+		{
+			name: "AXS immediate", program: []byte{0xCB, 0x10},
+			setup: func(c *CPU6502, bus *benchBus) {
+				c.SetRegister(RegA, 0xFF)
+				c.SetRegister(RegX, 0x30)
+			},
+			cycles: 2, a: 0xFF, x: 0x20, status: FlagC,
+		},
+		{
+			name: "NOP absolute,X across a page", program: []byte{0x1C, 0xFF, 0x02},
+			setup:  func(c *CPU6502, bus *benchBus) { c.SetRegister(RegX, 0x01) },
+			cycles: 5, x: 0x01,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, bus := newTestCPU(test.program...)
+			c.Step()
+			c.SetRegister(RegP, FlagI|FlagU)
+			test.setup(c, bus)
+
+			if cycles := c.Step(); cycles != test.cycles {
+				t.Errorf("took %d cycles, want %d", cycles, test.cycles)
+			}
+			if c.Halted() {
+				t.Fatalf("halted: %v", c.HaltReason())
+			}
+			if a := c.GetRegister(RegA); a != test.a {
+				t.Errorf("A = $%02X, want $%02X", a, test.a)
+			}
+			if x := c.GetRegister(RegX); x != test.x {
+				t.Errorf("X = $%02X, want $%02X", x, test.x)
+			}
+			if bus[0x10] != test.mem {
+				t.Errorf("$0010 = $%02X, want $%02X", bus[0x10], test.mem)
+			}
+			if status := c.GetRegister(RegP) & flags; status != test.status {
+				t.Errorf("status = %08b, want %08b", status, test.status)
+			}
+		})
+	}
+}
+
+func TestHalt(t *testing.T) {
+	tests := []struct {
+		name    string
+		program []byte
+		trap    bool
+		jammed  bool
+	}{
+		{"KIL", []byte{0x02}, false, true},
+		{"KIL while trapping", []byte{0x02}, true, false},
+		{"unofficial opcode while trapping", []byte{0xA7, 0x10}, true, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, bus := newTestCPU(test.program...)
+			if test.trap {
+				c.SetUnofficialOpcodeMode(UnofficialTrap)
+			}
+			bus[0x10] = 0x55
+			c.Step()
+			c.Step()
+
+			if !c.Halted() {
+				t.Fatal("not halted")
+			}
+			var halt *HaltError
+			if !errors.As(c.HaltReason(), &halt) {
+				t.Fatalf("HaltReason() = %v, want a *HaltError", c.HaltReason())
+			}
+			want := HaltError{Opcode: test.program[0], Address: testProgram, Jammed: test.jammed}
+			if *halt != want {
+				t.Errorf("HaltReason() = %+v, want %+v", *halt, want)
+			}
+			if c.GetRegister(RegA) != 0 {
+				t.Error("halting opcode was executed")
+			}
+
+			// Time passes, but the CPU stays where it stopped
+			before := c.GetTotalCycles()
+			for i := 0; i < 10; i++ {
+				c.Clock()
+			}
+			if total := c.GetTotalCycles() - before; total != 10 {
+				t.Errorf("total cycles grew by %d while halted, want 10", total)
+			}
+			if c.GetPC() != testProgram {
+				t.Errorf("PC = $%04X while halted, want $%04X", c.GetPC(), testProgram)
+			}
+
+			c.Reset()
+			if c.Halted() || c.HaltReason() != nil {
+				t.Error("still halted after reset")
+			}
+		})
+	}
+}
+
+func TestTrapRunsOfficialOpcodes(t *testing.T) {
+	c, _ := newTestCPU(0xA9, 0x42, 0xEA)
+	c.SetUnofficialOpcodeMode(UnofficialTrap)
+	c.Step()
+	c.Step()
+	c.Step()
+	if c.Halted() {
+		t.Fatalf("halted: %v", c.HaltReason())
+	}
+	if a := c.GetRegister(RegA); a != 0x42 {
+		t.Errorf("A = $%02X, want $42", a)
+	}
+}
+
+func TestUnofficialNOPCycles(t *testing.T) {
+	type nopTest struct {
+		name    string
+		program []byte
+		x       byte
+		cycles  int
+	}
+	tests := []nopTest{
+		{"implied", []byte{0x1A}, 0x00, 2},
+		{"immediate", []byte{0x80, 0xFF}, 0x00, 2},
+		{"zero page", []byte{0x04, 0x10}, 0x00, 3},
+		{"zero page,X", []byte{0x14, 0xFF}, 0x01, 4},
+		{"absolute", []byte{0x0C, 0xFF, 0x02}, 0x00, 4},
+	}
+	// The absolute,X NOPs read like LDA, so crossing a page costs a cycle
+	for _, opcode := range []byte{0x1C, 0x3C, 0x5C, 0x7C, 0xDC, 0xFC} {
+		tests = append(tests,
+			nopTest{fmt.Sprintf("$%02X absolute,X", opcode), []byte{opcode, 0xFE, 0x02}, 0x01, 4},
+			nopTest{fmt.Sprintf("$%02X absolute,X across a page", opcode), []byte{opcode, 0xFF, 0x02}, 0x01, 5},
+		)
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, _ := newTestCPU(test.program...)
+			c.Step()
+			c.SetRegister(RegX, test.x)
+
+			if cycles := c.Step(); cycles != test.cycles {
+				t.Errorf("took %d cycles, want %d", cycles, test.cycles)
+			}
+			if want := testProgram + uint16(len(test.program)); c.GetPC() != want {
+				t.Errorf("PC = $%04X, want $%04X", c.GetPC(), want)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	cpu6502 "github.com/drewwalton19216801/gones/cpu"
+)
+
+// runDisasm implements the disasm subcommand, which prints a listing of the
+// PRG ROM banks of an iNES file, which may be in an archive.
+func runDisasm(args []string) int {
+	flags := newFlagSet("disasm", "[flags] <rom> [zip entry]")
+	applyGameDB := gameDBFlags(flags)
+
+	positional, err := parseArgs(flags, args)
+	if err != nil {
+		return flagError(err)
+	}
+	if err := applyGameDB(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	romPath, entry, ok := romArgs(flags, positional)
+	if !ok {
+		return exitUsage
+	}
+
+	// Disassembly only needs the PRG ROM, so the mapper need not be
+	// supported
+	cart, err := loadROMImage(romPath, entry)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	if err := disassemblePRG(os.Stdout, cart); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	return exitOK
+}
+
+// disassemblePRG writes a listing of every PRG bank of cart to w.
+//
+// Each 16KB bank is listed at the address it is most likely mapped to: the
+// last bank at $C000, where the vectors live, and every other bank at
+// $8000. The entry points named by the reset, NMI and IRQ vectors are
+// labelled, and so are the branches and jumps that lead to them.
+func disassemblePRG(w io.Writer, cart *Cartridge) error {
+	const bankSize = 0x4000
+
+	banks := len(cart.prgMemory) / bankSize
+	if banks == 0 {
+		return fmt.Errorf("cartridge has no PRG ROM")
+	}
+
+	// The vectors occupy the last six bytes of the last bank
+	last := cart.prgMemory[(banks-1)*bankSize : banks*bankSize]
+	vectors := []struct {
+		name string
+		addr uint16
+	}{
+		{"nmi", 0xFFFA},
+		{"reset", 0xFFFC},
+		{"irq", 0xFFFE},
+	}
+	labels := map[uint16][]string{}
+	for i, vector := range vectors {
+		offset := bankSize - 6 + i*2
+		target := uint16(last[offset+1])<<8 | uint16(last[offset])
+		labels[target] = append(labels[target], vector.name)
+	}
+
+	for bank := 0; bank < banks; bank++ {
+		base := uint16(0x8000)
+		code := cart.prgMemory[bank*bankSize : (bank+1)*bankSize]
+		if bank == banks-1 {
+			base = 0xC000
+			code = code[:bankSize-6]
+		}
+
+		fmt.Fprintf(w, "; PRG bank %d at $%04X-$%04X\n", bank, base, int(base)+bankSize-1)
+		for _, instruction := range cpu6502.Disassemble(code, base) {
+			for _, label := range labels[instruction.Address] {
+				fmt.Fprintf(w, "%s:\n", label)
+			}
+
+			line := instruction.String()
+			if names, ok := labels[instruction.Target]; ok && transfersControl(instruction) {
+				line = fmt.Sprintf("%-32s ; %s", line, strings.Join(names, ", "))
+			}
+			fmt.Fprintln(w, line)
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintln(w, "; Vectors")
+	for i, vector := range vectors {
+		offset := bankSize - 6 + i*2
+		target := uint16(last[offset+1])<<8 | uint16(last[offset])
+		fmt.Fprintf(w, "%04X  %02X %02X     .word $%04X ; %s\n",
+			vector.addr, last[offset], last[offset+1], target, vector.name)
+	}
+	return nil
+}
+
+// transfersControl reports whether the target of instruction is code
+// rather than data.
+func transfersControl(instruction cpu6502.DisassembledInstruction) bool {
+	switch instruction.Instruction {
+	case cpu6502.JMP, cpu6502.JSR:
+		return instruction.Mode == cpu6502.Absolute
+	default:
+		return instruction.Mode == cpu6502.Relative
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunDisasm(t *testing.T) {
+	dir := t.TempDir()
+	writeImage := func(name string, image []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, image, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	nrom := writeImage("nrom.nes", testImage(t, 0, 1, 1, []byte{0xEA}))
+	mmc5 := writeImage("mmc5.nes", testImage(t, 5, 2, 1, []byte{0xEA}))
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"supported mapper", []string{nrom}, exitOK},
+		{"unsupported mapper", []string{mmc5}, exitOK},
+		{"missing ROM", []string{filepath.Join(dir, "missing.nes")}, exitError},
+		{"no ROM", nil, exitUsage},
+	}
+
+	// Keep the listings out of the test output
+	stdout := os.Stdout
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devNull.Close()
+	os.Stdout = devNull
+	defer func() { os.Stdout = stdout }()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := runDisasm(test.args); got != test.want {
+				t.Errorf("exit code %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDisassemblePRG(t *testing.T) {
+	cart := loadTestImage(t, testImage(t, 0, 2, 1, []byte{0x4C, 0x00, 0x80}))
+
+	var listing strings.Builder
+	if err := disassemblePRG(&listing, cart); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"; PRG bank 0 at $8000-$BFFF\nreset:\n8000  4C 00 80  JMP $8000        ; reset\n",
+		"; PRG bank 1 at $C000-$FFFF\n",
+		"FFFC  00 80     .word $8000 ; reset\n",
+	} {
+		if !strings.Contains(listing.String(), want) {
+			t.Errorf("listing does not contain %q", want)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The embedded database is generated from nes20db.xml, which must first be
+// downloaded into this directory.
+//go:generate go run gamedb_gen.go -local gamedb_local.xml nes20db.xml
+
+//go:embed gamedb.xml
+var embeddedGameDB []byte
+
+// gameDatabase is consulted by the cartridge loader to correct bad
+// headers. A nil database leaves headers as they are.
+var gameDatabase = mustParseGameDB(embeddedGameDB)
+
+// gameDBLog receives a line for every cartridge whose header the game
+// database corrects.
+var gameDBLog io.Writer = os.Stderr
+
+// gameEntry is what the game database knows about one game. Fields that
+// the database leaves out are nil.
+type gameEntry struct {
+	name string
+
+	mapper    *uint16
+	submapper *byte
+	mirror    *Mirror
+	battery   *bool
+
+	prgRAMSize   *int
+	prgNVRAMSize *int
+	chrRAMSize   *int
+	chrNVRAMSize *int
+
+	timing  *TimingMode
+	console *ConsoleType
+}
+
+// gameDB looks up games by the checksums of their ROM.
+type gameDB struct {
+	bySHA1  map[[20]byte]*gameEntry
+	byCRC32 map[uint32]*gameEntry
+}
+
+// lookup finds the game whose ROM has the given checksums, preferring a
+// SHA-1 match as CRC32s can collide.
+func (db *gameDB) lookup(checksums ROMChecksums) (*gameEntry, bool) {
+	if game, ok := db.bySHA1[checksums.SHA1]; ok {
+		return game, true
+	}
+	game, ok := db.byCRC32[checksums.CRC32]
+	return game, ok
+}
+
+// The XML structure of nes20db.xml. Only the elements used to correct
+// headers are decoded.
+type gameDBXML struct {
+	Games []gameXML `xml:"game"`
+}
+
+type gameXML struct {
+	Name     string      `xml:",comment"`
+	ROM      romXML      `xml:"rom"`
+	PRGRAM   *sizeXML    `xml:"prgram"`
+	PRGNVRAM *sizeXML    `xml:"prgnvram"`
+	CHRRAM   *sizeXML    `xml:"chrram"`
+	CHRNVRAM *sizeXML    `xml:"chrnvram"`
+	PCB      *pcbXML     `xml:"pcb"`
+	Console  *consoleXML `xml:"console"`
+}
+
+type romXML struct {
+	CRC32 string `xml:"crc32,attr"`
+	SHA1  string `xml:"sha1,attr"`
+}
+
+type sizeXML struct {
+	Size int `xml:"size,attr"`
+}
+
+type pcbXML struct {
+	Mapper    *uint16 `xml:"mapper,attr"`
+	Submapper *byte   `xml:"submapper,attr"`
+	Mirroring string  `xml:"mirroring,attr"`
+	Battery   *int    `xml:"battery,attr"`
+}
+
+type consoleXML struct {
+	Type   *int `xml:"type,attr"`
+	Region *int `xml:"region,attr"`
+}
+
+// mustParseGameDB parses the embedded database, which is known to be
+// valid.
+func mustParseGameDB(data []byte) *gameDB {
+	db, err := parseGameDB(data)
+	if err != nil {
+		panic(fmt.Sprintf("embedded game database: %v", err))
+	}
+	return db
+}
+
+// loadGameDB reads a game database in the nes20db.xml format from a file.
+func loadGameDB(path string) (*gameDB, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	db, err := parseGameDB(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return db, nil
+}
+
+// parseGameDB parses a game database in the nes20db.xml format.
+func parseGameDB(data []byte) (*gameDB, error) {
+	var dbXML gameDBXML
+	if err := xml.Unmarshal(data, &dbXML); err != nil {
+		return nil, err
+	}
+
+	db := &gameDB{
+		bySHA1:  make(map[[20]byte]*gameEntry),
+		byCRC32: make(map[uint32]*gameEntry),
+	}
+	for i, gameXML := range dbXML.Games {
+		game, err := newGameEntry(gameXML)
+		if err != nil {
+			return nil, fmt.Errorf("game %d: %w", i+1, err)
+		}
+
+		if gameXML.ROM.SHA1 != "" {
+			sum, err := hex.DecodeString(gameXML.ROM.SHA1)
+			if err != nil || len(sum) != 20 {
+				return nil, fmt.Errorf("game %d (%s): bad SHA-1 %q", i+1, game.name, gameXML.ROM.SHA1)
+			}
+			db.bySHA1[[20]byte(sum)] = game
+		}
+		if gameXML.ROM.CRC32 != "" {
+			crc, err := strconv.ParseUint(gameXML.ROM.CRC32, 16, 32)
+			if err != nil {
+				return nil, fmt.Errorf("game %d (%s): bad CRC32 %q", i+1, game.name, gameXML.ROM.CRC32)
+			}
+			db.byCRC32[uint32(crc)] = game
+		}
+	}
+	return db, nil
+}
+
+// newGameEntry converts a game from the XML form.
+func newGameEntry(gameXML gameXML) (*gameEntry, error) {
+	game := &gameEntry{name: strings.TrimSpace(gameXML.Name)}
+
+	if pcb := gameXML.PCB; pcb != nil {
+		game.mapper = pcb.Mapper
+		game.submapper = pcb.Submapper
+		if pcb.Battery != nil {
+			battery := *pcb.Battery != 0
+			game.battery = &battery
+		}
+
+		// Other values describe mapper-controlled mirroring, which the
+		// header can't express either
+		mirrors := map[string]Mirror{"H": Horizontal, "V": Vertical, "4": FourScreen}
+		if mirror, ok := mirrors[pcb.Mirroring]; ok {
+			game.mirror = &mirror
+		}
+	}
+
+	size := func(s *sizeXML) *int {
+		if s == nil {
+			return nil
+		}
+		return &s.Size
+	}
+	game.prgRAMSize = size(gameXML.PRGRAM)
+	game.prgNVRAMSize = size(gameXML.PRGNVRAM)
+	game.chrRAMSize = size(gameXML.CHRRAM)
+	game.chrNVRAMSize = size(gameXML.CHRNVRAM)
+
+	if console := gameXML.Console; console != nil {
+		if console.Type != nil {
+			if *console.Type < 0 || *console.Type > int(ConsoleExtended) {
+				return nil, fmt.Errorf("%s: bad console type %d", game.name, *console.Type)
+			}
+			consoleType := ConsoleType(*console.Type)
+			game.console = &consoleType
+		}
+		if console.Region != nil {
+			if *console.Region < 0 || *console.Region > int(TimingDendy) {
+				return nil, fmt.Errorf("%s: bad region %d", game.name, *console.Region)
+			}
+			timing := TimingMode(*console.Region)
+			game.timing = &timing
+		}
+	}
+	return game, nil
+}
+
+// correct overrides the parts of info the database knows better, and
+// returns a description of each change.
+func (game *gameEntry) correct(info *CartridgeInfo) []string {
+	var changes []string
+	change := func(field string, from, to any) {
+		changes = append(changes, fmt.Sprintf("%s %v -> %v", field, from, to))
+	}
+
+	if game.mapper != nil && *game.mapper != info.Mapper {
+		change("mapper", info.Mapper, *game.mapper)
+		info.Mapper = *game.mapper
+	}
+	if game.submapper != nil && *game.submapper != info.Submapper {
+		change("submapper", info.Submapper, *game.submapper)
+		info.Submapper = *game.submapper
+	}
+	if game.mirror != nil && *game.mirror != info.Mirror {
+		change("mirroring", info.Mirror, *game.mirror)
+		info.Mirror = *game.mirror
+		info.FourScreen = info.Mirror == FourScreen
+	}
+	if game.battery != nil && *game.battery != info.Battery {
+		change("battery", info.Battery, *game.battery)
+		info.Battery = *game.battery
+	}
+
+	sizes := []struct {
+		field string
+		db    *int
+		info  *int
+	}{
+		{"PRG RAM", game.prgRAMSize, &info.PRGRAMSize},
+		{"PRG NVRAM", game.prgNVRAMSize, &info.PRGNVRAMSize},
+		{"CHR RAM", game.chrRAMSize, &info.CHRRAMSize},
+		{"CHR NVRAM", game.chrNVRAMSize, &info.CHRNVRAMSize},
+	}
+	for _, size := range sizes {
+		if size.db != nil && *size.db != *size.info {
+			change(size.field, formatSize(*size.info), formatSize(*size.db))
+			*size.info = *size.db
+		}
+	}
+
+	if game.timing != nil && *game.timing != info.Timing {
+		change("region", info.Timing, *game.timing)
+		info.Timing = *game.timing
+	}
+	if game.console != nil && *game.console != info.Console {
+		change("console", info.Console, *game.console)
+		info.Console = *game.console
+	}
+	return changes
+}
+
+// applyGameDB corrects a cartridge's header from the game database, and
+// logs what was changed.
+func (c *Cartridge) applyGameDB(db *gameDB) {
+	checksums := c.checksums()
+	game, ok := db.lookup(checksums)
+	if !ok {
+		return
+	}
+
+	changes := game.correct(&c.info)
+	if len(changes) == 0 {
+		return
+	}
+	c.mirror = c.info.Mirror
+
+	name := game.name
+	if name == "" {
+		name = fmt.Sprintf("CRC32 %08X", checksums.CRC32)
+	}
+	fmt.Fprintf(gameDBLog, "Game database corrected header for %s: %s\n", name, strings.Join(changes, ", "))
+}
@@ -0,0 +1,177 @@
+//go:build ignore
+
+// gamedb_gen builds the embedded game database, gamedb.xml, from the NES
+// 2.0 header database.
+//
+// The full nes20db.xml is several megabytes, most of it games whose iNES
+// 1.0 headers already say all there is to say. Only games that an iNES 1.0
+// header can't fully describe are kept: those with a submapper, a mapper
+// above 255, RAM other than the 8K iNES 1.0 assumes, four-screen
+// mirroring, or a region or console other than an NTSC NES. Every game in
+// the -local files is kept as it is.
+//
+// Usage:
+//
+//	go run gamedb_gen.go [-o gamedb.xml] [-local file]... [nes20db.xml]...
+package main
+
+import (
+	"bufio"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// The parts of nes20db.xml the filter looks at. Every game is written out
+// whole from its inner XML.
+type database struct {
+	Games []game `xml:"game"`
+}
+
+type game struct {
+	Inner    string `xml:",innerxml"`
+	PRGRAM   *size  `xml:"prgram"`
+	PRGNVRAM *size  `xml:"prgnvram"`
+	CHRRAM   *size  `xml:"chrram"`
+	CHRNVRAM *size  `xml:"chrnvram"`
+	PCB      struct {
+		Mapper    int    `xml:"mapper,attr"`
+		Submapper int    `xml:"submapper,attr"`
+		Mirroring string `xml:"mirroring,attr"`
+	} `xml:"pcb"`
+	Console struct {
+		Type   int `xml:"type,attr"`
+		Region int `xml:"region,attr"`
+	} `xml:"console"`
+}
+
+type size struct {
+	Size int `xml:"size,attr"`
+}
+
+// inesRAMSize is the PRG RAM an iNES 1.0 header implies, and the CHR RAM
+// a board without CHR ROM is assumed to have.
+const inesRAMSize = 0x2000
+
+// needsNES20 says whether an iNES 1.0 header can't fully describe a game.
+func (g game) needsNES20() bool {
+	ramSize := func(s *size) int {
+		if s == nil {
+			return 0
+		}
+		return s.Size
+	}
+	prgRAM := ramSize(g.PRGRAM) + ramSize(g.PRGNVRAM)
+	chrRAM := ramSize(g.CHRRAM) + ramSize(g.CHRNVRAM)
+
+	return g.PCB.Submapper != 0 || g.PCB.Mapper > 0xFF ||
+		(prgRAM != 0 && prgRAM != inesRAMSize) ||
+		(chrRAM != 0 && chrRAM != inesRAMSize) ||
+		g.PCB.Mirroring == "4" ||
+		g.Console.Type != 0 || g.Console.Region != 0
+}
+
+// header starts the generated file.
+const header = `<?xml version="1.0" encoding="UTF-8"?>
+<!--
+  Game database consulted when loading ROMs, in the format of the NES 2.0
+  header database (nes20db.xml). Games are identified by the <rom> element,
+  whose checksums cover the PRG ROM followed by the CHR ROM, without the
+  header or trainer. The full nes20db.xml can be used in place of this file
+  with the gamedb flag.
+
+  Generated by gamedb_gen.go from %s; do not edit.
+-->
+<nes20db>
+`
+
+// files collects the values of a repeated flag.
+type files []string
+
+func (f *files) String() string     { return strings.Join(*f, ",") }
+func (f *files) Set(s string) error { *f = append(*f, s); return nil }
+
+func main() {
+	output := flag.String("o", "gamedb.xml", "write the database to `file`")
+	var local files
+	flag.Var(&local, "local", "keep every game in `file`")
+	flag.Parse()
+
+	var games []game
+	for _, path := range local {
+		db, err := readDatabase(path)
+		if err != nil {
+			fail(err)
+		}
+		games = append(games, db.Games...)
+	}
+	for _, path := range flag.Args() {
+		db, err := readDatabase(path)
+		if err != nil {
+			fail(err)
+		}
+		kept := 0
+		for _, g := range db.Games {
+			if g.needsNES20() {
+				games = append(games, g)
+				kept++
+			}
+		}
+		fmt.Fprintf(os.Stderr, "%s: kept %d of %d games\n", path, kept, len(db.Games))
+	}
+
+	sources := strings.Join(append(local, flag.Args()...), ", ")
+	if err := writeDatabase(*output, sources, games); err != nil {
+		fail(err)
+	}
+}
+
+func readDatabase(path string) (*database, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var db database
+	if err := xml.Unmarshal(data, &db); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &db, nil
+}
+
+func writeDatabase(path string, sources string, games []game) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	fmt.Fprintf(w, header, sources)
+	for _, g := range games {
+		writeGame(w, g)
+	}
+	fmt.Fprintln(w, "</nes20db>")
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// writeGame writes a game's elements one to a line, whatever the layout
+// of the file it came from.
+func writeGame(w io.Writer, g game) {
+	fmt.Fprintln(w, "  <game>")
+	for _, line := range strings.Split(g.Inner, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			fmt.Fprintf(w, "    %s\n", line)
+		}
+	}
+	fmt.Fprintln(w, "  </game>")
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "gamedb_gen:", err)
+	os.Exit(1)
+}
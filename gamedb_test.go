@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"strings"
+	"testing"
+)
+
+// testGameDB has one game with every correctable field, one identified
+// only by CRC32, and one that only sets the mirroring.
+const testGameDB = `<?xml version="1.0" encoding="UTF-8"?>
+<nes20db>
+  <game>
+    <!-- Everything -->
+    <rom size="40960" crc32="01234567" sha1="0123456789ABCDEF0123456789ABCDEF01234567"/>
+    <prgram size="8192"/>
+    <prgnvram size="32768"/>
+    <chrram size="16384"/>
+    <chrnvram size="0"/>
+    <pcb mapper="4" submapper="1" mirroring="4" battery="1"/>
+    <console type="1" region="3"/>
+  </game>
+  <game>
+    <!-- CRC32 only -->
+    <rom size="16384" crc32="89ABCDEF"/>
+    <pcb mapper="2" mirroring="V"/>
+  </game>
+  <game>
+    <!-- Mapper-controlled mirroring -->
+    <rom size="16384" crc32="00000001" sha1="FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF"/>
+    <pcb mapper="1" mirroring="M"/>
+  </game>
+</nes20db>`
+
+func sha1Sum(t *testing.T, s string) [20]byte {
+	t.Helper()
+	sum, err := hex.DecodeString(s)
+	if err != nil || len(sum) != 20 {
+		t.Fatalf("bad SHA-1 %q", s)
+	}
+	return [20]byte(sum)
+}
+
+func TestParseGameDBLookup(t *testing.T) {
+	db, err := parseGameDB([]byte(testGameDB))
+	if err != nil {
+		t.Fatalf("parseGameDB: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		checksums ROMChecksums
+		want      string // Name of the game found, or "" for none
+	}{
+		{
+			name:      "SHA-1 and CRC32",
+			checksums: ROMChecksums{CRC32: 0x01234567, SHA1: sha1Sum(t, "0123456789ABCDEF0123456789ABCDEF01234567")},
+			want:      "Everything",
+		},
+		{
+			name:      "SHA-1 wins over a colliding CRC32",
+			checksums: ROMChecksums{CRC32: 0x89ABCDEF, SHA1: sha1Sum(t, "0123456789ABCDEF0123456789ABCDEF01234567")},
+			want:      "Everything",
+		},
+		{
+			name:      "CRC32 only",
+			checksums: ROMChecksums{CRC32: 0x89ABCDEF},
+			want:      "CRC32 only",
+		},
+		{
+			name:      "miss",
+			checksums: ROMChecksums{CRC32: 0xDEADBEEF},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			game, ok := db.lookup(test.checksums)
+			if ok != (test.want != "") {
+				t.Fatalf("found %v, want %v", ok, test.want != "")
+			}
+			if ok && game.name != test.want {
+				t.Errorf("found %q, want %q", game.name, test.want)
+			}
+		})
+	}
+}
+
+func TestParseGameDBErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		xml  string
+		want string // Part of the error
+	}{
+		{"not XML", "<nes20db><game>", "XML syntax error"},
+		{"bad SHA-1", `<nes20db><game><rom sha1="1234"/></game></nes20db>`, "bad SHA-1"},
+		{"bad CRC32", `<nes20db><game><rom crc32="XYZ"/></game></nes20db>`, "bad CRC32"},
+		{"bad region", `<nes20db><game><rom crc32="1"/><console region="4"/></game></nes20db>`, "bad region"},
+		{"bad console type", `<nes20db><game><rom crc32="1"/><console type="9"/></game></nes20db>`, "bad console type"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := parseGameDB([]byte(test.xml))
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got error %v, want one containing %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestGameEntryCorrect(t *testing.T) {
+	db, err := parseGameDB([]byte(testGameDB))
+	if err != nil {
+		t.Fatalf("parseGameDB: %v", err)
+	}
+	everything, _ := db.lookup(ROMChecksums{CRC32: 0x01234567})
+	crcOnly, _ := db.lookup(ROMChecksums{CRC32: 0x89ABCDEF})
+	mapperMirroring, _ := db.lookup(ROMChecksums{CRC32: 0x00000001})
+
+	tests := []struct {
+		name    string
+		game    *gameEntry
+		info    CartridgeInfo
+		want    CartridgeInfo
+		changes []string
+	}{
+		{
+			name: "every field",
+			game: everything,
+			info: CartridgeInfo{Mapper: 1, Mirror: Horizontal, PRGRAMSize: 8192, CHRROMSize: 0, CHRRAMSize: 8192},
+			want: CartridgeInfo{
+				Mapper: 4, Submapper: 1, Mirror: FourScreen, FourScreen: true, Battery: true,
+				PRGRAMSize: 8192, PRGNVRAMSize: 32768, CHRRAMSize: 16384,
+				Timing: TimingDendy, Console: ConsoleVsSystem,
+			},
+			changes: []string{
+				"mapper 1 -> 4",
+				"submapper 0 -> 1",
+				"mirroring horizontal -> four-screen",
+				"battery false -> true",
+				"PRG NVRAM 0 bytes -> 32K",
+				"CHR RAM 8K -> 16K",
+				"region NTSC -> Dendy",
+				"console NES/Famicom -> Vs. System",
+			},
+		},
+		{
+			name: "mapper and mirroring",
+			game: crcOnly,
+			info: CartridgeInfo{Mapper: 0, Mirror: Horizontal, Battery: true},
+			want: CartridgeInfo{Mapper: 2, Mirror: Vertical, Battery: true},
+			changes: []string{
+				"mapper 0 -> 2",
+				"mirroring horizontal -> vertical",
+			},
+		},
+		{
+			name: "mapper-controlled mirroring leaves the header's",
+			game: mapperMirroring,
+			info: CartridgeInfo{Mapper: 1, Mirror: Vertical},
+			want: CartridgeInfo{Mapper: 1, Mirror: Vertical},
+		},
+		{
+			name: "header already right",
+			game: crcOnly,
+			info: CartridgeInfo{Mapper: 2, Mirror: Vertical},
+			want: CartridgeInfo{Mapper: 2, Mirror: Vertical},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			info := test.info
+			changes := test.game.correct(&info)
+			if info != test.want {
+				t.Errorf("got  %+v\nwant %+v", info, test.want)
+			}
+			if strings.Join(changes, "; ") != strings.Join(test.changes, "; ") {
+				t.Errorf("changes %q, want %q", changes, test.changes)
+			}
+		})
+	}
+}
+
+func TestApplyGameDB(t *testing.T) {
+	rom, err := os.ReadFile("test.nes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Claim mapper 1 with horizontal mirroring and PAL timing, where
+	// the game is NROM, vertical and NTSC
+	bad := bytes.Clone(rom)
+	bad[6] = 0x10
+	bad[9] = 0x01
+
+	tests := []struct {
+		name   string
+		image  []byte
+		db     *gameDB
+		want   CartridgeInfo
+		logged string
+	}{
+		{
+			name:   "bad header corrected",
+			image:  bad,
+			db:     gameDatabase,
+			want:   CartridgeInfo{Mapper: 0, Mirror: Vertical, Timing: TimingNTSC},
+			logged: "Game database corrected header for ram_after_reset (blargg): mapper 1 -> 0, mirroring horizontal -> vertical, region PAL -> NTSC\n",
+		},
+		{
+			name:  "good header left alone",
+			image: rom,
+			db:    gameDatabase,
+			want:  CartridgeInfo{Mapper: 0, Mirror: Vertical, Timing: TimingNTSC},
+		},
+		{
+			name:  "checksum miss",
+			image: bad,
+			db:    mustParseGameDB([]byte(testGameDB)),
+			want:  CartridgeInfo{Mapper: 1, Mirror: Horizontal, Timing: TimingPAL},
+		},
+		{
+			name:  "database disabled",
+			image: bad,
+			want:  CartridgeInfo{Mapper: 1, Mirror: Horizontal, Timing: TimingPAL},
+		},
+	}
+
+	savedDB, savedLog := gameDatabase, gameDBLog
+	defer func() { gameDatabase, gameDBLog = savedDB, savedLog }()
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var log strings.Builder
+			gameDatabase, gameDBLog = test.db, &log
+
+			cart, err := readImage(bytes.NewReader(test.image))
+			if err != nil {
+				t.Fatalf("readImage: %v", err)
+			}
+			info := cart.Info()
+			if info.Mapper != test.want.Mapper || info.Mirror != test.want.Mirror || info.Timing != test.want.Timing {
+				t.Errorf("mapper %d, %v, %v; want mapper %d, %v, %v",
+					info.Mapper, info.Mirror, info.Timing, test.want.Mapper, test.want.Mirror, test.want.Timing)
+			}
+			if cart.mirror != info.Mirror {
+				t.Errorf("cartridge mirroring %v, header says %v", cart.mirror, info.Mirror)
+			}
+			if log.String() != test.logged {
+				t.Errorf("logged %q, want %q", log.String(), test.logged)
+			}
+		})
+	}
+}
+
+func TestApplyGameDBOddSizedROM(t *testing.T) {
+	// An NES 2.0 image with 8K of PRG ROM and 4K of CHR ROM, which are
+	// mirrored up to whole banks once loaded. Databases hash the ROM as
+	// dumped, so the padding must not be hashed.
+	h := header(13<<2, 12<<2, 0x00, 0x08, 0x00, 0xFF)
+	rom := make([]byte, 8192+4096)
+	for i := range rom {
+		rom[i] = byte(i * 5)
+	}
+	sum := sha1.Sum(rom)
+
+	db := mustParseGameDB([]byte(fmt.Sprintf(`<nes20db>
+  <game>
+    <!-- Odd size -->
+    <rom size="12288" crc32="%08X" sha1="%X"/>
+    <pcb mapper="0" mirroring="V"/>
+  </game>
+</nes20db>`, crc32.ChecksumIEEE(rom), sum)))
+
+	savedDB, savedLog := gameDatabase, gameDBLog
+	defer func() { gameDatabase, gameDBLog = savedDB, savedLog }()
+	var log strings.Builder
+	gameDatabase, gameDBLog = db, &log
+
+	cart, err := readImage(bytes.NewReader(append(h[:], rom...)))
+	if err != nil {
+		t.Fatalf("readImage: %v", err)
+	}
+	if got := cart.checksums().SHA1; got != sum {
+		t.Errorf("SHA-1 %X, want %X", got, sum)
+	}
+	if cart.Info().Mirror != Vertical {
+		t.Errorf("mirroring %v, want the database's %v", cart.Info().Mirror, Vertical)
+	}
+	if want := "Game database corrected header for Odd size: mirroring horizontal -> vertical\n"; log.String() != want {
+		t.Errorf("logged %q, want %q", log.String(), want)
+	}
+}
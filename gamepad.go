@@ -0,0 +1,267 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strings"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+const (
+	// maxGamepads is the number of gamepads raylib tracks
+	maxGamepads = 4
+
+	// defaultDeadzone is how far an analog stick must be pushed, as a
+	// fraction of its full travel, before it counts as a direction
+	defaultDeadzone = 0.25
+
+	// stickDiagonal is the sine of 22.5 degrees. A stick pushed past the
+	// deadzone presses each direction whose component exceeds this share
+	// of the stick's displacement, which splits its travel into eight
+	// equal sectors.
+	stickDiagonal = 0.3827
+)
+
+// gamepadProfile maps the buttons and stick of a kind of gamepad onto
+// controller buttons.
+type gamepadProfile struct {
+	name     string
+	match    string     // Case-insensitive substring of the device name
+	buttons  [8][]int32 // Gamepad buttons for each controller button
+	stick    int32      // X axis of the stick used as a D-pad, or -1
+	deadzone float32
+}
+
+// defaultGamepadProfile is used for any gamepad no configured profile
+// matches. It suits the common Xbox style layout: the bottom and left
+// face buttons are A and B, and either the D-pad or the left stick
+// steers.
+var defaultGamepadProfile = gamepadProfile{
+	name: "default",
+	buttons: [8][]int32{
+		{rl.GamepadButtonRightFaceDown},
+		{rl.GamepadButtonRightFaceLeft},
+		{rl.GamepadButtonMiddleLeft},
+		{rl.GamepadButtonMiddleRight},
+		{rl.GamepadButtonLeftFaceUp},
+		{rl.GamepadButtonLeftFaceDown},
+		{rl.GamepadButtonLeftFaceLeft},
+		{rl.GamepadButtonLeftFaceRight},
+	},
+	stick:    rl.GamepadAxisLeftX,
+	deadzone: defaultDeadzone,
+}
+
+// gamepadConfig is a gamepad profile in the input configuration file:
+//
+//	"gamepads": [
+//		{
+//			"name": "8BitDo",
+//			"match": "8bitdo",
+//			"deadzone": 0.4,
+//			"stick": "none",
+//			"buttons": {"A": ["RightFaceRight"], "B": ["RightFaceDown", "RightFaceLeft"]}
+//		}
+//	]
+//
+// Profiles are tried in order against the name each gamepad reports, so
+// every profile needs a match. Buttons that are not given keep their
+// default mapping.
+type gamepadConfig struct {
+	Name     string              `json:"name"`
+	Match    string              `json:"match"`
+	Deadzone *float32            `json:"deadzone"`
+	Stick    string              `json:"stick"`
+	Buttons  map[string][]string `json:"buttons"`
+}
+
+// gamepadButtonNames maps the gamepad button names accepted in the
+// configuration file onto raylib's buttons.
+var gamepadButtonNames = map[string]int32{
+	"LeftFaceUp":     rl.GamepadButtonLeftFaceUp,
+	"LeftFaceRight":  rl.GamepadButtonLeftFaceRight,
+	"LeftFaceDown":   rl.GamepadButtonLeftFaceDown,
+	"LeftFaceLeft":   rl.GamepadButtonLeftFaceLeft,
+	"RightFaceUp":    rl.GamepadButtonRightFaceUp,
+	"RightFaceRight": rl.GamepadButtonRightFaceRight,
+	"RightFaceDown":  rl.GamepadButtonRightFaceDown,
+	"RightFaceLeft":  rl.GamepadButtonRightFaceLeft,
+	"LeftTrigger1":   rl.GamepadButtonLeftTrigger1,
+	"LeftTrigger2":   rl.GamepadButtonLeftTrigger2,
+	"RightTrigger1":  rl.GamepadButtonRightTrigger1,
+	"RightTrigger2":  rl.GamepadButtonRightTrigger2,
+	"MiddleLeft":     rl.GamepadButtonMiddleLeft,
+	"Middle":         rl.GamepadButtonMiddle,
+	"MiddleRight":    rl.GamepadButtonMiddleRight,
+	"LeftThumb":      rl.GamepadButtonLeftThumb,
+	"RightThumb":     rl.GamepadButtonRightThumb,
+}
+
+// newGamepadProfile builds a profile from its configuration, starting
+// from the default profile.
+func newGamepadProfile(config gamepadConfig) (*gamepadProfile, error) {
+	// An empty match is a substring of every name, so the profile would
+	// take over every gamepad
+	if strings.TrimSpace(config.Match) == "" {
+		return nil, fmt.Errorf("no match given")
+	}
+
+	profile := defaultGamepadProfile
+	profile.name = config.Name
+	profile.match = config.Match
+	if profile.name == "" {
+		profile.name = config.Match
+	}
+
+	if config.Deadzone != nil {
+		if *config.Deadzone < 0 || *config.Deadzone >= 1 {
+			return nil, fmt.Errorf("deadzone %v is outside [0, 1)", *config.Deadzone)
+		}
+		profile.deadzone = *config.Deadzone
+	}
+
+	switch strings.ToLower(config.Stick) {
+	case "", "left":
+		profile.stick = rl.GamepadAxisLeftX
+	case "right":
+		profile.stick = rl.GamepadAxisRightX
+	case "none":
+		profile.stick = -1
+	default:
+		return nil, fmt.Errorf("unknown stick %q", config.Stick)
+	}
+
+	for buttonName, padButtonNames := range config.Buttons {
+		button, err := parseButton(buttonName)
+		if err != nil {
+			return nil, err
+		}
+
+		padButtons := make([]int32, 0, len(padButtonNames))
+		for _, name := range padButtonNames {
+			padButton, err := parseGamepadButton(name)
+			if err != nil {
+				return nil, err
+			}
+			padButtons = append(padButtons, padButton)
+		}
+		profile.buttons[buttonIndex(button)] = padButtons
+	}
+
+	return &profile, nil
+}
+
+// parseGamepadButton looks up a gamepad button by its configuration file
+// name, ignoring case.
+func parseGamepadButton(name string) (int32, error) {
+	for n, button := range gamepadButtonNames {
+		if strings.EqualFold(n, name) {
+			return button, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown gamepad button %q", name)
+}
+
+// poll returns the controller buttons held on gamepad.
+func (p *gamepadProfile) poll(gamepad int32) Button {
+	var buttons Button
+	for i, padButtons := range p.buttons {
+		for _, padButton := range padButtons {
+			if rl.IsGamepadButtonDown(gamepad, padButton) {
+				buttons |= Button(1 << i)
+			}
+		}
+	}
+
+	if p.stick >= 0 {
+		buttons |= stickButtons(
+			rl.GetGamepadAxisMovement(gamepad, p.stick),
+			rl.GetGamepadAxisMovement(gamepad, p.stick+1),
+			p.deadzone)
+	}
+	return buttons
+}
+
+// stickButtons converts an analog stick position into D-pad directions.
+// The deadzone is radial, so the stick has to travel the same distance
+// in every direction before it registers.
+func stickButtons(x float32, y float32, deadzone float32) Button {
+	magnitude := float32(math.Hypot(float64(x), float64(y)))
+	if magnitude <= deadzone {
+		return 0
+	}
+
+	var buttons Button
+	threshold := magnitude * stickDiagonal
+	if x < -threshold {
+		buttons |= ButtonLeft
+	} else if x > threshold {
+		buttons |= ButtonRight
+	}
+	if y < -threshold {
+		buttons |= ButtonUp
+	} else if y > threshold {
+		buttons |= ButtonDown
+	}
+	return buttons
+}
+
+// gamepadSlot tracks what is connected to one of raylib's gamepad slots.
+type gamepadSlot struct {
+	connected bool
+	name      string
+	profile   *gamepadProfile
+}
+
+// updateGamepads notices gamepads being connected and disconnected, and
+// picks the profile for each new one.
+func (b *inputBindings) updateGamepads() {
+	for i := range b.gamepads {
+		slot := &b.gamepads[i]
+		connected := rl.IsGamepadAvailable(int32(i))
+		if connected == slot.connected {
+			continue
+		}
+
+		slot.connected = connected
+		if !connected {
+			fmt.Fprintf(os.Stderr, "Gamepad %d disconnected: %s\n", i, slot.name)
+			slot.name = ""
+			slot.profile = nil
+			continue
+		}
+
+		slot.name = rl.GetGamepadName(int32(i))
+		slot.profile = b.gamepadProfileFor(slot.name)
+		fmt.Fprintf(os.Stderr, "Gamepad %d connected: %s (profile %s)\n", i, slot.name, slot.profile.name)
+	}
+}
+
+// gamepadProfileFor returns the first configured profile matching a
+// gamepad's name, or the default profile.
+func (b *inputBindings) gamepadProfileFor(name string) *gamepadProfile {
+	for _, profile := range b.gamepadProfiles {
+		if strings.Contains(strings.ToLower(name), strings.ToLower(profile.match)) {
+			return profile
+		}
+	}
+	return &defaultGamepadProfile
+}
+
+// pollGamepad returns the buttons held on the gamepad assigned to a
+// controller port. Connected gamepads are assigned to ports in slot
+// order, so the first one plays as player 1 and the second as player 2.
+func (b *inputBindings) pollGamepad(port int) Button {
+	for i := range b.gamepads {
+		if !b.gamepads[i].connected {
+			continue
+		}
+		if port == 0 {
+			return b.gamepads[i].profile.poll(int32(i))
+		}
+		port--
+	}
+	return 0
+}
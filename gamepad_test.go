@@ -0,0 +1,124 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+func TestStickButtons(t *testing.T) {
+	tests := []struct {
+		name     string
+		x, y     float32
+		deadzone float32
+		want     Button
+	}{
+		{"centred", 0, 0, defaultDeadzone, 0},
+		{"on the deadzone edge", 0.25, 0, defaultDeadzone, 0},
+		{"just past the deadzone", 0.26, 0, defaultDeadzone, ButtonRight},
+		{"left", -0.3, 0, defaultDeadzone, ButtonLeft},
+		{"up", 0, -0.3, defaultDeadzone, ButtonUp},
+		{"down", 0, 0.3, defaultDeadzone, ButtonDown},
+		{"down right", 0.7, 0.7, defaultDeadzone, ButtonDown | ButtonRight},
+		{"up left", -0.7, -0.7, defaultDeadzone, ButtonUp | ButtonLeft},
+		{"up right", 0.7, -0.7, defaultDeadzone, ButtonUp | ButtonRight},
+		{"down left", -0.7, 0.7, defaultDeadzone, ButtonDown | ButtonLeft},
+		{"inside the right sector", 0.9, 0.3, defaultDeadzone, ButtonRight},
+		{"inside the diagonal sector", 0.9, 0.4, defaultDeadzone, ButtonDown | ButtonRight},
+		// The deadzone is radial, so a diagonal needs the same travel
+		{"diagonal inside the deadzone", 0.17, 0.17, defaultDeadzone, 0},
+		{"diagonal past the deadzone", 0.2, 0.2, defaultDeadzone, ButtonDown | ButtonRight},
+		{"no deadzone", 0.01, 0, 0, ButtonRight},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := stickButtons(test.x, test.y, test.deadzone); got != test.want {
+				t.Errorf("stickButtons(%v, %v, %v) = %08b, want %08b", test.x, test.y, test.deadzone, got, test.want)
+			}
+		})
+	}
+}
+
+func TestNewGamepadProfile(t *testing.T) {
+	deadzone := func(d float32) *float32 { return &d }
+
+	wantButtons := defaultGamepadProfile.buttons
+	wantButtons[buttonIndex(ButtonA)] = []int32{rl.GamepadButtonRightFaceRight}
+	wantButtons[buttonIndex(ButtonB)] = []int32{rl.GamepadButtonRightFaceDown, rl.GamepadButtonRightFaceLeft}
+
+	profile, err := newGamepadProfile(gamepadConfig{
+		Match:    "8bitdo",
+		Deadzone: deadzone(0.4),
+		Stick:    "None",
+		Buttons: map[string][]string{
+			"a": {"RightFaceRight"},
+			"B": {"rightfacedown", "RightFaceLeft"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := gamepadProfile{name: "8bitdo", match: "8bitdo", buttons: wantButtons, stick: -1, deadzone: 0.4}
+	if !reflect.DeepEqual(*profile, want) {
+		t.Errorf("got %+v, want %+v", *profile, want)
+	}
+
+	tests := []struct {
+		name   string
+		config gamepadConfig
+		ok     bool
+	}{
+		{"defaults", gamepadConfig{Match: "pad"}, true},
+		{"right stick", gamepadConfig{Match: "pad", Stick: "right"}, true},
+		{"zero deadzone", gamepadConfig{Match: "pad", Deadzone: deadzone(0)}, true},
+		{"no match", gamepadConfig{Name: "Any"}, false},
+		{"blank match", gamepadConfig{Match: "  "}, false},
+		{"negative deadzone", gamepadConfig{Match: "pad", Deadzone: deadzone(-0.1)}, false},
+		{"deadzone of 1", gamepadConfig{Match: "pad", Deadzone: deadzone(1)}, false},
+		{"unknown stick", gamepadConfig{Match: "pad", Stick: "middle"}, false},
+		{"unknown button", gamepadConfig{Match: "pad", Buttons: map[string][]string{"C": {"Middle"}}}, false},
+		{"unknown gamepad button", gamepadConfig{Match: "pad", Buttons: map[string][]string{"A": {"Turbo"}}}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := newGamepadProfile(test.config)
+			if (err == nil) != test.ok {
+				t.Errorf("got error %v, want ok %v", err, test.ok)
+			}
+		})
+	}
+}
+
+func TestGamepadProfileFor(t *testing.T) {
+	var b inputBindings
+	for _, config := range []gamepadConfig{
+		{Name: "8BitDo", Match: "8BitDo"},
+		{Name: "Pro", Match: "pro controller"},
+		{Name: "Any 8BitDo Pro", Match: "8bitdo pro"},
+	} {
+		profile, err := newGamepadProfile(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.gamepadProfiles = append(b.gamepadProfiles, profile)
+	}
+
+	tests := []struct {
+		device string
+		want   string
+	}{
+		{"8BitDo SN30 Pro", "8BitDo"},
+		{"8bitdo pro 2", "8BitDo"}, // The first match wins
+		{"Nintendo Switch Pro Controller", "Pro"},
+		{"Xbox Wireless Controller", "default"},
+		{"", "default"},
+	}
+	for _, test := range tests {
+		if got := b.gamepadProfileFor(test.device).name; got != test.want {
+			t.Errorf("gamepadProfileFor(%q) = %q, want %q", test.device, got, test.want)
+		}
+	}
+}
@@ -9,3 +9,5 @@ require (
 	github.com/gen2brain/raylib-go/raylib v0.0.0-20231123174446-48309e2407b7 // indirect
 	golang.org/x/sys v0.15.0 // indirect
 )
+
+replace github.com/drewwalton19216801/gones/cpu => ./cpu
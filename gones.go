@@ -1,46 +1,320 @@
 package main
 
 import (
+	"bufio"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"math"
+	"os"
 
 	cpu6502 "github.com/drewwalton19216801/gones/cpu"
 	rl "github.com/gen2brain/raylib-go/raylib"
 )
 
+// Exit codes
 const (
-	screenWidth  = 680
-	screenHeight = 480
-	pixelWidth   = 2
-	pixelHeight  = 2
+	exitOK    = 0
+	exitError = 1 // Loading or running the ROM failed, or a test failed
+	exitUsage = 2 // Bad command line
 )
 
+// defaultScale is how many window pixels wide and high each pixel of the
+// picture is drawn.
+const defaultScale = 2
+
 func main() {
+	os.Exit(runCommand(os.Args[1:]))
+}
+
+// runCommand runs the subcommand named by the first argument, or the
+// emulator if the first argument is not a subcommand, and returns the
+// exit code.
+func runCommand(args []string) int {
+	if len(args) > 0 {
+		switch args[0] {
+		case "run":
+			return runGame(args[1:])
+		case "info":
+			return runInfo(args[1:])
+		case "disasm":
+			return runDisasm(args[1:])
+		case "test":
+			return runTest(args[1:])
+		case "mappers":
+			return runMappers(args[1:])
+		case "help", "-h", "-help", "--help":
+			printUsage(os.Stdout)
+			return exitOK
+		}
+	}
+	return runGame(args)
+}
+
+// printUsage lists the subcommands.
+func printUsage(w io.Writer) {
+	fmt.Fprint(w, `usage: gones [run] [flags] <rom> [zip entry]
+       gones <command> [flags] <rom> [zip entry]
+
+Commands:
+  run      play a ROM (the default)
+  info     describe a ROM's header
+  disasm   disassemble a ROM's PRG banks
+  test     run a test ROM and report its result
+  mappers  list the supported mappers
+
+A ROM may be an iNES file, a zip or gzip archive holding one, or "-" to
+read standard input. Run "gones <command> -h" for a command's flags.
+`)
+}
+
+// parseArgs parses flags that may appear before, after or among the
+// positional arguments, and returns the positional arguments.
+func parseArgs(flags *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// romArgs splits the positional arguments of a command that takes a ROM
+// into the ROM path and the optional zip entry.
+func romArgs(flags *flag.FlagSet, positional []string) (string, string, bool) {
+	switch len(positional) {
+	case 1:
+		return positional[0], "", true
+	case 2:
+		return positional[0], positional[1], true
+	}
+	flags.Usage()
+	return "", "", false
+}
+
+// newFlagSet creates the flag set of a command, whose usage message shows
+// synopsis above the flags.
+func newFlagSet(name string, synopsis string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: gones %s %s\n", name, synopsis)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// flagError converts an error from parsing flags into an exit code. The
+// flag package has already reported the error.
+func flagError(err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	return exitUsage
+}
+
+// regionFlag resolves the value of a --region flag for a cartridge, where
+// "auto" follows the cartridge's header.
+func regionFlag(value string, cart *Cartridge) (Region, error) {
+	if value == "auto" {
+		return regionForTiming(cart.Info().Timing), nil
+	}
+	return parseRegion(value)
+}
+
+// gameDBFlags adds the flags that choose the game database to a command,
+// and returns a function that applies them once the flags are parsed.
+func gameDBFlags(flags *flag.FlagSet) func() error {
+	disable := flags.Bool("no-gamedb", false, "trust ROM headers instead of correcting them from the game database")
+	path := flags.String("gamedb", "", "use the game database in `file` (nes20db.xml format) instead of the built-in one")
+
+	return func() error {
+		switch {
+		case *disable:
+			gameDatabase = nil
+		case *path != "":
+			db, err := loadGameDB(*path)
+			if err != nil {
+				return err
+			}
+			gameDatabase = db
+		}
+		return nil
+	}
+}
+
+// newConsole builds a console of the given region with cart inserted, and
+// resets it.
+func newConsole(cart *Cartridge, region Region) *MainBus {
 	cpu := cpu6502.New()
 	mainbus := NewBus(cpu)
 	cpu.ConnectBus(mainbus)
-	cart := NewCartridge("test.nes")
-	if cart.ImageValid() {
-		// Convert the cart name to a string, except for the last EOF byte
-		cartName := string(cart.header.Name[:len(cart.header.Name)-1])
-		fmt.Printf("Cartridge name: %s\n", cartName)
-		mainbus.insertCartridge(cart)
-	} else {
-		fmt.Println("Failed to load cartridge")
-		return
-	}
-	cpu.Reset()
+	mainbus.setRegion(region)
+	mainbus.insertCartridge(cart)
+	mainbus.Reset()
+	return mainbus
+}
 
+// runGame implements the run subcommand, which plays a ROM in a window,
+// or runs it for a number of frames without one.
+func runGame(args []string) int {
+	flags := newFlagSet("run", "[flags] <rom> [zip entry]")
+	scale := flags.Int("scale", defaultScale, "window `pixels` per picture pixel")
+	fullscreen := flags.Bool("fullscreen", false, "fill the screen")
+	regionName := flags.String("region", "auto", "console `region`: auto, ntsc, pal or dendy")
+	mute := flags.Bool("mute", false, "disable audio")
+	tracePath := flags.String("trace", "", "write a CPU trace to `file` (\"-\" for stdout)")
+	headless := flags.Bool("headless", false, "run without a window; requires --frames")
+	frames := flags.Int("frames", 0, "stop after `n` frames (0 runs until the window closes)")
+	inputPath := flags.String("input", defaultInputConfigPath(), "input configuration `file`")
+	busConflicts := flags.Bool("bus-conflicts", false, "emulate bus conflicts on discrete logic boards whose header doesn't say if they have them")
+	applyGameDB := gameDBFlags(flags)
+
+	positional, err := parseArgs(flags, args)
+	if err != nil {
+		return flagError(err)
+	}
+	if err := applyGameDB(); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to load game database:", err)
+		return exitError
+	}
+	romPath, entry, ok := romArgs(flags, positional)
+	if !ok {
+		return exitUsage
+	}
+	if *scale < 1 {
+		fmt.Fprintln(os.Stderr, "--scale must be at least 1")
+		return exitUsage
+	}
+	if *frames < 0 || (*headless && *frames == 0) {
+		fmt.Fprintln(os.Stderr, "--headless needs a positive --frames")
+		return exitUsage
+	}
+
+	cart, err := loadROM(romPath, entry)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to load cartridge:", err)
+		return exitError
+	}
+	cart.setBusConflicts(*busConflicts)
+
+	region, err := regionFlag(*regionName, cart)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	mainbus := newConsole(cart, region)
+
+	if *tracePath != "" {
+		var w io.Writer = os.Stdout
+		if *tracePath != "-" {
+			file, err := os.Create(*tracePath)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Failed to open trace file:", err)
+				return exitError
+			}
+			defer file.Close()
+			w = file
+		}
+		trace := bufio.NewWriter(w)
+		defer trace.Flush()
+		mainbus.enableTrace(trace)
+	}
+
+	if *headless {
+		for frame := 0; frame < *frames; frame++ {
+			mainbus.runFrame()
+			if mainbus.cpu.Halted() {
+				fmt.Fprintln(os.Stderr, mainbus.cpu.HaltReason())
+				return exitError
+			}
+		}
+		return exitOK
+	}
+
+	bindings, err := loadInputBindings(*inputPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to load input bindings:", err)
+		return exitError
+	}
+
+	playWindowed(mainbus, bindings, windowOptions{
+		scale:      *scale,
+		fullscreen: *fullscreen,
+		mute:       *mute,
+		frames:     *frames,
+	})
+	return exitOK
+}
+
+// windowOptions configures playWindowed.
+type windowOptions struct {
+	scale      int
+	fullscreen bool
+	mute       bool
+	frames     int // Frames to run before closing, or 0 for no limit
+}
+
+// playWindowed runs the console in a window until it is closed.
+func playWindowed(mainbus *MainBus, bindings *inputBindings, options windowOptions) {
 	// Don't spit out logs
 	rl.SetTraceLogLevel(rl.LogNone)
 
-	rl.InitWindow(680, 480, "Gones")
+	rl.InitWindow(int32(FrameWidth*options.scale), int32(FrameHeight*options.scale), "Gones")
 	defer rl.CloseWindow()
-	rl.SetTargetFPS(60)
+	if options.fullscreen {
+		rl.ToggleFullscreen()
+	}
+	rl.SetTargetFPS(int32(math.Round(mainbus.region.timing().frameRate)))
+
+	var audio *audioOutput
+	if !options.mute {
+		audio = newAudioOutput(mainbus.apu, DefaultSampleRate)
+		defer audio.close()
+	}
+
+	// The PPU's frame is uploaded into this texture and scaled up to the
+	// window each frame
+	image := rl.GenImageColor(FrameWidth, FrameHeight, rl.Black)
+	screen := rl.LoadTextureFromImage(image)
+	rl.UnloadImage(image)
+	defer rl.UnloadTexture(screen)
+	source := rl.NewRectangle(0, 0, FrameWidth, FrameHeight)
+
+	for frame := 0; !rl.WindowShouldClose(); frame++ {
+		if options.frames > 0 && frame >= options.frames {
+			break
+		}
+
+		bindings.updateGamepads()
+		for port := range mainbus.controllers {
+			mainbus.controllers[port].SetButtons(bindings.poll(port))
+		}
+
+		mainbus.runFrame()
+		if audio != nil {
+			audio.update()
+		}
+		rl.UpdateTexture(screen, mainbus.ppu.Frame[:])
+
+		// Scale the picture as large as fits, keeping its aspect ratio,
+		// and centre it
+		width := float32(rl.GetScreenWidth())
+		height := float32(rl.GetScreenHeight())
+		scale := min(width/FrameWidth, height/FrameHeight)
+		dest := rl.NewRectangle(
+			(width-FrameWidth*scale)/2, (height-FrameHeight*scale)/2,
+			FrameWidth*scale, FrameHeight*scale)
 
-	for !rl.WindowShouldClose() {
 		rl.BeginDrawing()
-		rl.ClearBackground(rl.RayWhite)
-		rl.DrawText(fmt.Sprintf("A: %d", cpu.GetRegister(cpu6502.RegA)), 10, 10, 20, rl.Red)
+		rl.ClearBackground(rl.Black)
+		rl.DrawTexturePro(screen, source, dest, rl.NewVector2(0, 0), 0, rl.White)
 		rl.EndDrawing()
 	}
 }
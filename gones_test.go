@@ -0,0 +1,31 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestRunGameFlags(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"headless", []string{"--headless", "--frames", "2", "test.nes"}, exitOK},
+		{"headless without frames", []string{"--headless", "test.nes"}, exitUsage},
+		{"bad scale", []string{"--scale", "0", "test.nes"}, exitUsage},
+		{"bad region", []string{"--headless", "--frames", "1", "--region", "secam", "test.nes"}, exitUsage},
+		{"missing ROM", []string{"--headless", "--frames", "1", filepath.Join(dir, "missing.nes")}, exitError},
+		{"no ROM", []string{"--headless", "--frames", "1"}, exitUsage},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := runGame(test.args); got != test.want {
+				t.Errorf("exit code %d, want %d", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import "fmt"
+
+// FileFormat is the flavour of iNES header a ROM image uses.
+type FileFormat int
+
+const (
+	// FormatArchaicINES is an iNES header whose bytes 7-15 can't be
+	// trusted, often because a ripper's signature was written there.
+	// Only the fields in bytes 4-6 are used.
+	FormatArchaicINES FileFormat = iota
+	FormatINES
+	FormatNES20
+)
+
+var fileFormatNames = [...]string{"archaic iNES", "iNES", "NES 2.0"}
+
+func (f FileFormat) String() string {
+	if int(f) < len(fileFormatNames) {
+		return fileFormatNames[f]
+	}
+	return fmt.Sprintf("FileFormat(%d)", int(f))
+}
+
+// TimingMode is the CPU/PPU timing a game was made for.
+type TimingMode int
+
+const (
+	TimingNTSC TimingMode = iota
+	TimingPAL
+	TimingMultiRegion
+	TimingDendy
+)
+
+var timingModeNames = [...]string{"NTSC", "PAL", "multi-region", "Dendy"}
+
+func (t TimingMode) String() string {
+	if int(t) < len(timingModeNames) {
+		return timingModeNames[t]
+	}
+	return fmt.Sprintf("TimingMode(%d)", int(t))
+}
+
+// ConsoleType is the kind of console a game runs on.
+type ConsoleType int
+
+const (
+	ConsoleNES ConsoleType = iota
+	ConsoleVsSystem
+	ConsolePlayChoice10
+	ConsoleExtended // See CartridgeInfo.ExtendedConsoleType
+)
+
+var consoleTypeNames = [...]string{"NES/Famicom", "Vs. System", "PlayChoice-10", "extended"}
+
+func (c ConsoleType) String() string {
+	if int(c) < len(consoleTypeNames) {
+		return consoleTypeNames[c]
+	}
+	return fmt.Sprintf("ConsoleType(%d)", int(c))
+}
+
+const (
+	inesHeaderSize  = 16
+	inesTrainerSize = 512
+	prgROMUnit      = 16384
+	chrROMUnit      = 8192
+)
+
+// Bits of header byte 6
+const (
+	flags6Vertical   byte = 1 << 0
+	flags6Battery    byte = 1 << 1
+	flags6Trainer    byte = 1 << 2
+	flags6FourScreen byte = 1 << 3
+)
+
+// CartridgeInfo is everything the header of a ROM image says about the
+// cartridge.
+type CartridgeInfo struct {
+	Format FileFormat
+
+	Mapper    uint16
+	Submapper byte // Always 0 before NES 2.0
+
+	// Sizes in bytes
+	PRGROMSize   int
+	CHRROMSize   int
+	PRGRAMSize   int
+	PRGNVRAMSize int
+	CHRRAMSize   int
+	CHRNVRAMSize int
+
+	Mirror     Mirror // Horizontal or Vertical, unless FourScreen
+	FourScreen bool
+	Battery    bool
+	Trainer    bool
+
+	Timing  TimingMode
+	Console ConsoleType
+
+	// Only meaningful for NES 2.0 images
+	VsPPUType           byte
+	VsHardwareType      byte
+	ExtendedConsoleType byte
+	MiscROMs            byte
+	ExpansionDevice     byte
+}
+
+// maxROMSizeExponent limits NES 2.0 exponent-multiplier sizes to 2^30 * 7
+// bytes, far beyond any real cartridge but still loadable in principle.
+const maxROMSizeExponent = 30
+
+// InvalidSizeError is returned for a header whose ROM sizes make no
+// sense.
+type InvalidSizeError struct {
+	Field  string
+	Reason string
+}
+
+func (e *InvalidSizeError) Error() string {
+	return fmt.Sprintf("invalid %s size: %s", e.Field, e.Reason)
+}
+
+// parseHeader decodes the 16 byte header of an iNES or NES 2.0 image. The
+// magic number is not checked here.
+func parseHeader(header [inesHeaderSize]byte) (CartridgeInfo, error) {
+	var info CartridgeInfo
+
+	flags6 := header[6]
+	flags7 := header[7]
+
+	switch {
+	case flags7&0x0C == 0x08:
+		info.Format = FormatNES20
+	case flags7&0x0C == 0x00 && header[12] == 0 && header[13] == 0 && header[14] == 0 && header[15] == 0:
+		info.Format = FormatINES
+	default:
+		info.Format = FormatArchaicINES
+	}
+
+	// Fields common to every format
+	info.Mapper = uint16(flags6 >> 4)
+	info.Mirror = Horizontal
+	if flags6&flags6Vertical != 0 {
+		info.Mirror = Vertical
+	}
+	info.Battery = flags6&flags6Battery != 0
+	info.Trainer = flags6&flags6Trainer != 0
+	info.FourScreen = flags6&flags6FourScreen != 0
+	if info.FourScreen {
+		info.Mirror = FourScreen
+	}
+
+	switch info.Format {
+	case FormatArchaicINES:
+		info.PRGROMSize = int(header[4]) * prgROMUnit
+		info.CHRROMSize = int(header[5]) * chrROMUnit
+		info.PRGRAMSize = 8192
+
+	case FormatINES:
+		info.Mapper |= uint16(flags7 & 0xF0)
+		info.PRGROMSize = int(header[4]) * prgROMUnit
+		info.CHRROMSize = int(header[5]) * chrROMUnit
+
+		// Byte 8 is rarely filled in, and 0 means 8K for compatibility
+		info.PRGRAMSize = int(header[8]) * 8192
+		if info.PRGRAMSize == 0 {
+			info.PRGRAMSize = 8192
+		}
+		if info.Battery {
+			info.PRGNVRAMSize, info.PRGRAMSize = info.PRGRAMSize, 0
+		}
+
+		if header[9]&0x01 != 0 {
+			info.Timing = TimingPAL
+		}
+		switch {
+		case flags7&0x01 != 0:
+			info.Console = ConsoleVsSystem
+		case flags7&0x02 != 0:
+			info.Console = ConsolePlayChoice10
+		}
+
+	case FormatNES20:
+		info.Mapper |= uint16(flags7&0xF0) | uint16(header[8]&0x0F)<<8
+		info.Submapper = header[8] >> 4
+
+		var err error
+		info.PRGROMSize, err = nes20ROMSize("PRG ROM", header[4], header[9]&0x0F, prgROMUnit)
+		if err != nil {
+			return info, err
+		}
+		info.CHRROMSize, err = nes20ROMSize("CHR ROM", header[5], header[9]>>4, chrROMUnit)
+		if err != nil {
+			return info, err
+		}
+
+		info.PRGRAMSize = nes20RAMSize(header[10] & 0x0F)
+		info.PRGNVRAMSize = nes20RAMSize(header[10] >> 4)
+		info.CHRRAMSize = nes20RAMSize(header[11] & 0x0F)
+		info.CHRNVRAMSize = nes20RAMSize(header[11] >> 4)
+
+		info.Timing = TimingMode(header[12] & 0x03)
+		info.Console = ConsoleType(flags7 & 0x03)
+		switch info.Console {
+		case ConsoleVsSystem:
+			info.VsPPUType = header[13] & 0x0F
+			info.VsHardwareType = header[13] >> 4
+		case ConsoleExtended:
+			info.ExtendedConsoleType = header[13] & 0x0F
+		}
+		info.MiscROMs = header[14] & 0x03
+		info.ExpansionDevice = header[15] & 0x3F
+	}
+
+	// Every mapper needs some PRG ROM to map
+	if info.PRGROMSize == 0 {
+		return info, &InvalidSizeError{Field: "PRG ROM", Reason: "size is zero"}
+	}
+
+	// Boards without CHR ROM have CHR RAM, which only NES 2.0 can size
+	if info.CHRROMSize == 0 && info.CHRRAMSize == 0 && info.CHRNVRAMSize == 0 {
+		info.CHRRAMSize = 8192
+	}
+
+	return info, nil
+}
+
+// nes20ROMSize decodes a NES 2.0 ROM size from its LSB and MSB nibble.
+//
+// An MSB nibble of $F selects exponent-multiplier notation, where the LSB
+// holds EEEEEEMM and the size is 2^E * (MM*2+1) bytes. Otherwise the
+// nibble and LSB form a 12-bit count of units.
+func nes20ROMSize(field string, lsb byte, msb byte, unit int) (int, error) {
+	if msb != 0x0F {
+		return (int(msb)<<8 | int(lsb)) * unit, nil
+	}
+
+	exponent := lsb >> 2
+	multiplier := int(lsb&0x03)*2 + 1
+	if exponent > maxROMSizeExponent {
+		return 0, &InvalidSizeError{
+			Field:  field,
+			Reason: fmt.Sprintf("size 2^%d * %d is too large", exponent, multiplier),
+		}
+	}
+	return (1 << exponent) * multiplier, nil
+}
+
+// nes20RAMSize decodes a NES 2.0 RAM size, given as a shift count: 0
+// means none, otherwise the size is 64 << count bytes.
+func nes20RAMSize(shift byte) int {
+	if shift == 0 {
+		return 0
+	}
+	return 64 << shift
+}
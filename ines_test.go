@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// header builds a header from the bytes after the magic number.
+func header(fields ...byte) [inesHeaderSize]byte {
+	h := [inesHeaderSize]byte{'N', 'E', 'S', 0x1A}
+	copy(h[4:], fields)
+	return h
+}
+
+func TestParseHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		header [inesHeaderSize]byte
+		want   CartridgeInfo
+	}{
+		{
+			name:   "iNES NROM",
+			header: header(2, 1, 0x01, 0x00),
+			want: CartridgeInfo{
+				Format:     FormatINES,
+				PRGROMSize: 32768,
+				CHRROMSize: 8192,
+				PRGRAMSize: 8192,
+				Mirror:     Vertical,
+			},
+		},
+		{
+			name:   "iNES mapper nibbles and battery",
+			header: header(8, 0, 0x12, 0x40),
+			want: CartridgeInfo{
+				Format:       FormatINES,
+				Mapper:       0x41,
+				PRGROMSize:   131072,
+				PRGNVRAMSize: 8192,
+				CHRRAMSize:   8192,
+				Mirror:       Horizontal,
+				Battery:      true,
+			},
+		},
+		{
+			name:   "iNES trainer, four-screen, PAL and Vs. System",
+			header: header(1, 1, 0x0C, 0x01, 2, 0x01),
+			want: CartridgeInfo{
+				Format:     FormatINES,
+				PRGROMSize: 16384,
+				CHRROMSize: 8192,
+				PRGRAMSize: 16384,
+				Mirror:     FourScreen,
+				FourScreen: true,
+				Trainer:    true,
+				Timing:     TimingPAL,
+				Console:    ConsoleVsSystem,
+			},
+		},
+		{
+			name:   "archaic iNES ignores byte 7 onwards",
+			header: header(2, 1, 0x11, 'D', 'i', 's', 'k', 'D', 'u', 'd', 'e', '!'),
+			want: CartridgeInfo{
+				Format:     FormatArchaicINES,
+				Mapper:     1,
+				PRGROMSize: 32768,
+				CHRROMSize: 8192,
+				PRGRAMSize: 8192,
+				Mirror:     Vertical,
+			},
+		},
+		{
+			name:   "NES 2.0 mapper, submapper, RAM and timing",
+			header: header(2, 0, 0x40, 0x18, 0x21, 0x00, 0x97, 0x07, 0x01),
+			want: CartridgeInfo{
+				Format:       FormatNES20,
+				Mapper:       0x114,
+				Submapper:    2,
+				PRGROMSize:   32768,
+				PRGRAMSize:   8192,
+				PRGNVRAMSize: 32768,
+				CHRRAMSize:   8192,
+				Mirror:       Horizontal,
+				Timing:       TimingPAL,
+			},
+		},
+		{
+			name:   "NES 2.0 exponent-multiplier size",
+			header: header(13<<2, 13<<2|1, 0x00, 0x08, 0x00, 0xFF),
+			want: CartridgeInfo{
+				Format:     FormatNES20,
+				PRGROMSize: 8192,
+				CHRROMSize: 3 * 8192,
+				Mirror:     Horizontal,
+			},
+		},
+		{
+			name:   "NES 2.0 12-bit ROM sizes",
+			header: header(0x00, 0x02, 0x00, 0x08, 0x00, 0x01),
+			want: CartridgeInfo{
+				Format:     FormatNES20,
+				PRGROMSize: 256 * 16384,
+				CHRROMSize: 2 * 8192,
+				Mirror:     Horizontal,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseHeader(test.header)
+			if err != nil {
+				t.Fatalf("parseHeader: %v", err)
+			}
+			if got != test.want {
+				t.Errorf("got  %+v\nwant %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseHeaderInvalidSizes(t *testing.T) {
+	tests := []struct {
+		name   string
+		header [inesHeaderSize]byte
+		field  string
+	}{
+		{"iNES without PRG ROM", header(0, 1, 0x00, 0x00), "PRG ROM"},
+		{"archaic iNES without PRG ROM", header(0, 1, 0x00, 'D', 'i', 's', 'k', 'D', 'u', 'd', 'e', '!'), "PRG ROM"},
+		{"NES 2.0 without PRG ROM", header(0, 1, 0x00, 0x08), "PRG ROM"},
+		{"NES 2.0 PRG ROM too large", header(31<<2, 1, 0x00, 0x08, 0x00, 0x0F), "PRG ROM"},
+		{"NES 2.0 CHR ROM too large", header(1, 63<<2, 0x00, 0x08, 0x00, 0xF0), "CHR ROM"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := parseHeader(test.header)
+			var sizeErr *InvalidSizeError
+			if !errors.As(err, &sizeErr) {
+				t.Fatalf("got error %v, want an InvalidSizeError", err)
+			}
+			if sizeErr.Field != test.field {
+				t.Errorf("got error for %s, want %s", sizeErr.Field, test.field)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+)
+
+// romReport is what the info subcommand reports about one ROM. Its JSON
+// form is meant for scripts, so sizes are plain byte counts.
+type romReport struct {
+	File  string `json:"file"`
+	Error string `json:"error,omitempty"`
+
+	Format     string `json:"format,omitempty"`
+	Mapper     uint16 `json:"mapper"`
+	MapperName string `json:"mapperName,omitempty"`
+	Supported  bool   `json:"supported"`
+	Submapper  byte   `json:"submapper"`
+
+	PRGROMSize   int `json:"prgRomSize"`
+	CHRROMSize   int `json:"chrRomSize"`
+	PRGRAMSize   int `json:"prgRamSize"`
+	PRGNVRAMSize int `json:"prgNvramSize"`
+	CHRRAMSize   int `json:"chrRamSize"`
+	CHRNVRAMSize int `json:"chrNvramSize"`
+
+	Battery   bool   `json:"battery"`
+	Trainer   bool   `json:"trainer"`
+	Mirroring string `json:"mirroring,omitempty"`
+	TVSystem  string `json:"tvSystem,omitempty"`
+	Console   string `json:"console,omitempty"`
+
+	CRC32 string `json:"crc32,omitempty"` // Of PRG ROM followed by CHR ROM
+	SHA1  string `json:"sha1,omitempty"`
+
+	ResetVector uint16 `json:"resetVector"`
+	NMIVector   uint16 `json:"nmiVector"`
+	IRQVector   uint16 `json:"irqVector"`
+}
+
+// runInfo implements the info subcommand, which describes what the
+// headers of ROMs say about their cartridges.
+func runInfo(args []string) int {
+	flags := newFlagSet("info", "[flags] <rom>...")
+	jsonOutput := flags.Bool("json", false, "print one JSON object per ROM")
+	entry := flags.String("entry", "", "zip archive `entry` to read, instead of the first .nes file")
+	applyGameDB := gameDBFlags(flags)
+
+	roms, err := parseArgs(flags, args)
+	if err != nil {
+		return flagError(err)
+	}
+	if err := applyGameDB(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	if len(roms) == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	// Keep going past bad ROMs, so one bad file doesn't stop a scan of a
+	// whole collection
+	status := exitOK
+	for i, rom := range roms {
+		report := newROMReport(rom, *entry)
+		if report.Error != "" {
+			status = exitError
+		}
+
+		if *jsonOutput {
+			err = writeReportJSON(os.Stdout, report)
+		} else {
+			if i > 0 {
+				fmt.Println()
+			}
+			err = writeReportText(os.Stdout, report)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitError
+		}
+	}
+	return status
+}
+
+// newROMReport loads a ROM and describes it. Failure to load it is
+// recorded in the report.
+func newROMReport(rom string, entry string) *romReport {
+	report := &romReport{File: romName(rom, entry)}
+
+	cart, err := loadROMImage(rom, entry)
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+
+	info := cart.Info()
+	report.Format = info.Format.String()
+	report.Mapper = info.Mapper
+	if mapper, ok := lookupMapper(info.Mapper, info.Submapper); ok {
+		report.MapperName = mapper.Name
+		report.Supported = true
+	}
+	report.Submapper = info.Submapper
+
+	report.PRGROMSize = info.PRGROMSize
+	report.CHRROMSize = info.CHRROMSize
+	report.PRGRAMSize = info.PRGRAMSize
+	report.PRGNVRAMSize = info.PRGNVRAMSize
+	report.CHRRAMSize = info.CHRRAMSize
+	report.CHRNVRAMSize = info.CHRNVRAMSize
+
+	report.Battery = info.Battery
+	report.Trainer = info.Trainer
+	report.Mirroring = info.Mirror.String()
+	report.TVSystem = info.Timing.String()
+	report.Console = info.Console.String()
+
+	checksums := cart.checksums()
+	report.CRC32 = fmt.Sprintf("%08X", checksums.CRC32)
+	report.SHA1 = hex.EncodeToString(checksums.SHA1[:])
+
+	report.NMIVector = cart.vector(0xFFFA)
+	report.ResetVector = cart.vector(0xFFFC)
+	report.IRQVector = cart.vector(0xFFFE)
+	return report
+}
+
+// writeReportJSON writes a report to w as a single line of JSON.
+func writeReportJSON(w io.Writer, report *romReport) error {
+	return json.NewEncoder(w).Encode(report)
+}
+
+// writeReportText writes a report to w as a table.
+func writeReportText(w io.Writer, report *romReport) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "File:\t%s\n", report.File)
+	if report.Error != "" {
+		fmt.Fprintf(tw, "Error:\t%s\n", report.Error)
+		return tw.Flush()
+	}
+
+	mapperName := report.MapperName
+	if !report.Supported {
+		mapperName = "unsupported"
+	}
+
+	fmt.Fprintf(tw, "Format:\t%s\n", report.Format)
+	fmt.Fprintf(tw, "Mapper:\t%03d (%s)\n", report.Mapper, mapperName)
+	fmt.Fprintf(tw, "Submapper:\t%d\n", report.Submapper)
+	fmt.Fprintf(tw, "PRG ROM:\t%s\n", formatSize(report.PRGROMSize))
+	fmt.Fprintf(tw, "CHR ROM:\t%s\n", formatSize(report.CHRROMSize))
+	fmt.Fprintf(tw, "PRG RAM:\t%s\n", formatSize(report.PRGRAMSize))
+	fmt.Fprintf(tw, "PRG NVRAM:\t%s\n", formatSize(report.PRGNVRAMSize))
+	fmt.Fprintf(tw, "CHR RAM:\t%s\n", formatSize(report.CHRRAMSize))
+	fmt.Fprintf(tw, "CHR NVRAM:\t%s\n", formatSize(report.CHRNVRAMSize))
+	fmt.Fprintf(tw, "Battery:\t%s\n", yesNo(report.Battery))
+	fmt.Fprintf(tw, "Trainer:\t%s\n", yesNo(report.Trainer))
+	fmt.Fprintf(tw, "Mirroring:\t%s\n", report.Mirroring)
+	fmt.Fprintf(tw, "TV system:\t%s\n", report.TVSystem)
+	fmt.Fprintf(tw, "Console:\t%s\n", report.Console)
+	fmt.Fprintf(tw, "CRC32:\t%s\n", report.CRC32)
+	fmt.Fprintf(tw, "SHA-1:\t%s\n", report.SHA1)
+	fmt.Fprintf(tw, "Vectors:\tNMI $%04X, reset $%04X, IRQ $%04X\n",
+		report.NMIVector, report.ResetVector, report.IRQVector)
+	return tw.Flush()
+}
+
+// formatSize formats a size in bytes, in kilobytes where it divides
+// evenly.
+func formatSize(size int) string {
+	if size != 0 && size%1024 == 0 {
+		return fmt.Sprintf("%dK", size/1024)
+	}
+	return fmt.Sprintf("%d bytes", size)
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
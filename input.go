@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// inputConfigName is the name of the input configuration file inside the
+// user's configuration directory.
+const inputConfigName = "input.json"
+
+// keyBinding maps each button of one controller to a keyboard key, in
+// shift register order. rl.KeyNull leaves a button unbound.
+type keyBinding [8]int32
+
+// defaultKeyBindings are used for any button the configuration file does
+// not rebind. Player 2 has no keys unless configured.
+var defaultKeyBindings = [2]keyBinding{
+	{rl.KeyX, rl.KeyZ, rl.KeyA, rl.KeyS, rl.KeyUp, rl.KeyDown, rl.KeyLeft, rl.KeyRight},
+	{},
+}
+
+// inputConfig is the contents of the input configuration file, such as:
+//
+//	{
+//		"keyboard": [
+//			{"A": "X", "B": "Z", "Select": "RightShift", "Start": "Enter"},
+//			{"A": "Kp2", "B": "Kp1", "Up": "I", "Down": "K", "Left": "J", "Right": "L"}
+//		]
+//	}
+//
+// Each entry of keyboard binds the buttons of one controller port to key
+// names, overriding the defaults. Gamepad profiles are described with
+// gamepadConfig.
+type inputConfig struct {
+	Keyboard []map[string]string `json:"keyboard"`
+	Gamepads []gamepadConfig     `json:"gamepads"`
+}
+
+// inputBindings holds the bindings in effect for both controller ports.
+type inputBindings struct {
+	keyboard [2]keyBinding
+
+	gamepadProfiles []*gamepadProfile
+	gamepads        [maxGamepads]gamepadSlot
+}
+
+// defaultInputConfigPath returns where the input configuration file is
+// looked for when none is given.
+func defaultInputConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return inputConfigName
+	}
+	return filepath.Join(dir, "gones", inputConfigName)
+}
+
+// loadInputBindings reads the input configuration file at path. A missing
+// file is not an error; the default bindings are used instead.
+func loadInputBindings(path string) (*inputBindings, error) {
+	bindings := &inputBindings{keyboard: defaultKeyBindings}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return bindings, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var config inputConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := bindings.apply(&config); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return bindings, nil
+}
+
+// apply overrides the bindings with those in config.
+func (b *inputBindings) apply(config *inputConfig) error {
+	if len(config.Keyboard) > len(b.keyboard) {
+		return fmt.Errorf("keyboard bindings given for %d players, at most %d are supported",
+			len(config.Keyboard), len(b.keyboard))
+	}
+
+	for port, keys := range config.Keyboard {
+		for buttonName, keyName := range keys {
+			button, err := parseButton(buttonName)
+			if err != nil {
+				return fmt.Errorf("player %d: %w", port+1, err)
+			}
+			key, err := parseKey(keyName)
+			if err != nil {
+				return fmt.Errorf("player %d: %w", port+1, err)
+			}
+			b.keyboard[port][buttonIndex(button)] = key
+		}
+	}
+
+	for i, gamepad := range config.Gamepads {
+		profile, err := newGamepadProfile(gamepad)
+		if err != nil {
+			return fmt.Errorf("gamepad profile %d: %w", i+1, err)
+		}
+		b.gamepadProfiles = append(b.gamepadProfiles, profile)
+	}
+	return nil
+}
+
+// poll returns the buttons held on a controller port, from the keyboard
+// and from the gamepad assigned to the port.
+func (b *inputBindings) poll(port int) Button {
+	return b.pollKeyboard(port) | b.pollGamepad(port)
+}
+
+// pollKeyboard returns the buttons held on a controller port's keys.
+func (b *inputBindings) pollKeyboard(port int) Button {
+	var buttons Button
+	for i, key := range b.keyboard[port] {
+		if key != rl.KeyNull && rl.IsKeyDown(key) {
+			buttons |= Button(1 << i)
+		}
+	}
+	return buttons
+}
+
+// buttonIndex returns the position of a single button in shift register
+// order.
+func buttonIndex(button Button) int {
+	for i := 0; i < 8; i++ {
+		if button == 1<<i {
+			return i
+		}
+	}
+	return -1
+}
+
+// keyNames maps the key names accepted in the configuration file onto
+// raylib key codes. Letters and digits are added by init.
+var keyNames = map[string]int32{
+	"None":         rl.KeyNull,
+	"Space":        rl.KeySpace,
+	"Enter":        rl.KeyEnter,
+	"Tab":          rl.KeyTab,
+	"Backspace":    rl.KeyBackspace,
+	"Insert":       rl.KeyInsert,
+	"Delete":       rl.KeyDelete,
+	"Right":        rl.KeyRight,
+	"Left":         rl.KeyLeft,
+	"Down":         rl.KeyDown,
+	"Up":           rl.KeyUp,
+	"PageUp":       rl.KeyPageUp,
+	"PageDown":     rl.KeyPageDown,
+	"Home":         rl.KeyHome,
+	"End":          rl.KeyEnd,
+	"LeftShift":    rl.KeyLeftShift,
+	"LeftControl":  rl.KeyLeftControl,
+	"LeftAlt":      rl.KeyLeftAlt,
+	"RightShift":   rl.KeyRightShift,
+	"RightControl": rl.KeyRightControl,
+	"RightAlt":     rl.KeyRightAlt,
+	"Comma":        rl.KeyComma,
+	"Period":       rl.KeyPeriod,
+	"Slash":        rl.KeySlash,
+	"Semicolon":    rl.KeySemicolon,
+	"Apostrophe":   rl.KeyApostrophe,
+	"LeftBracket":  rl.KeyLeftBracket,
+	"RightBracket": rl.KeyRightBracket,
+	"Minus":        rl.KeyMinus,
+	"Equal":        rl.KeyEqual,
+	"KpEnter":      rl.KeyKpEnter,
+	"KpAdd":        rl.KeyKpAdd,
+	"KpSubtract":   rl.KeyKpSubtract,
+}
+
+func init() {
+	for i := int32(0); i < 26; i++ {
+		keyNames[string(rune('A'+i))] = rl.KeyA + i
+	}
+	for i := int32(0); i < 10; i++ {
+		keyNames[string(rune('0'+i))] = rl.KeyZero + i
+		keyNames[fmt.Sprintf("Kp%d", i)] = rl.KeyKp0 + i
+	}
+}
+
+// parseKey looks up a key by its configuration file name, ignoring case.
+func parseKey(name string) (int32, error) {
+	for n, key := range keyNames {
+		if strings.EqualFold(n, name) {
+			return key, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown key %q", name)
+}
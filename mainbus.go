@@ -1,7 +1,7 @@
 package main
 
 import (
-	"fmt"
+	"io"
 
 	cpu "github.com/drewwalton19216801/gones/cpu"
 )
@@ -9,6 +9,11 @@ import (
 // Implements the Bus interface found in cpu/bus.go
 type MainBus struct {
 	cpu *cpu.CPU6502
+	ppu *PPU
+	apu *APU
+
+	// Controllers plugged into the two ports
+	controllers [2]Controller
 
 	// Cartridge
 	cartridge *Cartridge
@@ -17,30 +22,78 @@ type MainBus struct {
 	mem [2048]byte
 
 	systemClockCounter uint32 // System clock counter
+
+	// The CPU runs from the same master clock as the PPU, divided by a
+	// ratio that depends on the region
+	region   Region
+	cpuPhase int    // Progress towards the next CPU cycle
+	cpuCycle uint64 // CPU cycles since reset
+
+	// OAM DMA, which copies a page of CPU memory into the PPU's object
+	// attribute memory while the CPU is held off the bus
+	dmaTransfer bool
+	dmaDummy    bool // Waiting to align with a read cycle
+	dmaPage     byte
+	dmaAddr     byte
+	dmaData     byte
 }
 
 func NewBus(cpu *cpu.CPU6502) *MainBus {
-	return &MainBus{
+	b := &MainBus{
 		cpu: cpu,
+		ppu: NewPPU(),
+		apu: NewAPU(),
 	}
+	b.apu.connectBus(b.Read, b.stallForDMC)
+	b.setRegion(RegionNTSC)
+	return b
+}
+
+// setRegion switches the console to the timings of a region. It takes
+// effect from the next reset.
+func (b *MainBus) setRegion(region Region) {
+	b.region = region
+	b.ppu.setRegion(region)
+	b.apu.setRegion(region)
 }
 
 func (b *MainBus) Read(addr uint16) byte {
 	data := uint8(0)
-	if b.cartridge.cpuRead(addr, &data) {
+	if b.cartridge != nil && b.cartridge.cpuRead(addr, &data) {
 		// Cartridge space
 	} else if addr <= 0x1FFF {
 		// System RAM address range
 		data = b.mem[addr&0x07FF]
 	} else if addr >= 0x2000 && addr <= 0x3FFF {
-		// PPU address range, log for now
-		fmt.Printf("PPU read: 0x%04X = 0x%02X\n", addr, data)
+		// PPU registers, mirrored every 8 bytes
+		data = b.ppu.cpuRead(addr & 0x0007)
+	} else if addr == 0x4015 {
+		// APU status
+		data = b.apu.cpuRead(addr)
+	} else if addr == 0x4016 || addr == 0x4017 {
+		// Controller ports
+		data = b.controllers[addr&0x0001].read()
+	}
+	return byte(data)
+}
+
+// Peek reads from the bus without side effects, for debugging aids such as
+// the tracer. Devices whose registers cannot be read without side effects
+// read as 0, so a trace shows operands in $2000-$401F as "= 00" where
+// nestest.log and other emulators may show a register's value.
+func (b *MainBus) Peek(addr uint16) byte {
+	data := uint8(0)
+	if b.cartridge != nil && b.cartridge.cpuRead(addr, &data) {
+		// Cartridge space
+	} else if addr <= 0x1FFF {
+		// System RAM address range
+		data = b.mem[addr&0x07FF]
 	}
 	return byte(data)
 }
 
 func (b *MainBus) Write(addr uint16, data byte) {
-	if b.cartridge.cpuWrite(addr, data) {
+	if b.cartridge != nil && b.cartridge.cpuWrite(addr, data) {
 		// The cartridge "sees all" and has the facility to veto
 		// the propagation of the bus transaction if it requires.
 		// This allows the cartridge to map any address to some
@@ -52,16 +105,140 @@ func (b *MainBus) Write(addr uint16, data byte) {
 		// System RAM address range
 		b.mem[addr&0x07FF] = data
 	} else if addr >= 0x2000 && addr <= 0x3FFF {
-		// PPU address range, log for now
-		fmt.Printf("PPU write: 0x%04X = 0x%02X\n", addr, data)
+		// PPU registers, mirrored every 8 bytes
+		b.ppu.cpuWrite(addr&0x0007, data)
+	} else if addr == 0x4014 {
+		// OAM DMA, which begins once the writing instruction completes
+		b.dmaPage = data
+		b.dmaAddr = 0x00
+		b.dmaTransfer = true
+		b.dmaDummy = true
+	} else if addr == 0x4016 {
+		// Controller strobe, shared by both ports
+		b.controllers[0].write(data)
+		b.controllers[1].write(data)
+	} else if (addr >= 0x4000 && addr <= 0x4013) || addr == 0x4015 || addr == 0x4017 {
+		// APU registers
+		b.apu.cpuWrite(addr, data)
+	}
+}
+
+// runFrame clocks the system until the PPU has finished drawing a frame.
+func (b *MainBus) runFrame() {
+	for !b.ppu.frameComplete {
+		b.Clock()
 	}
+	b.ppu.frameComplete = false
+}
+
+// setNMI drives the CPU's NMI line on behalf of a device on the bus.
+func (b *MainBus) setNMI(asserted bool) {
+	b.cpu.SetNMI(asserted)
+}
+
+// setIRQ drives the CPU's IRQ line on behalf of a device on the bus.
+func (b *MainBus) setIRQ(source cpu.IRQSource, asserted bool) {
+	b.cpu.SetIRQ(source, asserted)
 }
 
 func (b *MainBus) insertCartridge(cartridge *Cartridge) {
 	b.cartridge = cartridge
+	b.ppu.connectCartridge(cartridge)
+}
+
+// Clock advances the system by one tick of the master clock.
+//
+// The master clock runs at the PPU's rate, and the CPU and APU are
+// clocked on every third tick, or five times every sixteen ticks on PAL
+// consoles. On ticks where both run, the CPU goes first, so it sees the
+// PPU at the dot its cycle starts on, as nestest.log does.
+func (b *MainBus) Clock() {
+	timing := b.region.timing()
+	b.cpuPhase += timing.cpuCycles
+	if b.cpuPhase >= timing.ppuDots {
+		b.cpuPhase -= timing.ppuDots
+
+		if b.dmaTransfer && b.cpu.Complete() {
+			b.clockDMA()
+		} else {
+			b.cpu.Clock()
+		}
+		b.apu.Clock()
+		b.setIRQ(cpu.IRQFrameCounter, b.apu.irqAsserted())
+		b.setIRQ(cpu.IRQDMC, b.apu.dmcIRQAsserted())
+		if b.cartridge != nil {
+			b.setIRQ(cpu.IRQMapper, b.cartridge.irqState())
+		}
+		b.cpuCycle++
+	}
+
+	b.ppu.Clock()
+
+	// The PPU holds its NMI output for as long as it is in vertical blank
+	// with NMIs enabled; the CPU reacts to the rising edge
+	b.setNMI(b.ppu.nmiAsserted())
+
+	b.systemClockCounter++
+}
+
+// clockDMA performs one CPU cycle of an OAM DMA transfer.
+//
+// The DMA unit reads on even CPU cycles and writes on odd ones. The CPU is
+// halted for one cycle, plus one more if needed to line up with a read
+// cycle, followed by 256 read/write pairs: 513 or 514 cycles in all.
+func (b *MainBus) clockDMA() {
+	cycle := b.cpuCycle
+
+	if b.dmaDummy {
+		if cycle%2 == 1 {
+			b.dmaDummy = false
+		}
+		return
+	}
+
+	if cycle%2 == 0 {
+		b.dmaData = b.Read(uint16(b.dmaPage)<<8 | uint16(b.dmaAddr))
+		return
+	}
+
+	// Writes go through OAMDATA, so they start at the current OAMADDR
+	b.ppu.cpuWrite(0x0004, b.dmaData)
+	b.dmaAddr++
+	if b.dmaAddr == 0x00 {
+		b.dmaTransfer = false
+	}
+}
+
+// stallForDMC holds the CPU off the bus while the DMC fetches a sample
+// byte. A fetch that lands during OAM DMA only takes two cycles, as the CPU
+// is already halted and the fetch slots in between the DMA's own cycles.
+func (b *MainBus) stallForDMC(cycles int) {
+	if b.dmaTransfer {
+		cycles = 2
+	}
+	b.cpu.Stall(cycles)
+}
+
+// enableTrace writes a nestest.log style trace of every instruction the
+// CPU executes to w.
+func (b *MainBus) enableTrace(w io.Writer) {
+	tracer := cpu.NewTracer(w)
+	tracer.PPUPosition = b.ppu.position
+	b.cpu.SetTracer(tracer)
 }
 
 func (b *MainBus) Reset() {
+	if b.cartridge != nil {
+		b.cartridge.reset()
+	}
+	b.ppu.Reset()
+	b.apu.Reset()
 	b.cpu.Reset()
+	b.dmaTransfer = false
 	b.systemClockCounter = 0
+
+	// Start one tick short of a CPU cycle, so the CPU runs on the first
+	timing := b.region.timing()
+	b.cpuPhase = timing.ppuDots - timing.cpuCycles
+	b.cpuCycle = 0
 }
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	cpu6502 "github.com/drewwalton19216801/gones/cpu"
+)
+
+func TestMainBusWithoutCartridge(t *testing.T) {
+	tests := []struct {
+		name  string
+		write uint16
+		read  uint16
+		value byte
+		want  byte
+	}{
+		{"RAM", 0x0123, 0x0123, 0x5A, 0x5A},
+		{"RAM mirror", 0x0123, 0x1923, 0x5A, 0x5A},
+		{"PRG RAM space", 0x6000, 0x6000, 0x5A, 0x00},
+		{"PRG ROM space", 0x8000, 0x8000, 0x5A, 0x00},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := NewBus(cpu6502.New())
+			b.Write(test.write, test.value)
+			if got := b.Read(test.read); got != test.want {
+				t.Errorf("Read($%04X) = $%02X, want $%02X", test.read, got, test.want)
+			}
+			if got := b.Peek(test.read); got != test.want {
+				t.Errorf("Peek($%04X) = $%02X, want $%02X", test.read, got, test.want)
+			}
+		})
+	}
+}
+
+func TestMainBusControllerPorts(t *testing.T) {
+	b := NewBus(cpu6502.New())
+	b.controllers[0].SetButtons(ButtonA | ButtonSelect)
+	b.controllers[1].SetButtons(ButtonB)
+
+	// One strobe write to $4016 latches both ports
+	b.Write(0x4016, 1)
+	b.Write(0x4016, 0)
+
+	want := [2][]byte{
+		{0x41, 0x40, 0x41, 0x40},
+		{0x40, 0x41, 0x40, 0x40},
+	}
+	for i := range want[0] {
+		for port, addr := range []uint16{0x4016, 0x4017} {
+			if got := b.Read(addr); got != want[port][i] {
+				t.Errorf("read %d of $%04X = $%02X, want $%02X", i, addr, got, want[port][i])
+			}
+		}
+	}
+}
+
+func TestMainBusTrace(t *testing.T) {
+	// The code nestest runs from $C000 on its way to the first test, in
+	// an NROM-128 image whose reset vector points at $C000
+	prg := make([]byte, prgROMUnit)
+	copy(prg[0x0000:], []byte{0x4C, 0xF5, 0xC5})
+	copy(prg[0x05F5:], []byte{0xA2, 0x00, 0x86, 0x00, 0x86, 0x10, 0x86, 0x11, 0x20, 0x2D, 0xC7})
+	copy(prg[0x072D:], []byte{0xEA, 0x38, 0xB0, 0x04})
+	copy(prg[0x0735:], []byte{0xEA})
+	prg[0x3FFC], prg[0x3FFD] = 0x00, 0xC0
+	h := header(1, 1)
+	cart := loadTestImage(t, bytes.Join([][]byte{h[:], prg, make([]byte, chrROMUnit)}, nil))
+
+	// The first lines of nestest.log
+	want := []string{
+		"C000  4C F5 C5  JMP $C5F5                       A:00 X:00 Y:00 P:24 SP:FD PPU:  0, 21 CYC:7",
+		"C5F5  A2 00     LDX #$00                        A:00 X:00 Y:00 P:24 SP:FD PPU:  0, 30 CYC:10",
+		"C5F7  86 00     STX $00 = 00                    A:00 X:00 Y:00 P:26 SP:FD PPU:  0, 36 CYC:12",
+		"C5F9  86 10     STX $10 = 00                    A:00 X:00 Y:00 P:26 SP:FD PPU:  0, 45 CYC:15",
+		"C5FB  86 11     STX $11 = 00                    A:00 X:00 Y:00 P:26 SP:FD PPU:  0, 54 CYC:18",
+		"C5FD  20 2D C7  JSR $C72D                       A:00 X:00 Y:00 P:26 SP:FD PPU:  0, 63 CYC:21",
+		"C72D  EA        NOP                             A:00 X:00 Y:00 P:26 SP:FB PPU:  0, 81 CYC:27",
+		"C72E  38        SEC                             A:00 X:00 Y:00 P:26 SP:FB PPU:  0, 87 CYC:29",
+		"C72F  B0 04     BCS $C735                       A:00 X:00 Y:00 P:27 SP:FB PPU:  0, 93 CYC:31",
+		"C735  EA        NOP                             A:00 X:00 Y:00 P:27 SP:FB PPU:  0,102 CYC:34",
+	}
+
+	var trace bytes.Buffer
+	b := newConsole(cart, RegionNTSC)
+	b.enableTrace(&trace)
+	for strings.Count(trace.String(), "\n") < len(want) {
+		b.Clock()
+	}
+
+	got := strings.Split(trace.String(), "\n")
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("line %d:\n got %q\nwant %q", i+1, got[i], want[i])
+		}
+	}
+}
+
+func TestMainBusOAMDMA(t *testing.T) {
+	tests := []struct {
+		name    string
+		program []byte
+		sta     int  // Which instruction is the STA $4014
+		dmc     bool // Start a DMC fetch part way through the transfer
+		stall   int  // CPU cycles between STA $4014 and the next instruction
+	}{
+		// Reset ends on cycle 6, so the STA finishes on an even cycle and
+		// the transfer starts on an odd one
+		{"started on an odd cycle", []byte{0xA9, 0x02, 0x8D, 0x14, 0x40, 0xEA}, 1, false, 513},
+		// LDA $00 takes one cycle more than LDA #$02, so the transfer
+		// starts on an even cycle and waits one more to align
+		{"started on an even cycle", []byte{0xA5, 0x00, 0xA9, 0x02, 0x8D, 0x14, 0x40, 0xEA}, 2, false, 514},
+		{"with a DMC fetch", []byte{0xA9, 0x02, 0x8D, 0x14, 0x40, 0xEA}, 1, true, 515},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cart := loadTestImage(t, testImage(t, 0, 1, 1, test.program))
+			b := newConsole(cart, RegionNTSC)
+			for i := 0; i < 0x100; i++ {
+				b.mem[0x0200+i] = byte(i ^ 0x5A)
+			}
+
+			// Note the bus cycle every instruction starts on
+			var starts []uint64
+			tracer := cpu6502.NewTracer(io.Discard)
+			tracer.PPUPosition = func() (int, int) {
+				starts = append(starts, b.cpuCycle)
+				return 0, 0
+			}
+			b.cpu.SetTracer(tracer)
+
+			for len(starts) < test.sta+2 {
+				b.Clock()
+				if test.dmc && b.dmaTransfer && b.dmaAddr == 0x40 && b.apu.cpuRead(0x4015)&statusDMC == 0 {
+					b.apu.cpuWrite(0x4015, statusDMC)
+				}
+			}
+
+			if stall := int(starts[test.sta+1]-starts[test.sta]) - 4; stall != test.stall {
+				t.Errorf("CPU stalled for %d cycles, want %d", stall, test.stall)
+			}
+			for i := 0; i < 0x100; i++ {
+				if b.ppu.oam[i] != byte(i^0x5A) {
+					t.Fatalf("OAM[$%02X] = $%02X, want $%02X", i, b.ppu.oam[i], byte(i^0x5A))
+				}
+			}
+		})
+	}
+}
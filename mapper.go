@@ -1,10 +1,229 @@
 package main
 
+import (
+	"fmt"
+	"sort"
+)
+
+// mappedAddressMapper is returned by a mapper's cpuMapRead and cpuMapWrite
+// in place of a PRG ROM offset when the mapper handled the access itself,
+// for example because it was to RAM on the cartridge.
+const mappedAddressMapper = 0xFFFFFFFF
+
 type Mapper interface {
 	// Transform CPU bus address to PRG ROM address
-	cpuMapRead(addr uint16, mappedAddress *uint32) bool
-	cpuMapWrite(addr uint16, mappedAddress *uint32) bool
+	cpuMapRead(addr uint16, mappedAddress *uint32, data *byte) bool
+	cpuMapWrite(addr uint16, mappedAddress *uint32, data byte) bool
 	// Transform PPU bus address to CHR ROM offset
 	ppuMapRead(addr uint16, mappedAddress *uint32) bool
 	ppuMapWrite(addr uint16, mappedAddress *uint32) bool
+
+	// Return the mapper to its power-up state
+	reset()
+
+	// Nametable mirroring currently selected by the mapper, or Hardware if
+	// it is fixed by the cartridge's wiring
+	mirror() Mirror
+
+	// Watch an address the PPU puts on its bus at the given PPU dot,
+	// counted from power on
+	ppuAddress(addr uint16, ppuCycle uint64)
+
+	// Whether the mapper is asserting the CPU's IRQ line
+	irqState() bool
+}
+
+// MapperConfig describes the cartridge hardware a mapper is being built
+// for, as given by the ROM's header.
+type MapperConfig struct {
+	Mapper    uint16
+	Submapper byte
+
+	PRGBanks uint8 // 16K units of PRG ROM
+	CHRBanks uint8 // 8K units of CHR ROM; 0 means the board has CHR RAM
+
+	PRGRAMSize   int // Bytes of volatile PRG RAM
+	PRGNVRAMSize int // Bytes of battery backed PRG RAM
+	CHRRAMSize   int // Bytes of volatile CHR RAM
+	CHRNVRAMSize int // Bytes of battery backed CHR RAM
+
+	// The board has its own nametable RAM, so the mapper can't change the
+	// mirroring
+	FourScreen bool
+}
+
+// MapperConstructor builds a mapper for the given hardware.
+type MapperConstructor func(config MapperConfig) Mapper
+
+// AnySubmapper registers a constructor for every submapper of a mapper
+// that is not registered on its own.
+const AnySubmapper = -1
+
+// BusConflicts says whether a board has bus conflicts. On boards with no
+// way to disable the ROM during writes, the ROM drives the data bus at the
+// same time as the CPU, and the mapper sees the AND of the two.
+type BusConflicts int
+
+const (
+	// BusConflictsNever is for boards that disable the ROM during writes,
+	// which includes every ASIC mapper
+	BusConflictsNever BusConflicts = iota
+
+	// BusConflictsOptional is for discrete logic boards that may or may
+	// not have bus conflicts. They are only emulated when asked for.
+	BusConflictsOptional
+
+	// BusConflictsAlways is for boards known to have bus conflicts
+	BusConflictsAlways
+)
+
+var busConflictsNames = [...]string{"no", "optional", "yes"}
+
+func (b BusConflicts) String() string {
+	if int(b) < len(busConflictsNames) {
+		return busConflictsNames[b]
+	}
+	return fmt.Sprintf("BusConflicts(%d)", int(b))
+}
+
+// MapperInfo describes a registered mapper.
+type MapperInfo struct {
+	Number       uint16
+	Submapper    int // A submapper number, or AnySubmapper
+	Name         string
+	Boards       string
+	BusConflicts BusConflicts
+
+	constructor MapperConstructor
+}
+
+type mapperKey struct {
+	number    uint16
+	submapper int
+}
+
+// mapperRegistry holds every mapper gones supports. Each mapper registers
+// itself from an init function in its own file.
+var mapperRegistry = map[mapperKey]MapperInfo{}
+
+// registerMapper adds a mapper to the registry. Registering the same mapper
+// and submapper twice is a programming error.
+func registerMapper(info MapperInfo, constructor MapperConstructor) {
+	key := mapperKey{info.Number, info.Submapper}
+	if _, ok := mapperRegistry[key]; ok {
+		panic(fmt.Sprintf("mapper %d submapper %d registered twice", info.Number, info.Submapper))
+	}
+	info.constructor = constructor
+	mapperRegistry[key] = info
+}
+
+// registerDiscreteMapper registers a discrete logic mapper whose NES 2.0
+// submappers say whether the board has bus conflicts: submapper 1 means it
+// doesn't, submapper 2 means it does, and any other leaves it unknown.
+func registerDiscreteMapper(info MapperInfo, constructor MapperConstructor) {
+	info.Submapper = AnySubmapper
+	info.BusConflicts = BusConflictsOptional
+	registerMapper(info, constructor)
+
+	info.Submapper = 1
+	info.BusConflicts = BusConflictsNever
+	registerMapper(info, constructor)
+
+	info.Submapper = 2
+	info.BusConflicts = BusConflictsAlways
+	registerMapper(info, constructor)
+}
+
+// lookupMapper finds the constructor for a mapper and submapper, preferring
+// one registered for the exact submapper.
+func lookupMapper(number uint16, submapper byte) (MapperInfo, bool) {
+	if info, ok := mapperRegistry[mapperKey{number, int(submapper)}]; ok {
+		return info, true
+	}
+	info, ok := mapperRegistry[mapperKey{number, AnySubmapper}]
+	return info, ok
+}
+
+// UnsupportedMapperError is returned when a ROM image needs a mapper that
+// has not been implemented.
+type UnsupportedMapperError struct {
+	Mapper    uint16
+	Submapper byte
+}
+
+func (e *UnsupportedMapperError) Error() string {
+	if e.Submapper != 0 {
+		return fmt.Sprintf("unsupported mapper %d (submapper %d)", e.Mapper, e.Submapper)
+	}
+	return fmt.Sprintf("unsupported mapper %d", e.Mapper)
+}
+
+// newMapper builds the mapper described by config, and returns it with its
+// registration, or returns an error if it is not supported.
+func newMapper(config MapperConfig) (Mapper, MapperInfo, error) {
+	info, ok := lookupMapper(config.Mapper, config.Submapper)
+	if !ok {
+		return nil, info, &UnsupportedMapperError{Mapper: config.Mapper, Submapper: config.Submapper}
+	}
+	return info.constructor(config), info, nil
+}
+
+// registeredMappers returns every registered mapper, ordered by number and
+// submapper.
+func registeredMappers() []MapperInfo {
+	mappers := make([]MapperInfo, 0, len(mapperRegistry))
+	for _, info := range mapperRegistry {
+		mappers = append(mappers, info)
+	}
+	sort.Slice(mappers, func(i, j int) bool {
+		if mappers[i].Number != mappers[j].Number {
+			return mappers[i].Number < mappers[j].Number
+		}
+		return mappers[i].Submapper < mappers[j].Submapper
+	})
+	return mappers
+}
+
+// prgRAMSize returns the bytes of PRG RAM on the board, battery backed or
+// not.
+func (config MapperConfig) prgRAMSize() int {
+	return config.PRGRAMSize + config.PRGNVRAMSize
+}
+
+// chrRAMSize returns the bytes of CHR RAM on a board without CHR ROM. Old
+// headers can't give a size, and every board has at least 8K.
+func (config MapperConfig) chrRAMSize() int {
+	return max(config.CHRRAMSize+config.CHRNVRAMSize, 0x2000)
+}
+
+// prgRAM is RAM on the cartridge at $6000-$7FFF. RAM smaller than the 8K
+// window is mirrored through it; of larger RAM, which some mappers bank,
+// the first 8K is shown. Mappers hold one whether or not the board has
+// any RAM, as even discrete logic boards sometimes do; an empty prgRAM
+// leaves the window unmapped.
+type prgRAM []byte
+
+func newPRGRAM(size int) prgRAM {
+	return make(prgRAM, size)
+}
+
+// read reads the RAM if addr is in its window, for a mapper's cpuMapRead.
+func (ram prgRAM) read(addr uint16, mappedAddress *uint32, data *byte) bool {
+	if addr < 0x6000 || addr > 0x7FFF || len(ram) == 0 {
+		return false
+	}
+	*mappedAddress = mappedAddressMapper
+	*data = ram[int(addr&0x1FFF)%len(ram)]
+	return true
+}
+
+// write writes the RAM if addr is in its window, for a mapper's
+// cpuMapWrite.
+func (ram prgRAM) write(addr uint16, mappedAddress *uint32, data byte) bool {
+	if addr < 0x6000 || addr > 0x7FFF || len(ram) == 0 {
+		return false
+	}
+	*mappedAddress = mappedAddressMapper
+	ram[int(addr&0x1FFF)%len(ram)] = data
+	return true
 }
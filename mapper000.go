@@ -3,9 +3,35 @@ package main
 type Mapper000 struct {
 	prgBanks uint8
 	chrBanks uint8
+
+	ramStatic prgRAM
+}
+
+func init() {
+	registerMapper(MapperInfo{
+		Number:    0,
+		Submapper: AnySubmapper,
+		Name:      "NROM",
+		Boards:    "NROM-128, NROM-256",
+	}, func(config MapperConfig) Mapper {
+		return NewMapper000(config)
+	})
+}
+
+func NewMapper000(config MapperConfig) *Mapper000 {
+	return &Mapper000{
+		prgBanks: config.PRGBanks,
+		chrBanks: config.CHRBanks,
+
+		ramStatic: newPRGRAM(config.prgRAMSize()),
+	}
 }
 
-func (m *Mapper000) cpuMapRead(addr uint16, mappedAddress *uint32) bool {
+func (m *Mapper000) cpuMapRead(addr uint16, mappedAddress *uint32, data *byte) bool {
+	if m.ramStatic.read(addr, mappedAddress, data) {
+		return true
+	}
+
 	if addr >= 0x8000 && addr <= 0xFFFF {
 		if uint16(m.prgBanks) > 1 {
 			*mappedAddress = uint32(addr & 0x7FFF)
@@ -17,7 +43,11 @@ func (m *Mapper000) cpuMapRead(addr uint16, mappedAddress *uint32) bool {
 	return false
 }
 
-func (m *Mapper000) cpuMapWrite(addr uint16, mappedAddress *uint32) bool {
+func (m *Mapper000) cpuMapWrite(addr uint16, mappedAddress *uint32, data byte) bool {
+	if m.ramStatic.write(addr, mappedAddress, data) {
+		return true
+	}
+
 	if addr >= 0x8000 && addr <= 0xFFFF {
 		if m.prgBanks > 1 {
 			*mappedAddress = uint32(addr & 0x7FFF)
@@ -30,9 +60,32 @@ func (m *Mapper000) cpuMapWrite(addr uint16, mappedAddress *uint32) bool {
 }
 
 func (m *Mapper000) ppuMapRead(addr uint16, mappedAddress *uint32) bool {
-	return true
+	if addr <= 0x1FFF {
+		*mappedAddress = uint32(addr)
+		return true
+	}
+	return false
 }
 
 func (m *Mapper000) ppuMapWrite(addr uint16, mappedAddress *uint32) bool {
-	return true
+	if addr <= 0x1FFF {
+		if m.chrBanks == 0 {
+			// Treat as CHR RAM
+			*mappedAddress = uint32(addr)
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Mapper000) reset() {}
+
+func (m *Mapper000) mirror() Mirror {
+	return Hardware
+}
+
+func (m *Mapper000) ppuAddress(addr uint16, ppuCycle uint64) {}
+
+func (m *Mapper000) irqState() bool {
+	return false
 }
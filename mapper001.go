@@ -0,0 +1,206 @@
+package main
+
+// Mapper001 is Nintendo's MMC1.
+//
+// Its registers are loaded one bit at a time through a serial port: five
+// writes to $8000-$FFFF shift bit 0 of the data into a load register, and
+// the address of the fifth write picks which internal register receives
+// the value. Writing a value with bit 7 set resets the load register and
+// puts PRG ROM in its power-up bank mode.
+type Mapper001 struct {
+	prgBanks uint8
+	chrBanks uint8
+
+	loadRegister      byte
+	loadRegisterCount byte
+
+	// The internal registers hold the values as written. Bank numbers are
+	// decoded on each access from the modes in the control register, so
+	// that they follow later changes of mode.
+	controlRegister byte
+	chrBank0        byte
+	chrBank1        byte
+	prgBank         byte
+
+	// PRG RAM at $6000-$7FFF, usually 8K
+	ramStatic prgRAM
+}
+
+func init() {
+	registerMapper(MapperInfo{
+		Number:    1,
+		Submapper: AnySubmapper,
+		Name:      "MMC1",
+		Boards:    "SxROM",
+	}, func(config MapperConfig) Mapper {
+		return NewMapper001(config)
+	})
+}
+
+func NewMapper001(config MapperConfig) *Mapper001 {
+	m := &Mapper001{
+		prgBanks: config.PRGBanks,
+		chrBanks: config.CHRBanks,
+
+		ramStatic: newPRGRAM(config.prgRAMSize()),
+	}
+	m.reset()
+	return m
+}
+
+func (m *Mapper001) cpuMapRead(addr uint16, mappedAddress *uint32, data *byte) bool {
+	if m.ramStatic.read(addr, mappedAddress, data) {
+		// Read from static RAM on the cartridge
+		return true
+	}
+
+	if addr >= 0x8000 {
+		switch (m.controlRegister >> 2) & 0x03 {
+		case 0, 1:
+			// Switch 32K at $8000, ignoring the low bit of the bank
+			*mappedAddress = m.prgOffset((m.prgBank&0x0E)>>1, 0x8000) + uint32(addr&0x7FFF)
+		case 2:
+			// Fix first bank at $8000 and switch 16K bank at $C000
+			if addr <= 0xBFFF {
+				*mappedAddress = uint32(addr & 0x3FFF)
+			} else {
+				*mappedAddress = m.prgOffset(m.prgBank&0x0F, 0x4000) + uint32(addr&0x3FFF)
+			}
+		case 3:
+			// Fix last bank at $C000 and switch 16K bank at $8000
+			if addr <= 0xBFFF {
+				*mappedAddress = m.prgOffset(m.prgBank&0x0F, 0x4000) + uint32(addr&0x3FFF)
+			} else {
+				*mappedAddress = m.prgOffset(m.prgBanks-1, 0x4000) + uint32(addr&0x3FFF)
+			}
+		}
+		return true
+	}
+
+	return false
+}
+
+func (m *Mapper001) cpuMapWrite(addr uint16, mappedAddress *uint32, data byte) bool {
+	if m.ramStatic.write(addr, mappedAddress, data) {
+		// Write to static RAM on the cartridge
+		return true
+	}
+
+	if addr >= 0x8000 {
+		if data&0x80 != 0 {
+			// Reset the serial loading
+			m.loadRegister = 0x00
+			m.loadRegisterCount = 0
+			m.controlRegister |= 0x0C
+		} else {
+			// Load data in serially into the load register, LSB first
+			m.loadRegister >>= 1
+			m.loadRegister |= (data & 0x01) << 4
+			m.loadRegisterCount++
+
+			if m.loadRegisterCount == 5 {
+				// Bits 13 and 14 of the address select the target
+				// register
+				m.writeRegister((addr>>13)&0x03, m.loadRegister)
+
+				m.loadRegister = 0x00
+				m.loadRegisterCount = 0
+			}
+		}
+	}
+
+	// Mapper has handled the write, but do not update ROMs
+	return false
+}
+
+// writeRegister stores a fully loaded value in one of the four internal
+// registers.
+func (m *Mapper001) writeRegister(target uint16, value byte) {
+	switch target {
+	case 0: // $8000-$9FFF: Control
+		m.controlRegister = value
+	case 1: // $A000-$BFFF: CHR bank 0
+		m.chrBank0 = value
+	case 2: // $C000-$DFFF: CHR bank 1
+		m.chrBank1 = value
+	case 3: // $E000-$FFFF: PRG bank
+		m.prgBank = value
+	}
+}
+
+func (m *Mapper001) ppuMapRead(addr uint16, mappedAddress *uint32) bool {
+	if addr > 0x1FFF {
+		return false
+	}
+
+	if m.chrBanks == 0 {
+		// CHR RAM is not banked
+		*mappedAddress = uint32(addr)
+		return true
+	}
+
+	if m.controlRegister&0b10000 != 0 {
+		// 4K CHR bank mode
+		if addr <= 0x0FFF {
+			*mappedAddress = m.chrOffset(m.chrBank0, 0x1000) + uint32(addr&0x0FFF)
+		} else {
+			*mappedAddress = m.chrOffset(m.chrBank1, 0x1000) + uint32(addr&0x0FFF)
+		}
+	} else {
+		// 8K CHR bank mode, ignoring the low bit of CHR bank 0
+		*mappedAddress = m.chrOffset(m.chrBank0>>1, 0x2000) + uint32(addr&0x1FFF)
+	}
+	return true
+}
+
+func (m *Mapper001) ppuMapWrite(addr uint16, mappedAddress *uint32) bool {
+	if addr <= 0x1FFF && m.chrBanks == 0 {
+		// Treat as CHR RAM
+		*mappedAddress = uint32(addr)
+		return true
+	}
+	return false
+}
+
+func (m *Mapper001) reset() {
+	m.controlRegister = 0x1C
+	m.loadRegister = 0x00
+	m.loadRegisterCount = 0
+
+	m.chrBank0 = 0
+	m.chrBank1 = 0
+	m.prgBank = 0
+}
+
+func (m *Mapper001) mirror() Mirror {
+	switch m.controlRegister & 0x03 {
+	case 0:
+		return OnScreenLo
+	case 1:
+		return OnScreenHi
+	case 2:
+		return Vertical
+	default:
+		return Horizontal
+	}
+}
+
+func (m *Mapper001) ppuAddress(addr uint16, ppuCycle uint64) {}
+
+func (m *Mapper001) irqState() bool {
+	return false
+}
+
+// prgOffset returns the offset into PRG ROM of a bank of the given size,
+// wrapping bank numbers beyond the end of the ROM.
+func (m *Mapper001) prgOffset(bank byte, size uint32) uint32 {
+	total := uint32(m.prgBanks) * 0x4000
+	return (uint32(bank) * size) % total
+}
+
+// chrOffset returns the offset into CHR ROM of a bank of the given size,
+// wrapping bank numbers beyond the end of the ROM.
+func (m *Mapper001) chrOffset(bank byte, size uint32) uint32 {
+	total := uint32(m.chrBanks) * 0x2000
+	return (uint32(bank) * size) % total
+}
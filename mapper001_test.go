@@ -0,0 +1,208 @@
+package main
+
+import "testing"
+
+// mmc1Write is a write to an MMC1 register through the serial port, or,
+// with reset set, a write with bit 7 set. Setting bits stops the serial
+// load after that many bits.
+type mmc1Write struct {
+	addr  uint16
+	value byte
+	reset bool
+	bits  int
+}
+
+func (w mmc1Write) apply(m *Mapper001) {
+	var mapped uint32
+	if w.reset {
+		m.cpuMapWrite(w.addr, &mapped, 0x80)
+		return
+	}
+	bits := 5
+	if w.bits != 0 {
+		bits = w.bits
+	}
+	for i := 0; i < bits; i++ {
+		m.cpuMapWrite(w.addr, &mapped, (w.value>>i)&0x01)
+	}
+}
+
+// Registers, by the address range that selects them
+const (
+	mmc1Control = 0x8000
+	mmc1CHR0    = 0xA000
+	mmc1CHR1    = 0xC000
+	mmc1PRG     = 0xE000
+)
+
+func TestMapper001Banking(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []mmc1Write
+
+		prg8000 uint32 // PRG ROM offsets at $8000 and $C000
+		prgC000 uint32
+		chr0000 uint32 // CHR ROM offsets at PPU $0000 and $1000
+		chr1000 uint32
+		mirror  Mirror
+	}{
+		{
+			name:    "power up",
+			prg8000: 0x00000, prgC000: 0x1C000,
+			chr0000: 0x0000, chr1000: 0x0000,
+			mirror: OnScreenLo,
+		},
+		{
+			name:    "16K bank at $8000",
+			writes:  []mmc1Write{{addr: mmc1PRG, value: 5}},
+			prg8000: 0x14000, prgC000: 0x1C000,
+			chr0000: 0x0000, chr1000: 0x0000,
+			mirror: OnScreenLo,
+		},
+		{
+			name:    "32K mode after PRG bank write",
+			writes:  []mmc1Write{{addr: mmc1PRG, value: 5}, {addr: mmc1Control, value: 0x00}},
+			prg8000: 0x10000, prgC000: 0x14000,
+			chr0000: 0x0000, chr1000: 0x1000,
+			mirror: OnScreenLo,
+		},
+		{
+			name:    "fixed first bank mode after PRG bank write",
+			writes:  []mmc1Write{{addr: mmc1PRG, value: 5}, {addr: mmc1Control, value: 0x0A}},
+			prg8000: 0x00000, prgC000: 0x14000,
+			chr0000: 0x0000, chr1000: 0x1000,
+			mirror: Vertical,
+		},
+		{
+			name: "bit 7 reset fixes the last bank at $C000 again",
+			writes: []mmc1Write{
+				{addr: mmc1Control, value: 0x0B},
+				{addr: mmc1PRG, value: 3},
+				{addr: 0x8000, reset: true},
+			},
+			prg8000: 0x0C000, prgC000: 0x1C000,
+			chr0000: 0x0000, chr1000: 0x1000,
+			mirror: Horizontal,
+		},
+		{
+			name: "bit 7 reset from 32K mode",
+			writes: []mmc1Write{
+				{addr: mmc1Control, value: 0x01},
+				{addr: mmc1PRG, value: 6},
+				{addr: 0xFFFF, reset: true},
+			},
+			prg8000: 0x18000, prgC000: 0x1C000,
+			chr0000: 0x0000, chr1000: 0x1000,
+			mirror: OnScreenHi,
+		},
+		{
+			name: "bit 7 reset discards a partial load",
+			writes: []mmc1Write{
+				{addr: mmc1Control, value: 0x0F},
+				{addr: mmc1PRG, value: 0x1F, bits: 3},
+				{addr: mmc1PRG, reset: true},
+				{addr: mmc1PRG, value: 2},
+			},
+			prg8000: 0x08000, prgC000: 0x1C000,
+			chr0000: 0x0000, chr1000: 0x1000,
+			mirror: Horizontal,
+		},
+		{
+			name: "8K CHR mode ignores the low bit",
+			writes: []mmc1Write{
+				{addr: mmc1Control, value: 0x0C},
+				{addr: mmc1CHR0, value: 3},
+				{addr: mmc1CHR1, value: 5},
+			},
+			prg8000: 0x00000, prgC000: 0x1C000,
+			chr0000: 0x2000, chr1000: 0x3000,
+			mirror: OnScreenLo,
+		},
+		{
+			name: "4K CHR mode after CHR bank writes in 8K mode",
+			writes: []mmc1Write{
+				{addr: mmc1Control, value: 0x0C},
+				{addr: mmc1CHR0, value: 3},
+				{addr: mmc1CHR1, value: 5},
+				{addr: mmc1Control, value: 0x1C},
+			},
+			prg8000: 0x00000, prgC000: 0x1C000,
+			chr0000: 0x3000, chr1000: 0x5000,
+			mirror: OnScreenLo,
+		},
+		{
+			name: "8K CHR mode after 4K CHR bank writes",
+			writes: []mmc1Write{
+				{addr: mmc1Control, value: 0x1C},
+				{addr: mmc1CHR0, value: 3},
+				{addr: mmc1CHR1, value: 5},
+				{addr: mmc1Control, value: 0x0C},
+			},
+			prg8000: 0x00000, prgC000: 0x1C000,
+			chr0000: 0x2000, chr1000: 0x3000,
+			mirror: OnScreenLo,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// 128K of PRG ROM and 32K of CHR ROM
+			m := NewMapper001(MapperConfig{Mapper: 1, PRGBanks: 8, CHRBanks: 4, PRGRAMSize: 8192})
+			for _, w := range test.writes {
+				w.apply(m)
+			}
+
+			var mapped uint32
+			var data byte
+			for _, check := range []struct {
+				addr uint16
+				want uint32
+			}{{0x8000, test.prg8000}, {0xC000, test.prgC000}} {
+				if !m.cpuMapRead(check.addr, &mapped, &data) || mapped != check.want {
+					t.Errorf("$%04X maps to $%05X, want $%05X", check.addr, mapped, check.want)
+				}
+			}
+			for _, check := range []struct {
+				addr uint16
+				want uint32
+			}{{0x0000, test.chr0000}, {0x1000, test.chr1000}} {
+				if !m.ppuMapRead(check.addr, &mapped) || mapped != check.want {
+					t.Errorf("PPU $%04X maps to $%05X, want $%05X", check.addr, mapped, check.want)
+				}
+			}
+			if got := m.mirror(); got != test.mirror {
+				t.Errorf("mirroring %v, want %v", got, test.mirror)
+			}
+		})
+	}
+}
+
+func TestMapper001PRGRAM(t *testing.T) {
+	tests := []struct {
+		name string
+		size int
+		addr uint16
+		want bool // Whether the RAM is mapped
+	}{
+		{"8K at $6000", 8192, 0x6000, true},
+		{"8K at $7FFF", 8192, 0x7FFF, true},
+		{"none", 0, 0x6000, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := NewMapper001(MapperConfig{Mapper: 1, PRGBanks: 2, PRGNVRAMSize: test.size})
+
+			var mapped uint32
+			wrote := m.cpuMapWrite(test.addr, &mapped, 0xA5)
+			var data byte
+			read := m.cpuMapRead(test.addr, &mapped, &data)
+			if wrote != test.want || read != test.want {
+				t.Fatalf("write mapped %v, read mapped %v, want %v", wrote, read, test.want)
+			}
+			if test.want && data != 0xA5 {
+				t.Errorf("read $%02X, want $A5", data)
+			}
+		})
+	}
+}
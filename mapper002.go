@@ -0,0 +1,97 @@
+package main
+
+// Mapper002 is UxROM: a switchable 16K PRG bank at $8000 and the last bank
+// fixed at $C000. The boards have CHR RAM rather than CHR ROM.
+type Mapper002 struct {
+	prgBanks uint8
+	chrBanks uint8
+
+	ramStatic prgRAM
+
+	prgBankSelectLo uint8
+	prgBankSelectHi uint8
+}
+
+func init() {
+	registerDiscreteMapper(MapperInfo{
+		Number: 2,
+		Name:   "UxROM",
+		Boards: "UNROM, UOROM",
+	}, func(config MapperConfig) Mapper {
+		return NewMapper002(config)
+	})
+}
+
+func NewMapper002(config MapperConfig) *Mapper002 {
+	m := &Mapper002{
+		prgBanks: config.PRGBanks,
+		chrBanks: config.CHRBanks,
+
+		ramStatic: newPRGRAM(config.prgRAMSize()),
+	}
+	m.reset()
+	return m
+}
+
+func (m *Mapper002) cpuMapRead(addr uint16, mappedAddress *uint32, data *byte) bool {
+	if m.ramStatic.read(addr, mappedAddress, data) {
+		return true
+	}
+
+	if addr >= 0x8000 && addr <= 0xBFFF {
+		*mappedAddress = uint32(m.prgBankSelectLo)*0x4000 + uint32(addr&0x3FFF)
+		return true
+	}
+
+	if addr >= 0xC000 {
+		*mappedAddress = uint32(m.prgBankSelectHi)*0x4000 + uint32(addr&0x3FFF)
+		return true
+	}
+
+	return false
+}
+
+func (m *Mapper002) cpuMapWrite(addr uint16, mappedAddress *uint32, data byte) bool {
+	if m.ramStatic.write(addr, mappedAddress, data) {
+		return true
+	}
+
+	if addr >= 0x8000 {
+		m.prgBankSelectLo = data % m.prgBanks
+	}
+
+	// Mapper has handled the write, but do not update ROMs
+	return false
+}
+
+func (m *Mapper002) ppuMapRead(addr uint16, mappedAddress *uint32) bool {
+	if addr <= 0x1FFF {
+		*mappedAddress = uint32(addr)
+		return true
+	}
+	return false
+}
+
+func (m *Mapper002) ppuMapWrite(addr uint16, mappedAddress *uint32) bool {
+	if addr <= 0x1FFF && m.chrBanks == 0 {
+		// Treat as CHR RAM
+		*mappedAddress = uint32(addr)
+		return true
+	}
+	return false
+}
+
+func (m *Mapper002) reset() {
+	m.prgBankSelectLo = 0
+	m.prgBankSelectHi = m.prgBanks - 1
+}
+
+func (m *Mapper002) mirror() Mirror {
+	return Hardware
+}
+
+func (m *Mapper002) ppuAddress(addr uint16, ppuCycle uint64) {}
+
+func (m *Mapper002) irqState() bool {
+	return false
+}
@@ -0,0 +1,94 @@
+package main
+
+// Mapper003 is CNROM: 16K or 32K of fixed PRG ROM and a switchable 8K CHR
+// ROM bank.
+type Mapper003 struct {
+	prgBanks uint8
+	chrBanks uint8
+
+	ramStatic prgRAM
+
+	chrBankSelect uint8
+}
+
+func init() {
+	registerDiscreteMapper(MapperInfo{
+		Number: 3,
+		Name:   "CNROM",
+		Boards: "CNROM",
+	}, func(config MapperConfig) Mapper {
+		return NewMapper003(config)
+	})
+}
+
+func NewMapper003(config MapperConfig) *Mapper003 {
+	m := &Mapper003{
+		prgBanks: config.PRGBanks,
+		chrBanks: config.CHRBanks,
+
+		ramStatic: newPRGRAM(config.prgRAMSize()),
+	}
+	m.reset()
+	return m
+}
+
+func (m *Mapper003) cpuMapRead(addr uint16, mappedAddress *uint32, data *byte) bool {
+	if m.ramStatic.read(addr, mappedAddress, data) {
+		return true
+	}
+
+	if addr >= 0x8000 {
+		if m.prgBanks > 1 {
+			*mappedAddress = uint32(addr & 0x7FFF)
+		} else {
+			// 16K of PRG ROM is mirrored at $C000
+			*mappedAddress = uint32(addr & 0x3FFF)
+		}
+		return true
+	}
+	return false
+}
+
+func (m *Mapper003) cpuMapWrite(addr uint16, mappedAddress *uint32, data byte) bool {
+	if m.ramStatic.write(addr, mappedAddress, data) {
+		return true
+	}
+
+	if addr >= 0x8000 && m.chrBanks > 0 {
+		m.chrBankSelect = data % m.chrBanks
+	}
+
+	// Mapper has handled the write, but do not update ROMs
+	return false
+}
+
+func (m *Mapper003) ppuMapRead(addr uint16, mappedAddress *uint32) bool {
+	if addr <= 0x1FFF {
+		*mappedAddress = uint32(m.chrBankSelect)*0x2000 + uint32(addr)
+		return true
+	}
+	return false
+}
+
+func (m *Mapper003) ppuMapWrite(addr uint16, mappedAddress *uint32) bool {
+	if addr <= 0x1FFF && m.chrBanks == 0 {
+		// Treat as CHR RAM
+		*mappedAddress = uint32(addr)
+		return true
+	}
+	return false
+}
+
+func (m *Mapper003) reset() {
+	m.chrBankSelect = 0
+}
+
+func (m *Mapper003) mirror() Mirror {
+	return Hardware
+}
+
+func (m *Mapper003) ppuAddress(addr uint16, ppuCycle uint64) {}
+
+func (m *Mapper003) irqState() bool {
+	return false
+}
@@ -0,0 +1,282 @@
+package main
+
+// mmc3A12Filter is how long, in PPU dots, A12 must have stayed low before
+// a rise counts as a scanline. The MMC3 ignores rises shortly after a fall
+// so that the eight tile fetches of one scanline clock it only once.
+const mmc3A12Filter = 10
+
+// Mapper004 is Nintendo's MMC3.
+//
+// It banks PRG ROM in 8K units and CHR ROM in 1K and 2K units through
+// eight bank registers, and counts scanlines by watching the PPU's A12
+// address line, which rises once per scanline when the background and
+// sprites use different pattern tables.
+type Mapper004 struct {
+	prgBanks   uint8
+	chrBanks   uint8
+	chrRAMSize uint32 // Bytes of CHR RAM when there are no CHR banks
+	fourScreen bool
+
+	targetRegister byte
+	prgBankMode    bool
+	chrInversion   bool
+	mirrorMode     Mirror
+
+	register [8]uint32
+	chrBank  [8]uint32 // Offsets of the eight 1K CHR windows
+	prgBank  [4]uint32 // Offsets of the four 8K PRG windows
+
+	// Scanline counter
+	irqActive   bool
+	irqEnable   bool
+	irqReload   bool
+	irqCounter  byte
+	irqLatch    byte
+	a12High     bool
+	a12LastHigh uint64
+	a12SeenHigh bool
+
+	// PRG RAM at $6000-$7FFF, which can be disabled or write protected
+	ramStatic       prgRAM
+	ramEnabled      bool
+	ramWriteProtect bool
+}
+
+func init() {
+	registerMapper(MapperInfo{
+		Number:    4,
+		Submapper: AnySubmapper,
+		Name:      "MMC3",
+		Boards:    "TxROM",
+	}, func(config MapperConfig) Mapper {
+		return NewMapper004(config)
+	})
+}
+
+func NewMapper004(config MapperConfig) *Mapper004 {
+	m := &Mapper004{
+		prgBanks: config.PRGBanks,
+		chrBanks: config.CHRBanks,
+
+		ramStatic: newPRGRAM(config.prgRAMSize()),
+
+		chrRAMSize: uint32(config.chrRAMSize()),
+		fourScreen: config.FourScreen,
+	}
+	m.reset()
+	return m
+}
+
+func (m *Mapper004) cpuMapRead(addr uint16, mappedAddress *uint32, data *byte) bool {
+	if addr >= 0x6000 && addr <= 0x7FFF {
+		if !m.ramEnabled {
+			return false
+		}
+		return m.ramStatic.read(addr, mappedAddress, data)
+	}
+
+	if addr >= 0x8000 {
+		*mappedAddress = m.prgBank[(addr>>13)&0x03] + uint32(addr&0x1FFF)
+		return true
+	}
+
+	return false
+}
+
+func (m *Mapper004) cpuMapWrite(addr uint16, mappedAddress *uint32, data byte) bool {
+	if addr >= 0x6000 && addr <= 0x7FFF {
+		if !m.ramEnabled {
+			return false
+		}
+		if m.ramWriteProtect {
+			// Ignore the write, but don't let it reach the ROM
+			*mappedAddress = mappedAddressMapper
+			return len(m.ramStatic) > 0
+		}
+		return m.ramStatic.write(addr, mappedAddress, data)
+	}
+
+	// The registers are selected by the address range and whether the
+	// address is even or odd
+	even := addr&0x0001 == 0
+
+	switch {
+	case addr >= 0x8000 && addr <= 0x9FFF:
+		if even {
+			// Bank select
+			m.targetRegister = data & 0x07
+			m.prgBankMode = data&0x40 != 0
+			m.chrInversion = data&0x80 != 0
+		} else {
+			// Bank data
+			m.register[m.targetRegister] = uint32(data)
+		}
+		m.updateBanks()
+
+	case addr >= 0xA000 && addr <= 0xBFFF:
+		if even {
+			// Mirroring
+			if data&0x01 != 0 {
+				m.mirrorMode = Horizontal
+			} else {
+				m.mirrorMode = Vertical
+			}
+		} else {
+			// PRG RAM protect
+			m.ramEnabled = data&0x80 != 0
+			m.ramWriteProtect = data&0x40 != 0
+		}
+
+	case addr >= 0xC000 && addr <= 0xDFFF:
+		if even {
+			m.irqLatch = data
+		} else {
+			// The counter is reloaded on the next scanline
+			m.irqCounter = 0
+			m.irqReload = true
+		}
+
+	case addr >= 0xE000:
+		if even {
+			// Disabling IRQs also acknowledges a pending one
+			m.irqEnable = false
+			m.irqActive = false
+		} else {
+			m.irqEnable = true
+		}
+	}
+
+	// Mapper has handled the write, but do not update ROMs
+	return false
+}
+
+// updateBanks recomputes the PRG and CHR windows from the bank registers
+// and the inversion modes.
+func (m *Mapper004) updateBanks() {
+	chrTotal := uint32(m.chrBanks) * 0x2000
+	if chrTotal == 0 {
+		// CHR RAM is banked the same way
+		chrTotal = m.chrRAMSize
+	}
+	chr1K := func(bank uint32) uint32 {
+		return (bank * 0x0400) % chrTotal
+	}
+
+	// R0 and R1 select 2K banks, ignoring their low bit, and R2-R5 1K
+	// banks. CHR inversion swaps the two halves of the pattern space.
+	if m.chrInversion {
+		m.chrBank[0] = chr1K(m.register[2])
+		m.chrBank[1] = chr1K(m.register[3])
+		m.chrBank[2] = chr1K(m.register[4])
+		m.chrBank[3] = chr1K(m.register[5])
+		m.chrBank[4] = chr1K(m.register[0] & 0xFE)
+		m.chrBank[5] = chr1K(m.register[0] | 0x01)
+		m.chrBank[6] = chr1K(m.register[1] & 0xFE)
+		m.chrBank[7] = chr1K(m.register[1] | 0x01)
+	} else {
+		m.chrBank[0] = chr1K(m.register[0] & 0xFE)
+		m.chrBank[1] = chr1K(m.register[0] | 0x01)
+		m.chrBank[2] = chr1K(m.register[1] & 0xFE)
+		m.chrBank[3] = chr1K(m.register[1] | 0x01)
+		m.chrBank[4] = chr1K(m.register[2])
+		m.chrBank[5] = chr1K(m.register[3])
+		m.chrBank[6] = chr1K(m.register[4])
+		m.chrBank[7] = chr1K(m.register[5])
+	}
+
+	// R6 and R7 select 8K PRG banks. The second last bank is fixed at
+	// either $8000 or $C000 depending on the PRG mode, and the last bank
+	// is always at $E000.
+	prg8K := uint32(m.prgBanks) * 2
+	secondLast := (prg8K - 2) * 0x2000
+	if m.prgBankMode {
+		m.prgBank[0] = secondLast
+		m.prgBank[2] = (m.register[6] % prg8K) * 0x2000
+	} else {
+		m.prgBank[0] = (m.register[6] % prg8K) * 0x2000
+		m.prgBank[2] = secondLast
+	}
+	m.prgBank[1] = (m.register[7] % prg8K) * 0x2000
+	m.prgBank[3] = (prg8K - 1) * 0x2000
+}
+
+func (m *Mapper004) ppuMapRead(addr uint16, mappedAddress *uint32) bool {
+	if addr <= 0x1FFF {
+		*mappedAddress = m.chrBank[addr>>10] + uint32(addr&0x03FF)
+		return true
+	}
+	return false
+}
+
+func (m *Mapper004) ppuMapWrite(addr uint16, mappedAddress *uint32) bool {
+	if addr <= 0x1FFF && m.chrBanks == 0 {
+		// Treat as CHR RAM, through the same banks as reads
+		*mappedAddress = m.chrBank[addr>>10] + uint32(addr&0x03FF)
+		return true
+	}
+	return false
+}
+
+func (m *Mapper004) reset() {
+	m.targetRegister = 0
+	m.prgBankMode = false
+	m.chrInversion = false
+	m.mirrorMode = Horizontal
+
+	m.irqActive = false
+	m.irqEnable = false
+	m.irqReload = false
+	m.irqCounter = 0
+	m.irqLatch = 0
+	m.a12High = false
+	m.a12SeenHigh = false
+
+	m.ramEnabled = true
+	m.ramWriteProtect = false
+
+	m.register = [8]uint32{0, 2, 4, 5, 6, 7, 0, 1}
+	m.updateBanks()
+}
+
+func (m *Mapper004) mirror() Mirror {
+	if m.fourScreen {
+		// The mirroring register has no effect on four-screen boards
+		return Hardware
+	}
+	return m.mirrorMode
+}
+
+// ppuAddress clocks the scanline counter on rising edges of A12 that
+// follow a long enough stretch with A12 low.
+func (m *Mapper004) ppuAddress(addr uint16, ppuCycle uint64) {
+	high := addr&0x1000 != 0
+	if high && !m.a12High {
+		if !m.a12SeenHigh || ppuCycle-m.a12LastHigh >= mmc3A12Filter {
+			m.clockScanline()
+		}
+	}
+	if high {
+		m.a12LastHigh = ppuCycle
+		m.a12SeenHigh = true
+	}
+	m.a12High = high
+}
+
+// clockScanline steps the scanline counter, raising an IRQ when it reaches
+// zero.
+func (m *Mapper004) clockScanline() {
+	if m.irqCounter == 0 || m.irqReload {
+		m.irqCounter = m.irqLatch
+		m.irqReload = false
+	} else {
+		m.irqCounter--
+	}
+
+	if m.irqCounter == 0 && m.irqEnable {
+		m.irqActive = true
+	}
+}
+
+func (m *Mapper004) irqState() bool {
+	return m.irqActive
+}
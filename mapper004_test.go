@@ -0,0 +1,210 @@
+package main
+
+import "testing"
+
+// mmc3Rises feeds the mapper rises of PPU A12, spacing dots apart, and
+// returns after how many rises the IRQ line was first asserted, or 0 if it
+// never was. after is called with the number of rises so far before each
+// one.
+func mmc3Rises(m *Mapper004, rises int, spacing uint64, after func(rise int)) int {
+	var dot uint64 = 1000
+	for rise := 1; rise <= rises; rise++ {
+		if after != nil {
+			after(rise - 1)
+		}
+		m.ppuAddress(0x0FF0, dot-1)
+		m.ppuAddress(0x1000, dot)
+		m.ppuAddress(0x0FF0, dot+1)
+		if m.irqState() {
+			return rise
+		}
+		dot += spacing
+	}
+	return 0
+}
+
+func TestMapper004ScanlineCounter(t *testing.T) {
+	var mapped uint32
+	tests := []struct {
+		name    string
+		latch   byte
+		enable  bool
+		spacing uint64 // PPU dots between rises of A12
+		rises   int
+
+		// Called before each rise, with the number of rises so far
+		before func(m *Mapper004, rise int)
+
+		want int // The rise on which the IRQ fires, or 0 for none
+	}{
+		{name: "latch 3", latch: 3, enable: true, spacing: 341, rises: 10, want: 4},
+		{name: "latch 1", latch: 1, enable: true, spacing: 341, rises: 10, want: 2},
+		{name: "latch 0 fires on every scanline", latch: 0, enable: true, spacing: 341, rises: 10, want: 1},
+		{name: "disabled", latch: 3, enable: false, spacing: 341, rises: 10, want: 0},
+		{name: "rises too close together are filtered", latch: 1, enable: true, spacing: mmc3A12Filter - 2, rises: 10, want: 0},
+		{name: "rises just far enough apart count", latch: 1, enable: true, spacing: mmc3A12Filter + 1, rises: 10, want: 2},
+		{
+			name: "reload restarts the count", latch: 3, enable: true, spacing: 341, rises: 10,
+			before: func(m *Mapper004, rise int) {
+				if rise == 2 {
+					m.cpuMapWrite(0xC001, &mapped, 0)
+				}
+			},
+			want: 6,
+		},
+		{
+			name: "new latch takes effect on reload", latch: 5, enable: true, spacing: 341, rises: 10,
+			before: func(m *Mapper004, rise int) {
+				if rise == 1 {
+					m.cpuMapWrite(0xC000, &mapped, 1)
+				}
+			},
+			want: 6,
+		},
+		{
+			name: "enable part way", latch: 2, enable: false, spacing: 341, rises: 10,
+			before: func(m *Mapper004, rise int) {
+				if rise == 3 {
+					m.cpuMapWrite(0xE001, &mapped, 0)
+				}
+			},
+			want: 6,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := NewMapper004(MapperConfig{Mapper: 4, PRGBanks: 2, CHRBanks: 2})
+			m.cpuMapWrite(0xC000, &mapped, test.latch)
+			m.cpuMapWrite(0xC001, &mapped, 0)
+			if test.enable {
+				m.cpuMapWrite(0xE001, &mapped, 0)
+			}
+
+			var before func(int)
+			if test.before != nil {
+				before = func(rise int) { test.before(m, rise) }
+			}
+			if got := mmc3Rises(m, test.rises, test.spacing, before); got != test.want {
+				t.Errorf("IRQ on rise %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMapper004IRQAcknowledge(t *testing.T) {
+	var mapped uint32
+	m := NewMapper004(MapperConfig{Mapper: 4, PRGBanks: 2, CHRBanks: 2})
+	m.cpuMapWrite(0xC000, &mapped, 0)
+	m.cpuMapWrite(0xE001, &mapped, 0)
+	if mmc3Rises(m, 1, 341, nil) != 1 {
+		t.Fatal("IRQ not raised")
+	}
+
+	// The line stays asserted until $E000 is written
+	m.cpuMapWrite(0xC000, &mapped, 5)
+	if !m.irqState() {
+		t.Error("IRQ dropped before being acknowledged")
+	}
+	m.cpuMapWrite(0xE000, &mapped, 0)
+	if m.irqState() {
+		t.Error("IRQ still asserted after $E000 write")
+	}
+}
+
+func TestMapper004CHRRAM(t *testing.T) {
+	var mapped uint32
+	tests := []struct {
+		name     string
+		register byte // Bank register to set
+		bank     byte
+		addr     uint16
+		want     uint32 // Offset into CHR RAM
+	}{
+		{"2K bank at $0000", 0, 2, 0x0123, 0x0923},
+		{"1K bank at $1000", 2, 7, 0x1010, 0x1C10},
+		{"bank beyond the RAM wraps", 5, 9, 0x1C00, 0x0400},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// TGROM: 8K of CHR RAM
+			m := NewMapper004(MapperConfig{Mapper: 4, PRGBanks: 4, CHRRAMSize: 8192})
+			m.cpuMapWrite(0x8000, &mapped, test.register)
+			m.cpuMapWrite(0x8001, &mapped, test.bank)
+
+			var wrote, read uint32
+			if !m.ppuMapWrite(test.addr, &wrote) || !m.ppuMapRead(test.addr, &read) {
+				t.Fatal("CHR RAM not mapped")
+			}
+			if wrote != test.want || read != test.want {
+				t.Errorf("write maps to $%04X and read to $%04X, want $%04X", wrote, read, test.want)
+			}
+		})
+	}
+}
+
+func TestMapper004Mirroring(t *testing.T) {
+	var mapped uint32
+	tests := []struct {
+		name       string
+		fourScreen bool
+		value      byte // Written to $A000
+		want       Mirror
+	}{
+		{"vertical", false, 0, Vertical},
+		{"horizontal", false, 1, Horizontal},
+		{"four-screen ignores the register", true, 1, Hardware},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := NewMapper004(MapperConfig{Mapper: 4, PRGBanks: 2, CHRBanks: 2, FourScreen: test.fourScreen})
+			m.cpuMapWrite(0xA000, &mapped, test.value)
+			if got := m.mirror(); got != test.want {
+				t.Errorf("mirroring %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMapper004PRGRAM(t *testing.T) {
+	var mapped uint32
+	tests := []struct {
+		name    string
+		size    int
+		protect byte // Written to $A001
+		addr    uint16
+		write   byte
+		want    byte
+		mapped  bool
+	}{
+		{"8K", 8192, 0x80, 0x7FFF, 0x42, 0x42, true},
+		{"2K is mirrored", 2048, 0x80, 0x6800, 0x42, 0x42, true},
+		{"write protected", 8192, 0xC0, 0x6000, 0x42, 0x00, true},
+		{"disabled", 8192, 0x00, 0x6000, 0x42, 0x00, false},
+		{"none", 0, 0x80, 0x6000, 0x42, 0x00, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := NewMapper004(MapperConfig{Mapper: 4, PRGBanks: 2, CHRBanks: 2, PRGRAMSize: test.size})
+			m.cpuMapWrite(0xA001, &mapped, test.protect)
+			m.cpuMapWrite(test.addr, &mapped, test.write)
+
+			var data byte
+			if got := m.cpuMapRead(test.addr, &mapped, &data); got != test.mapped {
+				t.Fatalf("mapped %v, want %v", got, test.mapped)
+			}
+			if test.mapped && (mapped != mappedAddressMapper || data != test.want) {
+				t.Errorf("read $%02X, want $%02X", data, test.want)
+			}
+			if test.size == 2048 {
+				m.cpuMapRead(test.addr-0x0800, &mapped, &data)
+				if data != test.want {
+					t.Errorf("mirror read $%02X, want $%02X", data, test.want)
+				}
+			}
+		})
+	}
+}
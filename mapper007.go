@@ -0,0 +1,102 @@
+package main
+
+// Mapper007 is AxROM: a switchable 32K PRG bank, CHR RAM, and a register
+// bit selecting which nametable is shown on all four screens.
+type Mapper007 struct {
+	prgBanks uint8
+	chrBanks uint8
+
+	ramStatic prgRAM
+
+	prgBankSelect uint8
+	mirrorMode    Mirror
+}
+
+func init() {
+	registerDiscreteMapper(MapperInfo{
+		Number: 7,
+		Name:   "AxROM",
+		Boards: "ANROM, AMROM, AOROM",
+	}, func(config MapperConfig) Mapper {
+		return NewMapper007(config)
+	})
+}
+
+func NewMapper007(config MapperConfig) *Mapper007 {
+	m := &Mapper007{
+		prgBanks: config.PRGBanks,
+		chrBanks: config.CHRBanks,
+
+		ramStatic: newPRGRAM(config.prgRAMSize()),
+	}
+	m.reset()
+	return m
+}
+
+func (m *Mapper007) cpuMapRead(addr uint16, mappedAddress *uint32, data *byte) bool {
+	if m.ramStatic.read(addr, mappedAddress, data) {
+		return true
+	}
+
+	if addr >= 0x8000 {
+		// A 16K ROM is mirrored through the 32K bank
+		offset := uint32(m.prgBankSelect)*0x8000 + uint32(addr&0x7FFF)
+		*mappedAddress = offset % (uint32(m.prgBanks) * 0x4000)
+		return true
+	}
+	return false
+}
+
+func (m *Mapper007) cpuMapWrite(addr uint16, mappedAddress *uint32, data byte) bool {
+	if m.ramStatic.write(addr, mappedAddress, data) {
+		return true
+	}
+
+	if addr >= 0x8000 {
+		// PRG banks are 32K, counted in 16K units in the header
+		if banks := m.prgBanks / 2; banks > 0 {
+			m.prgBankSelect = (data & 0x07) % banks
+		}
+
+		if data&0x10 != 0 {
+			m.mirrorMode = OnScreenHi
+		} else {
+			m.mirrorMode = OnScreenLo
+		}
+	}
+
+	// Mapper has handled the write, but do not update ROMs
+	return false
+}
+
+func (m *Mapper007) ppuMapRead(addr uint16, mappedAddress *uint32) bool {
+	if addr <= 0x1FFF {
+		*mappedAddress = uint32(addr)
+		return true
+	}
+	return false
+}
+
+func (m *Mapper007) ppuMapWrite(addr uint16, mappedAddress *uint32) bool {
+	if addr <= 0x1FFF && m.chrBanks == 0 {
+		// Treat as CHR RAM
+		*mappedAddress = uint32(addr)
+		return true
+	}
+	return false
+}
+
+func (m *Mapper007) reset() {
+	m.prgBankSelect = 0
+	m.mirrorMode = OnScreenLo
+}
+
+func (m *Mapper007) mirror() Mirror {
+	return m.mirrorMode
+}
+
+func (m *Mapper007) ppuAddress(addr uint16, ppuCycle uint64) {}
+
+func (m *Mapper007) irqState() bool {
+	return false
+}
@@ -0,0 +1,104 @@
+package main
+
+// Mapper066 is GxROM: a switchable 32K PRG bank and a switchable 8K CHR
+// bank, both selected by a single register.
+type Mapper066 struct {
+	prgBanks uint8
+	chrBanks uint8
+
+	ramStatic prgRAM
+
+	prgBankSelect uint8
+	chrBankSelect uint8
+}
+
+func init() {
+	registerMapper(MapperInfo{
+		Number:    66,
+		Submapper: AnySubmapper,
+		Name:      "GxROM",
+		Boards:    "GNROM, MHROM",
+
+		// GNROM has bus conflicts and MHROM doesn't, and there are no
+		// submappers to tell them apart
+		BusConflicts: BusConflictsOptional,
+	}, func(config MapperConfig) Mapper {
+		return NewMapper066(config)
+	})
+}
+
+func NewMapper066(config MapperConfig) *Mapper066 {
+	m := &Mapper066{
+		prgBanks: config.PRGBanks,
+		chrBanks: config.CHRBanks,
+
+		ramStatic: newPRGRAM(config.prgRAMSize()),
+	}
+	m.reset()
+	return m
+}
+
+func (m *Mapper066) cpuMapRead(addr uint16, mappedAddress *uint32, data *byte) bool {
+	if m.ramStatic.read(addr, mappedAddress, data) {
+		return true
+	}
+
+	if addr >= 0x8000 {
+		// A 16K ROM is mirrored through the 32K bank
+		offset := uint32(m.prgBankSelect)*0x8000 + uint32(addr&0x7FFF)
+		*mappedAddress = offset % (uint32(m.prgBanks) * 0x4000)
+		return true
+	}
+	return false
+}
+
+func (m *Mapper066) cpuMapWrite(addr uint16, mappedAddress *uint32, data byte) bool {
+	if m.ramStatic.write(addr, mappedAddress, data) {
+		return true
+	}
+
+	if addr >= 0x8000 {
+		// --PP --CC
+		if banks := m.prgBanks / 2; banks > 0 {
+			m.prgBankSelect = ((data >> 4) & 0x03) % banks
+		}
+		if m.chrBanks > 0 {
+			m.chrBankSelect = (data & 0x03) % m.chrBanks
+		}
+	}
+
+	// Mapper has handled the write, but do not update ROMs
+	return false
+}
+
+func (m *Mapper066) ppuMapRead(addr uint16, mappedAddress *uint32) bool {
+	if addr <= 0x1FFF {
+		*mappedAddress = uint32(m.chrBankSelect)*0x2000 + uint32(addr)
+		return true
+	}
+	return false
+}
+
+func (m *Mapper066) ppuMapWrite(addr uint16, mappedAddress *uint32) bool {
+	if addr <= 0x1FFF && m.chrBanks == 0 {
+		// Treat as CHR RAM
+		*mappedAddress = uint32(addr)
+		return true
+	}
+	return false
+}
+
+func (m *Mapper066) reset() {
+	m.prgBankSelect = 0
+	m.chrBankSelect = 0
+}
+
+func (m *Mapper066) mirror() Mirror {
+	return Hardware
+}
+
+func (m *Mapper066) ppuAddress(addr uint16, ppuCycle uint64) {}
+
+func (m *Mapper066) irqState() bool {
+	return false
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+)
+
+// runMappers implements the mappers subcommand, which lists the mappers
+// gones supports.
+func runMappers(args []string) int {
+	if len(args) != 0 {
+		fmt.Fprintln(os.Stderr, "usage: gones mappers")
+		return exitUsage
+	}
+
+	if err := listMappers(os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	return exitOK
+}
+
+// listMappers writes a table of the registered mappers to w.
+func listMappers(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "MAPPER\tSUBMAPPER\tNAME\tBUS CONFLICTS\tBOARDS")
+	for _, info := range registeredMappers() {
+		submapper := "any"
+		if info.Submapper != AnySubmapper {
+			submapper = strconv.Itoa(info.Submapper)
+		}
+		fmt.Fprintf(tw, "%03d\t%s\t%s\t%v\t%s\n", info.Number, submapper, info.Name, info.BusConflicts, info.Boards)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,739 @@
+package main
+
+import "image/color"
+
+const (
+	FrameWidth  = 256
+	FrameHeight = 240
+
+	ppuDotsPerScanline = 341
+)
+
+// PPUCTRL ($2000) bits
+const (
+	ctrlNametableX        byte = 1 << iota // Base nametable, horizontal bit
+	ctrlNametableY                         // Base nametable, vertical bit
+	ctrlIncrementMode                      // VRAM increment: 0 = 1 (across), 1 = 32 (down)
+	ctrlSpritePattern                      // Sprite pattern table for 8x8 sprites
+	ctrlBackgroundPattern                  // Background pattern table
+	ctrlSpriteSize                         // 0 = 8x8, 1 = 8x16
+	ctrlSlaveMode                          // Unused on the NES
+	ctrlEnableNMI                          // Raise NMI at the start of vertical blank
+)
+
+// PPUMASK ($2001) bits
+const (
+	maskGrayscale          byte = 1 << iota
+	maskShowBackgroundLeft      // Show background in the leftmost 8 pixels
+	maskShowSpritesLeft         // Show sprites in the leftmost 8 pixels
+	maskShowBackground
+	maskShowSprites
+	maskEmphasizeRed
+	maskEmphasizeGreen
+	maskEmphasizeBlue
+)
+
+// PPUSTATUS ($2002) bits
+const (
+	statusSpriteOverflow byte = 0x20
+	statusSpriteZeroHit  byte = 0x40
+	statusVBlank         byte = 0x80
+)
+
+// systemPalette holds the RGB values of the 64 colours the 2C02 can output.
+var systemPalette = [64]color.RGBA{
+	{84, 84, 84, 255}, {0, 30, 116, 255}, {8, 16, 144, 255}, {48, 0, 136, 255},
+	{68, 0, 100, 255}, {92, 0, 48, 255}, {84, 4, 0, 255}, {60, 24, 0, 255},
+	{32, 42, 0, 255}, {8, 58, 0, 255}, {0, 64, 0, 255}, {0, 60, 0, 255},
+	{0, 50, 60, 255}, {0, 0, 0, 255}, {0, 0, 0, 255}, {0, 0, 0, 255},
+
+	{152, 150, 152, 255}, {8, 76, 196, 255}, {48, 50, 236, 255}, {92, 30, 228, 255},
+	{136, 20, 176, 255}, {160, 20, 100, 255}, {152, 34, 32, 255}, {120, 60, 0, 255},
+	{84, 90, 0, 255}, {40, 114, 0, 255}, {8, 124, 0, 255}, {0, 118, 40, 255},
+	{0, 102, 120, 255}, {0, 0, 0, 255}, {0, 0, 0, 255}, {0, 0, 0, 255},
+
+	{236, 238, 236, 255}, {76, 154, 236, 255}, {120, 124, 236, 255}, {176, 98, 236, 255},
+	{228, 84, 236, 255}, {236, 88, 180, 255}, {236, 106, 100, 255}, {212, 136, 32, 255},
+	{160, 170, 0, 255}, {116, 196, 0, 255}, {76, 208, 32, 255}, {56, 204, 108, 255},
+	{56, 180, 204, 255}, {60, 60, 60, 255}, {0, 0, 0, 255}, {0, 0, 0, 255},
+
+	{236, 238, 236, 255}, {168, 204, 236, 255}, {188, 188, 236, 255}, {212, 178, 236, 255},
+	{236, 174, 236, 255}, {236, 174, 212, 255}, {236, 180, 176, 255}, {228, 196, 144, 255},
+	{204, 210, 120, 255}, {180, 222, 120, 255}, {168, 226, 144, 255}, {152, 226, 180, 255},
+	{160, 214, 228, 255}, {160, 162, 160, 255}, {0, 0, 0, 255}, {0, 0, 0, 255},
+}
+
+// spriteEntry is one sprite as stored in OAM.
+type spriteEntry struct {
+	y         byte
+	tile      byte
+	attribute byte
+	x         byte
+}
+
+// PPU emulates the 2C02 picture processing unit.
+//
+// The PPU is clocked once per dot. Background tiles are fetched into shift
+// registers eight dots ahead of where they are drawn, and sprites for the
+// next scanline are evaluated at the end of the current one, much like the
+// real chip does. Each finished frame is left in Frame.
+type PPU struct {
+	// Registers visible to the CPU
+	ctrl    byte
+	mask    byte
+	status  byte
+	oamAddr byte
+
+	// Internal registers: current VRAM address (v), temporary VRAM address
+	// (t), fine X scroll (x) and the shared write toggle (w)
+	v     uint16
+	t     uint16
+	fineX byte
+	w     bool
+
+	dataBuffer byte // PPUDATA read buffer
+
+	// Memory
+	nametables [4][1024]byte // The second 2K is only used by four-screen cartridges
+	palette    [32]byte
+	oam        [256]byte
+
+	// The cartridge supplies the pattern tables and nametable mirroring
+	cartridge *Cartridge
+
+	// Timing
+	timing        *regionTiming
+	scanline      int
+	cycle         int
+	clockCounter  uint64 // Dots since power on, for timing bus activity
+	oddFrame      bool
+	frameComplete bool
+
+	// Background pipeline
+	bgNextTileID     byte
+	bgNextTileAttrib byte
+	bgNextTileLsb    byte
+	bgNextTileMsb    byte
+	bgShifterPattern [2]uint16
+	bgShifterAttrib  [2]uint16
+
+	// Sprites on the current scanline
+	spriteScanline        [8]spriteEntry
+	spriteCount           int
+	spriteShifterPattern  [2][8]byte
+	spriteZeroHitPossible bool
+
+	// Frame is the picture being drawn, one colour per pixel.
+	Frame [FrameWidth * FrameHeight]color.RGBA
+}
+
+func NewPPU() *PPU {
+	return &PPU{timing: RegionNTSC.timing()}
+}
+
+// setRegion switches to the frame timing of a region.
+func (p *PPU) setRegion(region Region) {
+	p.timing = region.timing()
+}
+
+// preRenderLine returns the last scanline of the frame, which prepares
+// the first visible one.
+func (p *PPU) preRenderLine() int {
+	return p.timing.scanlines - 1
+}
+
+// Reset puts the PPU in its power-up state at the top of the frame.
+func (p *PPU) Reset() {
+	p.ctrl = 0
+	p.mask = 0
+	p.status = 0
+	p.oamAddr = 0
+	p.v = 0
+	p.t = 0
+	p.fineX = 0
+	p.w = false
+	p.dataBuffer = 0
+	p.scanline = 0
+	p.cycle = 0
+	p.oddFrame = false
+	p.frameComplete = false
+	p.bgShifterPattern = [2]uint16{}
+	p.bgShifterAttrib = [2]uint16{}
+	p.spriteCount = 0
+}
+
+// nmiAsserted reports the level of the PPU's NMI output, which is held
+// for as long as vertical blank is flagged and NMI generation is enabled.
+func (p *PPU) nmiAsserted() bool {
+	return p.status&statusVBlank != 0 && p.ctrl&ctrlEnableNMI != 0
+}
+
+// position returns the scanline and dot the PPU is on.
+func (p *PPU) position() (int, int) {
+	return p.scanline, p.cycle
+}
+
+// renderingEnabled reports whether either background or sprite rendering
+// is switched on. While both are off the PPU leaves VRAM alone.
+func (p *PPU) renderingEnabled() bool {
+	return p.mask&(maskShowBackground|maskShowSprites) != 0
+}
+
+// --- CPU interface ---
+
+// cpuRead reads one of the eight PPU registers mirrored through
+// $2000-$3FFF.
+func (p *PPU) cpuRead(addr uint16) byte {
+	data := byte(0)
+
+	switch addr & 0x0007 {
+	case 0x0002: // Status
+		// The lower five bits are open bus, which is approximated with
+		// the stale contents of the read buffer
+		data = (p.status & 0xE0) | (p.dataBuffer & 0x1F)
+		p.status &^= statusVBlank
+		p.w = false
+	case 0x0004: // OAM Data
+		data = p.oam[p.oamAddr]
+	case 0x0007: // PPU Data
+		// Reads are delayed by one access through the read buffer,
+		// except for palette memory, which is returned immediately. The
+		// buffer is then filled with the nametable byte "underneath" it.
+		data = p.dataBuffer
+		p.dataBuffer = p.ppuRead(p.v)
+		if p.v&0x3FFF >= 0x3F00 {
+			data = p.dataBuffer
+			p.dataBuffer = p.ppuRead(p.v - 0x1000)
+		}
+		p.incrementAddress()
+	}
+
+	return data
+}
+
+// cpuWrite writes one of the eight PPU registers mirrored through
+// $2000-$3FFF.
+func (p *PPU) cpuWrite(addr uint16, data byte) {
+	switch addr & 0x0007 {
+	case 0x0000: // Control
+		p.ctrl = data
+		p.t = (p.t & 0xF3FF) | uint16(data&0x03)<<10
+	case 0x0001: // Mask
+		p.mask = data
+	case 0x0003: // OAM Address
+		p.oamAddr = data
+	case 0x0004: // OAM Data
+		p.oam[p.oamAddr] = data
+		p.oamAddr++
+	case 0x0005: // Scroll
+		if !p.w {
+			p.fineX = data & 0x07
+			p.t = (p.t & 0xFFE0) | uint16(data>>3)
+		} else {
+			p.t = (p.t & 0x8C1F) | uint16(data&0x07)<<12 | uint16(data>>3)<<5
+		}
+		p.w = !p.w
+	case 0x0006: // PPU Address
+		if !p.w {
+			p.t = (p.t & 0x00FF) | uint16(data&0x3F)<<8
+		} else {
+			p.t = (p.t & 0xFF00) | uint16(data)
+			p.v = p.t
+		}
+		p.w = !p.w
+	case 0x0007: // PPU Data
+		p.ppuWrite(p.v, data)
+		p.incrementAddress()
+	}
+}
+
+// incrementAddress advances v after a PPUDATA access, across or down
+// depending on PPUCTRL.
+func (p *PPU) incrementAddress() {
+	if p.ctrl&ctrlIncrementMode != 0 {
+		p.v += 32
+	} else {
+		p.v++
+	}
+	p.v &= 0x7FFF
+}
+
+// --- PPU bus ---
+
+// connectCartridge attaches the cartridge whose CHR memory backs the pattern
+// tables and whose wiring decides the nametable mirroring.
+func (p *PPU) connectCartridge(cartridge *Cartridge) {
+	p.cartridge = cartridge
+}
+
+// ppuRead reads from the PPU's 14-bit address space.
+func (p *PPU) ppuRead(addr uint16) byte {
+	addr &= 0x3FFF
+
+	data := byte(0)
+	p.observeAddress(addr)
+	if p.cartridge != nil && p.cartridge.ppuRead(addr, &data) {
+		// Cartridge space, which includes the pattern tables and
+		// anything else the mapper chooses to claim
+	} else if addr >= 0x2000 && addr <= 0x3EFF {
+		table, offset := p.nametableAddress(addr)
+		data = p.nametables[table][offset]
+	} else if addr >= 0x3F00 {
+		// Palette entries are only six bits wide
+		data = p.palette[paletteAddress(addr)] & 0x3F
+	}
+	return data
+}
+
+// ppuWrite writes to the PPU's 14-bit address space.
+func (p *PPU) ppuWrite(addr uint16, data byte) {
+	addr &= 0x3FFF
+
+	p.observeAddress(addr)
+	if p.cartridge != nil && p.cartridge.ppuWrite(addr, data) {
+		// Cartridge space
+	} else if addr >= 0x2000 && addr <= 0x3EFF {
+		table, offset := p.nametableAddress(addr)
+		p.nametables[table][offset] = data
+	} else if addr >= 0x3F00 {
+		p.palette[paletteAddress(addr)] = data
+	}
+}
+
+// observeAddress lets the cartridge see an address the PPU puts on its
+// bus. Palette RAM is inside the PPU, so accesses to it never reach the
+// bus.
+func (p *PPU) observeAddress(addr uint16) {
+	if p.cartridge != nil && addr < 0x3F00 {
+		p.cartridge.observePPUAddress(addr, p.clockCounter)
+	}
+}
+
+// nametableAddress maps an address in $2000-$3EFF onto one of the two
+// physical nametables in the console's 2K of VRAM.
+//
+// The four logical nametables fold onto the two physical ones according
+// to how the cartridge wires the VRAM address lines, and $3000-$3EFF
+// mirrors $2000-$2EFF. Four-screen cartridges carry another 2K of VRAM,
+// so every logical nametable is backed by its own memory.
+func (p *PPU) nametableAddress(addr uint16) (int, uint16) {
+	offset := addr & 0x03FF
+	quadrant := (addr >> 10) & 0x03
+
+	mirror := Horizontal
+	if p.cartridge != nil {
+		mirror = p.cartridge.mirroring()
+	}
+
+	switch mirror {
+	case Vertical:
+		// $2000 = $2800, $2400 = $2C00
+		return int(quadrant & 0x01), offset
+	case OnScreenLo:
+		return 0, offset
+	case OnScreenHi:
+		return 1, offset
+	case FourScreen:
+		return int(quadrant), offset
+	default:
+		// Horizontal: $2000 = $2400, $2800 = $2C00
+		return int(quadrant >> 1), offset
+	}
+}
+
+// paletteAddress maps an address in $3F00-$3FFF onto the 32 bytes of
+// palette RAM.
+//
+// The range mirrors every 32 bytes, and the background colour entries of
+// the sprite palettes ($3F10, $3F14, $3F18, $3F1C) are shared with those of
+// the background palettes ($3F00, $3F04, $3F08, $3F0C).
+func paletteAddress(addr uint16) uint16 {
+	addr &= 0x001F
+	if addr&0x0013 == 0x0010 {
+		addr &^= 0x0010
+	}
+	return addr
+}
+
+// --- Rendering ---
+
+// Clock advances the PPU by one dot.
+func (p *PPU) Clock() {
+	visible := p.scanline < FrameHeight
+	preRender := p.scanline == p.preRenderLine()
+
+	if preRender && p.cycle == 1 {
+		// Leaving vertical blank: a new frame starts
+		p.status &^= statusVBlank | statusSpriteZeroHit | statusSpriteOverflow
+
+		// Sprites are never drawn on the first scanline
+		p.spriteCount = 0
+	}
+
+	if (visible || preRender) && p.renderingEnabled() {
+		p.renderTick(visible, preRender)
+	}
+
+	if p.scanline == p.timing.vblankScanline && p.cycle == 1 {
+		p.status |= statusVBlank
+	}
+
+	if visible && p.cycle >= 1 && p.cycle <= FrameWidth {
+		p.drawPixel()
+	}
+
+	p.advance()
+}
+
+// renderTick performs the memory fetches and scroll updates for one dot of
+// a visible or pre-render scanline.
+func (p *PPU) renderTick(visible bool, preRender bool) {
+	if (p.cycle >= 2 && p.cycle <= 257) || (p.cycle >= 321 && p.cycle <= 337) {
+		p.updateShifters()
+
+		switch (p.cycle - 1) % 8 {
+		case 0:
+			p.loadBackgroundShifters()
+			p.bgNextTileID = p.ppuRead(0x2000 | (p.v & 0x0FFF))
+		case 2:
+			attrib := p.ppuRead(0x23C0 | (p.v & 0x0C00) | ((p.v >> 4) & 0x38) | ((p.v >> 2) & 0x07))
+			// Select the 2x2 tile quadrant this tile belongs to
+			if (p.v>>5)&0x02 != 0 {
+				attrib >>= 4
+			}
+			if p.v&0x02 != 0 {
+				attrib >>= 2
+			}
+			p.bgNextTileAttrib = attrib & 0x03
+		case 4:
+			p.bgNextTileLsb = p.ppuRead(p.backgroundTileAddress())
+		case 6:
+			p.bgNextTileMsb = p.ppuRead(p.backgroundTileAddress() + 8)
+		case 7:
+			p.incrementScrollX()
+		}
+	}
+
+	switch {
+	case p.cycle == 256:
+		p.incrementScrollY()
+	case p.cycle == 257:
+		p.loadBackgroundShifters()
+		p.transferAddressX()
+		if visible {
+			p.evaluateSprites()
+		}
+	case p.cycle == 260:
+		// Sprite patterns are fetched during dots 257-320; doing it all at
+		// once at the point where a mapper watching A12 would see the
+		// first of them keeps scanline counters in step with the hardware
+		p.loadSpriteShifters()
+	case preRender && p.cycle >= 280 && p.cycle <= 304:
+		p.transferAddressY()
+	}
+}
+
+// backgroundTileAddress returns the address of the low bitplane of the
+// next background tile's current row.
+func (p *PPU) backgroundTileAddress() uint16 {
+	table := uint16(0)
+	if p.ctrl&ctrlBackgroundPattern != 0 {
+		table = 0x1000
+	}
+	fineY := (p.v >> 12) & 0x07
+	return table + uint16(p.bgNextTileID)<<4 + fineY
+}
+
+// incrementScrollX moves v to the next tile horizontally, switching to the
+// neighbouring nametable at the edge.
+func (p *PPU) incrementScrollX() {
+	if p.v&0x001F == 31 {
+		p.v &^= 0x001F
+		p.v ^= 0x0400
+	} else {
+		p.v++
+	}
+}
+
+// incrementScrollY moves v to the next pixel row, switching to the
+// neighbouring nametable after the last row of tiles.
+func (p *PPU) incrementScrollY() {
+	if p.v&0x7000 != 0x7000 {
+		p.v += 0x1000
+		return
+	}
+
+	p.v &^= 0x7000
+	coarseY := (p.v & 0x03E0) >> 5
+	switch coarseY {
+	case 29:
+		coarseY = 0
+		p.v ^= 0x0800
+	case 31:
+		// Rows 30 and 31 hold attributes; scrolling into them wraps
+		// without switching nametables
+		coarseY = 0
+	default:
+		coarseY++
+	}
+	p.v = (p.v &^ 0x03E0) | coarseY<<5
+}
+
+// transferAddressX copies the horizontal scroll bits from t to v.
+func (p *PPU) transferAddressX() {
+	p.v = (p.v &^ 0x041F) | (p.t & 0x041F)
+}
+
+// transferAddressY copies the vertical scroll bits from t to v.
+func (p *PPU) transferAddressY() {
+	p.v = (p.v &^ 0x7BE0) | (p.t & 0x7BE0)
+}
+
+// loadBackgroundShifters moves the fetched tile into the low byte of the
+// background shift registers, ready to be shifted out over the next 8 dots.
+func (p *PPU) loadBackgroundShifters() {
+	p.bgShifterPattern[0] = (p.bgShifterPattern[0] & 0xFF00) | uint16(p.bgNextTileLsb)
+	p.bgShifterPattern[1] = (p.bgShifterPattern[1] & 0xFF00) | uint16(p.bgNextTileMsb)
+
+	// The attribute applies to the whole tile, so it is expanded to 8 bits
+	attribLo, attribHi := uint16(0), uint16(0)
+	if p.bgNextTileAttrib&0x01 != 0 {
+		attribLo = 0xFF
+	}
+	if p.bgNextTileAttrib&0x02 != 0 {
+		attribHi = 0xFF
+	}
+	p.bgShifterAttrib[0] = (p.bgShifterAttrib[0] & 0xFF00) | attribLo
+	p.bgShifterAttrib[1] = (p.bgShifterAttrib[1] & 0xFF00) | attribHi
+}
+
+// updateShifters shifts the background registers by one pixel and moves
+// the sprites on the scanline one pixel closer to being drawn.
+func (p *PPU) updateShifters() {
+	if p.mask&maskShowBackground != 0 {
+		p.bgShifterPattern[0] <<= 1
+		p.bgShifterPattern[1] <<= 1
+		p.bgShifterAttrib[0] <<= 1
+		p.bgShifterAttrib[1] <<= 1
+	}
+
+	if p.mask&maskShowSprites != 0 && p.cycle >= 1 && p.cycle < 258 {
+		for i := 0; i < p.spriteCount; i++ {
+			if p.spriteScanline[i].x > 0 {
+				p.spriteScanline[i].x--
+			} else {
+				p.spriteShifterPattern[0][i] <<= 1
+				p.spriteShifterPattern[1][i] <<= 1
+			}
+		}
+	}
+}
+
+// spriteHeight returns the height of sprites in pixels.
+func (p *PPU) spriteHeight() int {
+	if p.ctrl&ctrlSpriteSize != 0 {
+		return 16
+	}
+	return 8
+}
+
+// evaluateSprites collects up to 8 sprites that are visible on the next
+// scanline, in OAM order.
+//
+// More than 8 sprites sets the overflow flag. The hardware's buggy
+// overflow detection, which can give false positives and negatives, is not
+// emulated.
+func (p *PPU) evaluateSprites() {
+	p.spriteCount = 0
+	p.spriteZeroHitPossible = false
+	height := p.spriteHeight()
+
+	for i := 0; i < 64; i++ {
+		sprite := spriteEntry{p.oam[i*4], p.oam[i*4+1], p.oam[i*4+2], p.oam[i*4+3]}
+
+		// Sprites are drawn one scanline below their Y coordinate, so a
+		// sprite is on the next line if that is where it starts, or any
+		// of the rows below
+		row := p.scanline - int(sprite.y)
+		if row < 0 || row >= height {
+			continue
+		}
+
+		if p.spriteCount == 8 {
+			p.status |= statusSpriteOverflow
+			break
+		}
+		if i == 0 {
+			p.spriteZeroHitPossible = true
+		}
+		p.spriteScanline[p.spriteCount] = sprite
+		p.spriteCount++
+	}
+}
+
+// loadSpriteShifters fetches the pattern rows of the sprites found by
+// evaluateSprites.
+//
+// All eight slots are fetched, as on the real PPU, which reads tile $FF
+// for the unused ones. The results are thrown away, but the accesses are
+// visible to the cartridge.
+func (p *PPU) loadSpriteShifters() {
+	for i := 0; i < len(p.spriteScanline); i++ {
+		sprite := spriteEntry{y: 0xFF, tile: 0xFF}
+		if i < p.spriteCount {
+			sprite = p.spriteScanline[i]
+		}
+		row := uint16(p.scanline-int(sprite.y)) & 0x0F
+		flipV := sprite.attribute&0x80 != 0
+		flipH := sprite.attribute&0x40 != 0
+
+		var addr uint16
+		if p.spriteHeight() == 8 {
+			if flipV {
+				row = 7 - row
+			}
+			table := uint16(0)
+			if p.ctrl&ctrlSpritePattern != 0 {
+				table = 0x1000
+			}
+			addr = table | uint16(sprite.tile)<<4 | row
+		} else {
+			// 8x16 sprites take their pattern table from bit 0 of the tile
+			// number and are made of two consecutive tiles
+			if flipV {
+				row = 15 - row
+			}
+			table := uint16(sprite.tile&0x01) << 12
+			tile := uint16(sprite.tile & 0xFE)
+			if row >= 8 {
+				tile++
+				row -= 8
+			}
+			addr = table | tile<<4 | row
+		}
+
+		lo := p.ppuRead(addr)
+		hi := p.ppuRead(addr + 8)
+		if i >= p.spriteCount {
+			continue
+		}
+		if flipH {
+			lo = reverseBits(lo)
+			hi = reverseBits(hi)
+		}
+		p.spriteShifterPattern[0][i] = lo
+		p.spriteShifterPattern[1][i] = hi
+	}
+}
+
+// drawPixel composes the background and sprite pixels at the current dot
+// and writes the result into the frame.
+func (p *PPU) drawPixel() {
+	x := p.cycle - 1
+	showLeft := x >= 8
+
+	bgPixel, bgPalette := byte(0), byte(0)
+	if p.mask&maskShowBackground != 0 && (showLeft || p.mask&maskShowBackgroundLeft != 0) {
+		bit := uint16(0x8000) >> p.fineX
+		bgPixel = p.shifterBit(p.bgShifterPattern, bit)
+		bgPalette = p.shifterBit(p.bgShifterAttrib, bit)
+	}
+
+	fgPixel, fgPalette, fgBehind := byte(0), byte(0), false
+	spriteZeroRendering := false
+	if p.mask&maskShowSprites != 0 && (showLeft || p.mask&maskShowSpritesLeft != 0) {
+		// The first opaque sprite in OAM order wins
+		for i := 0; i < p.spriteCount; i++ {
+			if p.spriteScanline[i].x != 0 {
+				continue
+			}
+			lo := (p.spriteShifterPattern[0][i] & 0x80) >> 7
+			hi := (p.spriteShifterPattern[1][i] & 0x80) >> 7
+			fgPixel = hi<<1 | lo
+			if fgPixel == 0 {
+				continue
+			}
+			fgPalette = (p.spriteScanline[i].attribute & 0x03) + 4
+			fgBehind = p.spriteScanline[i].attribute&0x20 != 0
+			spriteZeroRendering = i == 0 && p.spriteZeroHitPossible
+			break
+		}
+	}
+
+	pixel, palette := byte(0), byte(0)
+	switch {
+	case bgPixel == 0 && fgPixel == 0:
+		// Backdrop colour
+	case bgPixel == 0:
+		pixel, palette = fgPixel, fgPalette
+	case fgPixel == 0:
+		pixel, palette = bgPixel, bgPalette
+	default:
+		if fgBehind {
+			pixel, palette = bgPixel, bgPalette
+		} else {
+			pixel, palette = fgPixel, fgPalette
+		}
+
+		// Sprite zero hit never happens on the last pixel of a line
+		if spriteZeroRendering && x != 255 {
+			p.status |= statusSpriteZeroHit
+		}
+	}
+
+	p.Frame[p.scanline*FrameWidth+x] = p.colourFromPalette(palette, pixel)
+}
+
+// shifterBit combines the selected bit of a pair of shift registers into a
+// two bit value.
+func (p *PPU) shifterBit(shifter [2]uint16, bit uint16) byte {
+	value := byte(0)
+	if shifter[0]&bit != 0 {
+		value |= 0x01
+	}
+	if shifter[1]&bit != 0 {
+		value |= 0x02
+	}
+	return value
+}
+
+// colourFromPalette looks up the colour of a pixel value in one of the
+// eight palettes in palette RAM.
+func (p *PPU) colourFromPalette(palette byte, pixel byte) color.RGBA {
+	index := p.ppuRead(0x3F00+uint16(palette)<<2+uint16(pixel)) & 0x3F
+	if p.mask&maskGrayscale != 0 {
+		index &= 0x30
+	}
+	return systemPalette[index]
+}
+
+// advance moves to the next dot, scanline and frame.
+func (p *PPU) advance() {
+	p.clockCounter++
+	p.cycle++
+
+	// With rendering enabled, the NTSC pre-render line is one dot shorter
+	// on odd frames
+	if p.timing.oddFrameSkip && p.scanline == p.preRenderLine() && p.cycle == 340 &&
+		p.oddFrame && p.renderingEnabled() {
+		p.cycle++
+	}
+
+	if p.cycle >= ppuDotsPerScanline {
+		p.cycle = 0
+		p.scanline++
+		if p.scanline >= p.timing.scanlines {
+			p.scanline = 0
+			p.frameComplete = true
+			p.oddFrame = !p.oddFrame
+		}
+	}
+}
+
+// reverseBits mirrors the bits of b, for horizontally flipped sprites.
+func reverseBits(b byte) byte {
+	b = (b&0xF0)>>4 | (b&0x0F)<<4
+	b = (b&0xCC)>>2 | (b&0x33)<<2
+	b = (b&0xAA)>>1 | (b&0x55)<<1
+	return b
+}
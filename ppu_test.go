@@ -0,0 +1,155 @@
+package main
+
+import "testing"
+
+// setPPUAddress points v at addr through PPUADDR.
+func setPPUAddress(p *PPU, addr uint16) {
+	p.cpuWrite(0x0006, byte(addr>>8))
+	p.cpuWrite(0x0006, byte(addr))
+}
+
+func TestPPUPaletteMirroring(t *testing.T) {
+	tests := []struct {
+		name   string
+		write  uint16
+		read   uint16
+		shared bool
+	}{
+		{"$3F10 is $3F00", 0x3F10, 0x3F00, true},
+		{"$3F14 is $3F04", 0x3F14, 0x3F04, true},
+		{"$3F18 is $3F08", 0x3F18, 0x3F08, true},
+		{"$3F1C is $3F0C", 0x3F1C, 0x3F0C, true},
+		{"$3F00 is $3F10", 0x3F00, 0x3F10, true},
+		{"$3F11 is not $3F01", 0x3F11, 0x3F01, false},
+		{"$3F20 mirrors $3F00", 0x3F20, 0x3F00, true},
+		{"$3FE5 mirrors $3F05", 0x3FE5, 0x3F05, true},
+		{"$7F03 mirrors $3F03", 0x7F03, 0x3F03, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := NewPPU()
+			setPPUAddress(p, test.write)
+			p.cpuWrite(0x0007, 0xEA)
+
+			// Palette reads skip the read buffer, and only six bits are kept
+			setPPUAddress(p, test.read)
+			got := p.cpuRead(0x0007)
+			if shared := got == 0x2A; shared != test.shared {
+				t.Errorf("read $%02X, want shared %v", got, test.shared)
+			}
+		})
+	}
+}
+
+func TestPPUNametableMirroring(t *testing.T) {
+	tests := []struct {
+		name    string
+		image   []byte
+		control byte   // Written to $8000, for mappers that choose the mirroring
+		want    [4]int // Physical nametable behind $2000, $2400, $2800 and $2C00
+	}{
+		{"horizontal", testImage(t, 0, 1, 1, nil), 0, [4]int{0, 0, 1, 1}},
+		{"vertical", withFlags6(testImage(t, 0, 1, 1, nil), 0x01), 0, [4]int{0, 1, 0, 1}},
+		{"four-screen", withFlags6(testImage(t, 0, 1, 1, nil), 0x08), 0, [4]int{0, 1, 2, 3}},
+		{"single-screen low", testImage(t, 7, 2, 0, nil), 0x00, [4]int{0, 0, 0, 0}},
+		{"single-screen high", testImage(t, 7, 2, 0, nil), 0x10, [4]int{1, 1, 1, 1}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cart := loadTestImage(t, test.image)
+			cart.cpuWrite(0x8000, test.control)
+			p := NewPPU()
+			p.connectCartridge(cart)
+
+			for quadrant, table := range test.want {
+				base := 0x2000 + uint16(quadrant)*0x0400
+				p.ppuWrite(base+0x0123, byte(0x10+quadrant))
+				if got := p.nametables[table][0x0123]; got != byte(0x10+quadrant) {
+					t.Errorf("$%04X did not reach nametable %d", base+0x0123, table)
+				}
+				// $3000-$3EFF mirrors $2000-$2EFF
+				if got := p.ppuRead(base + 0x1123); got != byte(0x10+quadrant) {
+					t.Errorf("$%04X = $%02X, want $%02X", base+0x1123, got, 0x10+quadrant)
+				}
+			}
+		})
+	}
+}
+
+// withFlags6 sets bits in byte 6 of an image's header.
+func withFlags6(image []byte, flags byte) []byte {
+	image[6] |= flags
+	return image
+}
+
+func TestPPUDataReadBuffer(t *testing.T) {
+	p := NewPPU()
+	p.ppuWrite(0x2000, 0x11)
+	p.ppuWrite(0x2001, 0x22)
+	p.ppuWrite(0x2020, 0x33)
+	p.ppuWrite(0x2F00, 0x44) // Underneath $3F00
+	p.ppuWrite(0x3F00, 0x05)
+
+	tests := []struct {
+		name  string
+		setup func()
+		want  byte
+	}{
+		{"first read is stale", func() { setPPUAddress(p, 0x2000) }, 0x00},
+		{"then delayed by one", nil, 0x11},
+		{"and again", nil, 0x22},
+		{"increment by 32", func() {
+			p.cpuWrite(0x0000, ctrlIncrementMode)
+			setPPUAddress(p, 0x2000)
+			p.cpuRead(0x0007)
+		}, 0x11},
+		{"lands on the next row", nil, 0x33},
+		{"palette reads are immediate", func() {
+			p.cpuWrite(0x0000, 0)
+			setPPUAddress(p, 0x3F00)
+		}, 0x05},
+		{"and fill the buffer from below", func() { setPPUAddress(p, 0x2000) }, 0x44},
+	}
+
+	for _, test := range tests {
+		if test.setup != nil {
+			test.setup()
+		}
+		if got := p.cpuRead(0x0007); got != test.want {
+			t.Errorf("%s: read $%02X, want $%02X", test.name, got, test.want)
+		}
+	}
+}
+
+func TestPPUScrollRegisters(t *testing.T) {
+	// The example from the NESdev wiki's PPU scrolling page
+	p := NewPPU()
+	tests := []struct {
+		name    string
+		access  func()
+		t, v    uint16
+		fineX   byte
+		toggled bool
+	}{
+		{"$2000 write", func() { p.cpuWrite(0x0000, 0x03) }, 0x0C00, 0x0000, 0, false},
+		{"$2002 read", func() { p.cpuRead(0x0002) }, 0x0C00, 0x0000, 0, false},
+		{"first $2005 write", func() { p.cpuWrite(0x0005, 0x7D) }, 0x0C0F, 0x0000, 5, true},
+		{"second $2005 write", func() { p.cpuWrite(0x0005, 0x5E) }, 0x6D6F, 0x0000, 5, false},
+		{"first $2006 write", func() { p.cpuWrite(0x0006, 0x3D) }, 0x3D6F, 0x0000, 5, true},
+		{"second $2006 write", func() { p.cpuWrite(0x0006, 0xF0) }, 0x3DF0, 0x3DF0, 5, false},
+		{"$2002 read resets the toggle", func() {
+			p.cpuWrite(0x0005, 0x00)
+			p.cpuRead(0x0002)
+		}, 0x3DE0, 0x3DF0, 0, false},
+	}
+
+	for _, test := range tests {
+		test.access()
+		if p.t != test.t || p.v != test.v || p.fineX != test.fineX || p.w != test.toggled {
+			t.Errorf("after %s: t=$%04X v=$%04X x=%d w=%v, want t=$%04X v=$%04X x=%d w=%v",
+				test.name, p.t, p.v, p.fineX, p.w, test.t, test.v, test.fineX, test.toggled)
+		}
+	}
+}
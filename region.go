@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Region selects which console model is emulated. The models differ in
+// their CPU clock, the number of scanlines in a frame and some of the
+// APU's timings.
+type Region int
+
+const (
+	RegionNTSC Region = iota
+	RegionPAL
+	RegionDendy // Famiclone with PAL frame timing but NTSC-like CPU speed
+)
+
+var regionNames = [...]string{"ntsc", "pal", "dendy"}
+
+func (r Region) String() string {
+	if int(r) < len(regionNames) {
+		return regionNames[r]
+	}
+	return fmt.Sprintf("Region(%d)", int(r))
+}
+
+// parseRegion looks up a region by name, ignoring case.
+func parseRegion(name string) (Region, error) {
+	for r, n := range regionNames {
+		if strings.EqualFold(n, name) {
+			return Region(r), nil
+		}
+	}
+	return RegionNTSC, fmt.Errorf("unknown region %q (want ntsc, pal or dendy)", name)
+}
+
+// regionForTiming picks the region to emulate for a cartridge's timing
+// mode. Multi-region games run as NTSC.
+func regionForTiming(timing TimingMode) Region {
+	switch timing {
+	case TimingPAL:
+		return RegionPAL
+	case TimingDendy:
+		return RegionDendy
+	default:
+		return RegionNTSC
+	}
+}
+
+// frameSequence holds the frame counter step timings, in CPU cycles from
+// the last reset of the sequencer.
+type frameSequence struct {
+	step1, step2, step3, step4, step5 int
+	irqStart                          int
+	length4, length5                  int
+}
+
+// regionTiming holds the timings that differ between regions.
+type regionTiming struct {
+	cpuClockRate float64 // Hz
+	frameRate    float64 // Frames per second
+
+	// The CPU is clocked cpuCycles times every ppuDots dots
+	ppuDots   int
+	cpuCycles int
+
+	scanlines      int  // Per frame, including the pre-render scanline
+	vblankScanline int  // Scanline on which vertical blank starts
+	oddFrameSkip   bool // Whether odd frames skip a dot when rendering
+
+	frameSequence frameSequence
+	noisePeriods  *[16]uint16
+	dmcRates      *[16]uint16
+}
+
+var (
+	ntscFrameSequence = frameSequence{
+		step1: 7457, step2: 14913, step3: 22371, step4: 29829, step5: 37281,
+		irqStart: 29828,
+		length4:  29830, length5: 37282,
+	}
+	palFrameSequence = frameSequence{
+		step1: 8313, step2: 16627, step3: 24939, step4: 33253, step5: 41565,
+		irqStart: 33252,
+		length4:  33254, length5: 41566,
+	}
+)
+
+var regionTimings = [...]regionTiming{
+	RegionNTSC: {
+		cpuClockRate:   1789773.0,
+		frameRate:      60.0988,
+		ppuDots:        3,
+		cpuCycles:      1,
+		scanlines:      262,
+		vblankScanline: 241,
+		oddFrameSkip:   true,
+		frameSequence:  ntscFrameSequence,
+		noisePeriods:   &noisePeriods,
+		dmcRates:       &dmcRates,
+	},
+	RegionPAL: {
+		cpuClockRate:   1662607.0,
+		frameRate:      50.0070,
+		ppuDots:        16,
+		cpuCycles:      5,
+		scanlines:      312,
+		vblankScanline: 241,
+		frameSequence:  palFrameSequence,
+		noisePeriods:   &noisePeriodsPAL,
+		dmcRates:       &dmcRatesPAL,
+	},
+	RegionDendy: {
+		cpuClockRate: 1773448.0,
+		frameRate:    50.0070,
+		ppuDots:      3,
+		cpuCycles:    1,
+		scanlines:    312,
+
+		// Dendy keeps NTSC's post-render time, then idles for another
+		// 50 scanlines before vertical blank
+		vblankScanline: 291,
+		frameSequence:  ntscFrameSequence,
+		noisePeriods:   &noisePeriods,
+		dmcRates:       &dmcRates,
+	},
+}
+
+// timing returns the timings of a region.
+func (r Region) timing() *regionTiming {
+	if int(r) < len(regionTimings) {
+		return &regionTimings[r]
+	}
+	return &regionTimings[RegionNTSC]
+}
@@ -0,0 +1,76 @@
+package main
+
+import "sync/atomic"
+
+// sampleRing is a lock-free ring buffer of audio samples for exactly one
+// producer and one consumer, which may run on different goroutines or
+// threads: the emulator writes samples and the audio device reads them.
+//
+// The read and write positions only ever increase, and each is written
+// by one side only, so the two sides never need a lock.
+type sampleRing struct {
+	buffer []float32
+	mask   uint64
+	read   atomic.Uint64
+	write  atomic.Uint64
+}
+
+// newSampleRing returns a ring holding at least size samples. The
+// capacity is rounded up to a power of two.
+func newSampleRing(size int) *sampleRing {
+	capacity := 1
+	for capacity < size {
+		capacity <<= 1
+	}
+	return &sampleRing{
+		buffer: make([]float32, capacity),
+		mask:   uint64(capacity - 1),
+	}
+}
+
+// Capacity returns the number of samples the ring can hold.
+func (r *sampleRing) Capacity() int {
+	return len(r.buffer)
+}
+
+// Len returns the number of samples waiting to be read.
+func (r *sampleRing) Len() int {
+	return int(r.write.Load() - r.read.Load())
+}
+
+// Write appends as many samples as fit and returns how many were
+// written. It must only be called by the producer.
+func (r *sampleRing) Write(samples []float32) int {
+	write := r.write.Load()
+	free := uint64(len(r.buffer)) - (write - r.read.Load())
+
+	n := uint64(len(samples))
+	if n > free {
+		n = free
+	}
+	for i := uint64(0); i < n; i++ {
+		r.buffer[(write+i)&r.mask] = samples[i]
+	}
+
+	// Publish the samples only once they are in place
+	r.write.Store(write + n)
+	return int(n)
+}
+
+// Read fills dst with as many samples as are available and returns how
+// many were read. It must only be called by the consumer.
+func (r *sampleRing) Read(dst []float32) int {
+	read := r.read.Load()
+	available := r.write.Load() - read
+
+	n := uint64(len(dst))
+	if n > available {
+		n = available
+	}
+	for i := uint64(0); i < n; i++ {
+		dst[i] = r.buffer[(read+i)&r.mask]
+	}
+
+	r.read.Store(read + n)
+	return int(n)
+}
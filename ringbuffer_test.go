@@ -0,0 +1,117 @@
+package main
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestSampleRingCapacity(t *testing.T) {
+	tests := []struct {
+		size int
+		want int
+	}{
+		{1, 1},
+		{2, 2},
+		{3, 4},
+		{1000, 1024},
+		{4096, 4096},
+	}
+
+	for _, test := range tests {
+		if got := newSampleRing(test.size).Capacity(); got != test.want {
+			t.Errorf("newSampleRing(%d).Capacity() = %d, want %d", test.size, got, test.want)
+		}
+	}
+}
+
+func TestSampleRingReadWrite(t *testing.T) {
+	// Each step writes and then reads a number of samples, which are
+	// numbered in the order they were written
+	type step struct {
+		write     int
+		read      int
+		wantWrote int
+		wantRead  int
+		wantLen   int
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"empty", []step{{0, 4, 0, 0, 0}}},
+		{"write then read", []step{{3, 0, 3, 0, 3}, {0, 3, 0, 3, 0}}},
+		{"partial read", []step{{5, 2, 5, 2, 3}, {0, 8, 0, 3, 0}}},
+		{"full", []step{{8, 0, 8, 0, 8}, {1, 0, 0, 0, 8}}},
+		{"overfull write is cut short", []step{{10, 0, 8, 0, 8}, {0, 10, 0, 8, 0}}},
+		{"wraps around", []step{{6, 6, 6, 6, 0}, {6, 3, 6, 3, 3}, {4, 8, 4, 7, 0}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ring := newSampleRing(8)
+			next, expect := float32(0), float32(0)
+
+			for i, s := range test.steps {
+				samples := make([]float32, s.write)
+				for j := range samples {
+					samples[j] = next + float32(j)
+				}
+				wrote := ring.Write(samples)
+				next += float32(wrote)
+
+				dst := make([]float32, s.read)
+				read := ring.Read(dst)
+				for j := 0; j < read; j++ {
+					if dst[j] != expect {
+						t.Fatalf("step %d: sample %d is %v, want %v", i, j, dst[j], expect)
+					}
+					expect++
+				}
+
+				if wrote != s.wantWrote || read != s.wantRead || ring.Len() != s.wantLen {
+					t.Errorf("step %d: wrote %d, read %d, %d left; want %d, %d, %d",
+						i, wrote, read, ring.Len(), s.wantWrote, s.wantRead, s.wantLen)
+				}
+			}
+		})
+	}
+}
+
+func TestSampleRingConcurrent(t *testing.T) {
+	const total = 20000
+	ring := newSampleRing(64)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		samples := make([]float32, 7)
+		for next := 0; next < total; {
+			n := min(len(samples), total-next)
+			for i := 0; i < n; i++ {
+				samples[i] = float32(next + i)
+			}
+			wrote := ring.Write(samples[:n])
+			if wrote == 0 {
+				runtime.Gosched()
+			}
+			next += wrote
+		}
+	}()
+
+	dst := make([]float32, 5)
+	for expect := 0; expect < total; {
+		n := ring.Read(dst)
+		if n == 0 {
+			runtime.Gosched()
+		}
+		for i := 0; i < n; i++ {
+			if dst[i] != float32(expect) {
+				t.Fatalf("sample %d is %v", expect, dst[i])
+			}
+			expect++
+		}
+	}
+	wg.Wait()
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// stdinPath names standard input in place of a ROM file.
+const stdinPath = "-"
+
+// maxROMFileSize bounds how much is read from a ROM file or archive entry.
+// The largest NES 2.0 images are a few megabytes.
+const maxROMFileSize = 64 << 20
+
+// Magic numbers of the compressed formats a ROM may be stored in
+var (
+	zipMagic  = []byte("PK\x03\x04")
+	gzipMagic = []byte{0x1F, 0x8B}
+)
+
+// loadROM loads a cartridge from a ROM file, which may be zipped or
+// gzipped, or from standard input when the path is "-".
+//
+// From a zip archive the entry named entry is loaded, or the first entry
+// with a .nes extension when entry is empty. The format is recognised from
+// the contents rather than the file name, so that piped archives work too.
+func loadROM(filename string, entry string) (*Cartridge, error) {
+	data, err := readROMFile(filename, entry)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := NewCartridgeFromBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", romName(filename, entry), err)
+	}
+	return c, nil
+}
+
+// loadROMImage is like loadROM, but only reads the image without building
+// its mapper, so that it also works for unsupported mappers. The returned
+// cartridge can be inspected but not inserted into a console.
+func loadROMImage(filename string, entry string) (*Cartridge, error) {
+	data, err := readROMFile(filename, entry)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := readImage(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", romName(filename, entry), err)
+	}
+	return c, nil
+}
+
+// readROMFile returns the uncompressed iNES image in a ROM file.
+func readROMFile(filename string, entry string) ([]byte, error) {
+	var data []byte
+	var err error
+	if filename == stdinPath {
+		data, err = readLimited(os.Stdin)
+	} else {
+		var file *os.File
+		file, err = os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		data, err = readLimited(file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", romName(filename, ""), err)
+	}
+
+	switch {
+	case bytes.HasPrefix(data, zipMagic):
+		data, err = readZipEntry(data, entry)
+	case bytes.HasPrefix(data, gzipMagic):
+		data, err = readGzip(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", romName(filename, ""), err)
+	}
+	return data, nil
+}
+
+// readZipEntry extracts an image from a zip archive held in data.
+func readZipEntry(data []byte, entry string) ([]byte, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	var found *zip.File
+	for _, file := range archive.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		if entry != "" {
+			if file.Name == entry || path.Base(file.Name) == entry {
+				found = file
+				break
+			}
+		} else if strings.EqualFold(path.Ext(file.Name), ".nes") {
+			found = file
+			break
+		}
+	}
+	if found == nil {
+		if entry != "" {
+			return nil, fmt.Errorf("archive has no entry %q", entry)
+		}
+		return nil, errors.New("archive has no .nes entry")
+	}
+
+	r, err := found.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return readLimited(r)
+}
+
+// readGzip decompresses a gzipped image held in data.
+func readGzip(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return readLimited(r)
+}
+
+// readLimited reads all of r, refusing anything too large to be a ROM.
+func readLimited(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxROMFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxROMFileSize {
+		return nil, fmt.Errorf("file is larger than %d bytes", maxROMFileSize)
+	}
+	return data, nil
+}
+
+// romName describes a ROM file, and the archive entry within it, in
+// messages.
+func romName(filename string, entry string) string {
+	if filename == stdinPath {
+		filename = "<stdin>"
+	}
+	if entry != "" {
+		return filename + ":" + entry
+	}
+	return filename
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// zipFile is a file to put in a test archive.
+type zipFile struct {
+	name string
+	data []byte
+}
+
+// zipImages builds a zip archive holding the given files, in order.
+func zipImages(t *testing.T, files ...zipFile) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, file := range files {
+		f, err := w.Create(file.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write(file.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// gzipImage compresses an image with gzip.
+func gzipImage(t *testing.T, image []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(image); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestLoadROM(t *testing.T) {
+	// Each image starts its program with a different byte, to tell which
+	// was loaded
+	first := testImage(t, 0, 1, 1, []byte{0x01})
+	second := testImage(t, 0, 1, 1, []byte{0x02})
+	readme := []byte("Not a ROM image.")
+	archive := zipImages(t,
+		zipFile{"README.txt", readme},
+		zipFile{"roms/", nil},
+		zipFile{"roms/First.NES", first},
+		zipFile{"roms/second.nes", second},
+	)
+
+	tests := []struct {
+		name  string
+		data  []byte
+		entry string
+		want  byte   // First byte of PRG ROM
+		err   string // Expected error message, if any
+	}{
+		{name: "plain", data: first, want: 0x01},
+		{name: "gzip", data: gzipImage(t, second), want: 0x02},
+		{name: "zip", data: archive, want: 0x01},
+		{name: "zip entry by path", data: archive, entry: "roms/second.nes", want: 0x02},
+		{name: "zip entry by name", data: archive, entry: "second.nes", want: 0x02},
+		{name: "zip entry that is not a ROM", data: archive, entry: "README.txt", err: `rom.bin:README.txt: not an iNES image: missing "NES\x1A" magic number`},
+		{name: "zip missing entry", data: archive, entry: "third.nes", err: `rom.bin: archive has no entry "third.nes"`},
+		{name: "zip with no .nes entry", data: zipImages(t, zipFile{"README.txt", readme}), err: "rom.bin: archive has no .nes entry"},
+		{name: "corrupt gzip", data: gzipMagic, err: "rom.bin: unexpected EOF"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// The format is found from the contents, not the extension
+			filename := filepath.Join(t.TempDir(), "rom.bin")
+			if err := os.WriteFile(filename, test.data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			c, err := loadROM(filename, test.entry)
+			if test.err != "" {
+				if err == nil || !strings.HasSuffix(err.Error(), test.err) {
+					t.Errorf("got error %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.prgMemory[0] != test.want {
+				t.Errorf("loaded the image starting $%02X, want $%02X", c.prgMemory[0], test.want)
+			}
+		})
+	}
+}
+
+func TestLoadROMFromStdin(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{"plain", testImage(t, 0, 1, 1, []byte{0x01}), ""},
+		{"gzip", gzipImage(t, testImage(t, 0, 1, 1, []byte{0x01})), ""},
+		{"truncated", testImage(t, 0, 1, 1, nil)[:8], "<stdin>: truncated header: expected 16 bytes, got 8"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stdin, err := os.CreateTemp(t.TempDir(), "stdin")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer stdin.Close()
+			if _, err := stdin.Write(test.data); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := stdin.Seek(0, io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+
+			saved := os.Stdin
+			os.Stdin = stdin
+			defer func() { os.Stdin = saved }()
+
+			c, err := loadROM(stdinPath, "")
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Errorf("got error %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.prgMemory[0] != 0x01 {
+				t.Errorf("loaded the image starting $%02X, want $01", c.prgMemory[0])
+			}
+		})
+	}
+}
+
+func TestReadLimited(t *testing.T) {
+	if _, err := readLimited(bytes.NewReader(make([]byte, maxROMFileSize))); err != nil {
+		t.Errorf("%d bytes: %v", maxROMFileSize, err)
+	}
+	if _, err := readLimited(bytes.NewReader(make([]byte, maxROMFileSize+1))); err == nil {
+		t.Errorf("%d bytes read without error", maxROMFileSize+1)
+	}
+}
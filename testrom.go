@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Test ROMs in the style of blargg's report their progress in PRG RAM: a
+// status byte at $6000, a signature at $6001-$6003 marking the status as
+// valid, and a zero-terminated message from $6004.
+const (
+	testStatusAddr  = 0x6000
+	testMessageAddr = 0x6004
+
+	testStatusRunning     = 0x80
+	testStatusResetNeeded = 0x81
+
+	testResetDelayFrames  = 6 // The ROMs ask for at least 100ms
+	testMaxMessageLength  = 0x1000
+	defaultTestFrameLimit = 60 * 60
+)
+
+var testSignature = [...]byte{0xDE, 0xB0, 0x61}
+
+// runTest implements the test subcommand, which runs a test ROM without a
+// window and exits with success only if it passes.
+func runTest(args []string) int {
+	flags := newFlagSet("test", "[flags] <rom> [zip entry]")
+	frames := flags.Int("frames", defaultTestFrameLimit, "give up after `n` frames")
+	regionName := flags.String("region", "auto", "console `region`: auto, ntsc, pal or dendy")
+	applyGameDB := gameDBFlags(flags)
+
+	positional, err := parseArgs(flags, args)
+	if err != nil {
+		return flagError(err)
+	}
+	if err := applyGameDB(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	romPath, entry, ok := romArgs(flags, positional)
+	if !ok {
+		return exitUsage
+	}
+
+	cart, err := loadROM(romPath, entry)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	region, err := regionFlag(*regionName, cart)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	status, message, err := runTestROM(newConsole(cart, region), *frames)
+	if message != "" {
+		fmt.Println(message)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitError
+	}
+	if status != 0 {
+		fmt.Fprintf(os.Stderr, "FAILED with status %d\n", status)
+		return exitError
+	}
+	fmt.Println("PASSED")
+	return exitOK
+}
+
+// runTestROM runs the console until the test ROM in it reports a result
+// or frameLimit frames pass, and returns the result code and message.
+func runTestROM(mainbus *MainBus, frameLimit int) (byte, string, error) {
+	resetAt := -1
+	for frame := 0; frame < frameLimit; frame++ {
+		mainbus.runFrame()
+		if mainbus.cpu.Halted() {
+			return 0, readTestMessage(mainbus), mainbus.cpu.HaltReason()
+		}
+
+		if !testSignaturePresent(mainbus) {
+			continue
+		}
+
+		switch status := mainbus.Peek(testStatusAddr); status {
+		case testStatusRunning:
+		case testStatusResetNeeded:
+			// Press reset a little after being asked to
+			if resetAt < 0 {
+				resetAt = frame + testResetDelayFrames
+			} else if frame >= resetAt {
+				mainbus.Reset()
+				resetAt = -1
+			}
+		default:
+			return status, readTestMessage(mainbus), nil
+		}
+	}
+	return 0, readTestMessage(mainbus), fmt.Errorf("no result after %d frames", frameLimit)
+}
+
+// testSignaturePresent reports whether the test ROM has marked its status
+// byte as valid.
+func testSignaturePresent(mainbus *MainBus) bool {
+	for i, b := range testSignature {
+		if mainbus.Peek(testStatusAddr+1+uint16(i)) != b {
+			return false
+		}
+	}
+	return true
+}
+
+// readTestMessage returns the message the test ROM has written so far.
+func readTestMessage(mainbus *MainBus) string {
+	if !testSignaturePresent(mainbus) {
+		return ""
+	}
+
+	var message strings.Builder
+	for i := uint16(0); i < testMaxMessageLength; i++ {
+		b := mainbus.Peek(testMessageAddr + i)
+		if b == 0 {
+			break
+		}
+		message.WriteByte(b)
+	}
+	return strings.TrimSpace(message.String())
+}
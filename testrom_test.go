@@ -0,0 +1,52 @@
+package main
+
+import "testing"
+
+func TestRunTestROM(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapper  byte
+		status  byte
+		message string
+	}{
+		{"NROM pass", 0, 0, "OK"},
+		{"NROM fail", 0, 3, "Failed"},
+		{"UxROM pass", 2, 0, "OK"},
+		{"CNROM fail", 3, 1, "Failed"},
+		{"AxROM pass", 7, 0, "OK"},
+		{"GxROM pass", 66, 0, "OK"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Write the status and message, then the signature that marks
+			// them as valid, and spin
+			var program []byte
+			store := func(addr uint16, value byte) {
+				program = append(program, 0xA9, value, 0x8D, byte(addr), byte(addr>>8)) // LDA #value; STA addr
+			}
+			store(testStatusAddr, test.status)
+			for i := 0; i <= len(test.message); i++ {
+				var b byte
+				if i < len(test.message) {
+					b = test.message[i]
+				}
+				store(testMessageAddr+uint16(i), b)
+			}
+			for i, b := range testSignature {
+				store(testStatusAddr+1+uint16(i), b)
+			}
+			spin := 0x8000 + uint16(len(program))
+			program = append(program, 0x4C, byte(spin), byte(spin>>8)) // JMP spin
+
+			cart := loadTestImage(t, testImage(t, test.mapper, 2, 1, program))
+			status, message, err := runTestROM(newConsole(cart, RegionNTSC), 10)
+			if err != nil {
+				t.Fatalf("runTestROM: %v", err)
+			}
+			if status != test.status || message != test.message {
+				t.Errorf("got status %d and message %q, want %d and %q", status, message, test.status, test.message)
+			}
+		})
+	}
+}